@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+var (
+	errPasswordMismatch = messageError("account.password_mismatch")
+	errWrongPassword    = messageError("account.wrong_password")
+)
+
+// accountRequest holds the fields of the login, registration and password forms
+type accountRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Current  string `json:"current"`
+	Confirm  string `json:"confirm"`
+}
+
+// maxFormRequestSize bounds the bodies of the account and hint forms
+const maxFormRequestSize = 64 << 10
+
+// readAccountRequest reads the account fields from a form or, when the body is JSON, from the JSON object
+func readAccountRequest(w http.ResponseWriter, r *http.Request) (accountRequest, error) {
+	var req accountRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormRequestSize)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		return req, err
+	}
+	req.Username = r.FormValue("username")
+	req.Password = r.FormValue("password")
+	req.Current = r.FormValue("current")
+	req.Confirm = r.FormValue("confirm")
+	return req, nil
+}
+
+// checkConfirm rejects a confirmation that differs from the new password. JSON clients may omit it.
+func (req accountRequest) checkConfirm() error {
+	if req.Confirm != "" && req.Confirm != req.Password {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+type AccountData struct {
+	Title    string `json:"-"`
+	Register bool   `json:"-"`
+	User     string `json:"user,omitempty"`
+	Message  string `json:"message,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// accountErrorStatus returns the status for an error shown on the account forms, or 0 for unexpected errors
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUserExists):
+		return http.StatusConflict
+	case errors.Is(err, errWrongPassword):
+		return http.StatusForbidden
+	case errors.Is(err, errInvalidUsername), errors.Is(err, errWeakPassword), errors.Is(err, errPasswordMismatch):
+		return http.StatusUnprocessableEntity
+	default:
+		return 0
+	}
+}
+
+// respondAccount renders the account form or, for JSON requests, the result
+func respondAccount(w http.ResponseWriter, r *http.Request, data AccountData, err error) {
+	if err == nil {
+		respond(w, r, http.StatusOK, "account", data)
+		return
+	}
+	status := accountErrorStatus(err)
+	if status == 0 {
+		respondError(w, r, "Database Error", http.StatusInternalServerError)
+		return
+	}
+	data.Error = errorMessage(requestLanguage(r), err)
+	respond(w, r, status, "account", data)
+}
+
+// registerHandler lets visitors create an account. Registration only exists in hardened mode.
+func registerHandler(w http.ResponseWriter, r *http.Request) {
+	if !mode.hardened() {
+		respondNotFound(w, r)
+		return
+	}
+
+	data := AccountData{Title: localize(r, "account.register_title"), Register: true}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		respondAccount(w, r, data, nil)
+	case http.MethodPost:
+		req, err := readAccountRequest(w, r)
+		if err != nil {
+			respondError(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		data.User = req.Username
+
+		if err := req.checkConfirm(); err != nil {
+			respondAccount(w, r, data, err)
+			return
+		}
+		if _, err := registerUser(r.Context(), accounts, req.Username, req.Password); err != nil {
+			respondAccount(w, r, data, err)
+			return
+		}
+		if err := setLoginCookie(w, r, req.Username); err != nil {
+			respondError(w, r, "Session Error", http.StatusInternalServerError)
+			return
+		}
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusCreated, data)
+			return
+		}
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+	}
+}
+
+// passwordHandler lets a logged in user change their password. It only exists in hardened mode.
+func passwordHandler(w http.ResponseWriter, r *http.Request) {
+	if !mode.hardened() {
+		respondNotFound(w, r)
+		return
+	}
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return
+	}
+
+	data := AccountData{Title: localize(r, "account.password_title"), User: user}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		respondAccount(w, r, data, nil)
+	case http.MethodPost:
+		req, err := readAccountRequest(w, r)
+		if err != nil {
+			respondError(w, r, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		_, err = verifyPassword(r.Context(), user, req.Current)
+		switch {
+		case errors.Is(err, errUserNotFound):
+			err = errWrongPassword
+		case err == nil:
+			err = req.checkConfirm()
+		}
+		if err == nil {
+			err = setPassword(r.Context(), accounts, user, req.Password)
+		}
+		if err == nil {
+			// Sessions opened with the old password, possibly by someone else, end with it
+			err = revokeOtherSessions(user, currentSessionID(r))
+		}
+		if err == nil {
+			data.Message = localize(r, "account.password_changed")
+		}
+		respondAccount(w, r, data, err)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func postAccountForm(t *testing.T, handler http.HandlerFunc, path, session string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := newAPIRequest(t, http.MethodPost, path, "", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if session != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session})
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRegisterHandler(t *testing.T) {
+	t.Run("vulnerable mode -> 404", func(t *testing.T) {
+		setMode(t, modeVulnerable)
+
+		// Input: GET /register
+		rr := httptest.NewRecorder()
+		registerHandler(rr, newAPIRequest(t, http.MethodGet, "/register", "", nil))
+
+		// Expected Output: Registration does not exist
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("GET -> registration form", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: GET /register
+		rr := httptest.NewRecorder()
+		registerHandler(rr, newAPIRequest(t, http.MethodGet, "/register", "", nil))
+
+		// Expected Output: The form posting to /register
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		if !strings.Contains(rr.Body.String(), `action="/register"`) {
+			t.Error("Expected registration form")
+		}
+	})
+
+	testCases := []struct {
+		name     string
+		form     url.Values
+		expected int
+	}{
+		{"existing user -> 409", url.Values{"username": {"kanmu"}, "password": {"password123"}, "confirm": {"password123"}}, http.StatusConflict},
+		{"weak password -> 422", url.Values{"username": {"newcomer"}, "password": {"short"}, "confirm": {"short"}}, http.StatusUnprocessableEntity},
+		{"invalid username -> 422", url.Values{"username": {"<script>"}, "password": {"password123"}, "confirm": {"password123"}}, http.StatusUnprocessableEntity},
+		{"confirmation mismatch -> 422", url.Values{"username": {"newcomer"}, "password": {"password123"}, "confirm": {"password124"}}, http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setMode(t, modeHardened)
+			useAccounts(t)
+
+			// Input: POST /register with invalid values
+			rr := postAccountForm(t, registerHandler, "/register", "", tc.form)
+
+			// Expected Output: The form again with the error, and no account created
+			if status := rr.Code; status != tc.expected {
+				t.Errorf("Expected status %v, got %v", tc.expected, status)
+			}
+			if !strings.Contains(rr.Body.String(), `class="error"`) {
+				t.Error("Expected error message")
+			}
+			if _, err := accounts.Get(context.Background(), "newcomer"); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Expected no account, got %v", err)
+			}
+		})
+	}
+
+	t.Run("valid registration -> logged in", func(t *testing.T) {
+		setMode(t, modeHardened)
+		useAccounts(t)
+
+		// Input: POST /register
+		form := url.Values{"username": {"newcomer"}, "password": {"password123"}, "confirm": {"password123"}}
+		rr := postAccountForm(t, registerHandler, "/register", "", form)
+
+		// Expected Output: Redirect to the dashboard with a session, and the new password works for login
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Fatalf("Expected status %v, got %v", http.StatusSeeOther, status)
+		}
+		if !hasCookie(rr, sessionCookieName) {
+			t.Error("Expected session cookie")
+		}
+		if status := postLogin(t, "newcomer", "password123").Code; status != http.StatusFound {
+			t.Errorf("Expected login to succeed, got status %v", status)
+		}
+	})
+
+	t.Run("JSON registration -> 201", func(t *testing.T) {
+		setMode(t, modeHardened)
+		useAccounts(t)
+
+		// Input: POST /api/v1/register with a JSON body
+		req := newAPIRequest(t, http.MethodPost, "/api/v1/register", "", strings.NewReader(`{"username":"jsonuser","password":"password123"}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		registerHandler(rr, req)
+
+		// Expected Output: 201 with the user
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("Expected status %v, got %v", http.StatusCreated, status)
+		}
+		var data AccountData
+		decodeJSON(t, rr, &data)
+		if data.User != "jsonuser" {
+			t.Errorf("Expected jsonuser, got %+v", data)
+		}
+	})
+}
+
+func TestPasswordHandler(t *testing.T) {
+	t.Run("without session -> redirect", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: GET /account/password without a session
+		rr := httptest.NewRecorder()
+		passwordHandler(rr, newAPIRequest(t, http.MethodGet, "/account/password", "", nil))
+
+		// Expected Output: Redirect to the login page
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("wrong current password -> 403", func(t *testing.T) {
+		setMode(t, modeHardened)
+		useAccounts(t)
+
+		// Input: POST /account/password with a wrong current password
+		form := url.Values{"current": {"wrong"}, "password": {"newpassword"}, "confirm": {"newpassword"}}
+		rr := postAccountForm(t, passwordHandler, "/account/password", newSessionToken(t, "kanmu"), form)
+
+		// Expected Output: 403 and the old password still works
+		if status := rr.Code; status != http.StatusForbidden {
+			t.Errorf("Expected status %v, got %v", http.StatusForbidden, status)
+		}
+		if _, err := verifyPassword(context.Background(), "kanmu", "gocon2025"); err != nil {
+			t.Errorf("Expected old password to still work, got %v", err)
+		}
+	})
+
+	t.Run("valid change -> new password works", func(t *testing.T) {
+		setMode(t, modeHardened)
+		useAccounts(t)
+
+		// Input: POST /account/password with the current password while kanmu has another session
+		other := newSessionToken(t, "kanmu")
+		current := newSessionToken(t, "kanmu")
+		form := url.Values{"current": {"gocon2025"}, "password": {"newpassword"}, "confirm": {"newpassword"}}
+		rr := postAccountForm(t, passwordHandler, "/account/password", current, form)
+
+		// Expected Output: Success message, only the new password and the current session work
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		if !strings.Contains(rr.Body.String(), "パスワードを変更しました") {
+			t.Error("Expected success message")
+		}
+		if _, err := verifyPassword(context.Background(), "kanmu", "gocon2025"); !errors.Is(err, errUserNotFound) {
+			t.Errorf("Expected old password to be rejected, got %v", err)
+		}
+		if _, err := verifyPassword(context.Background(), "kanmu", "newpassword"); err != nil {
+			t.Errorf("Expected new password to work, got %v", err)
+		}
+		if _, ok := lookupSession(current); !ok {
+			t.Error("Expected the current session to be kept")
+		}
+		if _, ok := lookupSession(other); ok {
+			t.Error("Expected the other session to be revoked")
+		}
+	})
+
+	t.Run("oversized JSON body -> 400", func(t *testing.T) {
+		setMode(t, modeHardened)
+		useAccounts(t)
+
+		// Input: POST /account/password with a JSON body larger than maxFormRequestSize
+		body := `{"current":"gocon2025","password":"` + strings.Repeat("a", maxFormRequestSize) + `"}`
+		req := newAPIRequest(t, http.MethodPost, "/account/password", "", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, "kanmu")})
+		rr := httptest.NewRecorder()
+		passwordHandler(rr, req)
+
+		// Expected Output: 400 and the old password still works
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status %v, got %v", http.StatusBadRequest, status)
+		}
+		if _, err := verifyPassword(context.Background(), "kanmu", "gocon2025"); err != nil {
+			t.Errorf("Expected old password to still work, got %v", err)
+		}
+	})
+}
+
+func hasCookie(rr *httptest.ResponseRecorder, name string) bool {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// responseCookie returns the value of the cookie set by the response, or ""
+func responseCookie(rr *httptest.ResponseRecorder, name string) string {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
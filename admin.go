@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/subtle"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adminUser and adminPassword protect /admin with basic authentication. The admin area is disabled while
+// adminPassword is empty; it is separate from the player accounts, which the login stage lets players take over.
+var (
+	adminUser     = "admin"
+	adminPassword string
+)
+
+// maxActivity is the number of login attempts and downloads kept for the admin dashboard
+const maxActivity = 500
+
+// Results of a login attempt
+const (
+	loginSucceeded   = "success"
+	loginFailed      = "failure"
+	loginDumpedUsers = "dumped"
+	loginRateLimited = "rate_limited"
+	loginError       = "error"
+)
+
+type LoginAttempt struct {
+	At       time.Time `json:"at"`
+	IP       string    `json:"ip"`
+	Player   string    `json:"player,omitempty"`
+	Username string    `json:"username"`
+	// Query is the SQL the login query ran; hardened mode does not build one
+	Query   string `json:"query,omitempty"`
+	Result  string `json:"result"`
+	Matched int    `json:"matched"`
+}
+
+type Download struct {
+	At     time.Time `json:"at"`
+	IP     string    `json:"ip"`
+	Player string    `json:"player,omitempty"`
+	User   string    `json:"user"`
+	File   string    `json:"file"`
+}
+
+// activityLog keeps the most recent login attempts and downloads in memory
+type activityLog struct {
+	mu        sync.Mutex
+	logins    []LoginAttempt
+	downloads []Download
+}
+
+var activity = &activityLog{}
+
+func (a *activityLog) recordLogin(attempt LoginAttempt) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.logins = appendRecent(a.logins, attempt)
+}
+
+func (a *activityLog) recordDownload(download Download) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.downloads = appendRecent(a.downloads, download)
+}
+
+// recent returns the login attempts and downloads, newest first
+func (a *activityLog) recent() ([]LoginAttempt, []Download) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return newestFirst(a.logins), newestFirst(a.downloads)
+}
+
+// appendRecent appends v and drops the oldest entries beyond maxActivity
+func appendRecent[T any](list []T, v T) []T {
+	list = append(list, v)
+	if len(list) > maxActivity {
+		list = append(list[:0], list[len(list)-maxActivity:]...)
+	}
+	return list
+}
+
+func newestFirst[T any](list []T) []T {
+	reversed := make([]T, len(list))
+	for i, v := range list {
+		reversed[len(list)-1-i] = v
+	}
+	return reversed
+}
+
+// playerKey returns the instance key of the player making the request, or ""
+func playerKey(r *http.Request) string {
+	if inst, ok := playerInstance(r); ok {
+		return inst.key
+	}
+	return ""
+}
+
+type StageSolves struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Players []string `json:"players"`
+}
+
+type AdminData struct {
+	Mode      string            `json:"mode"`
+	Sessions  []*Session        `json:"sessions"`
+	Instances []InstanceSummary `json:"instances"`
+	Logins    []LoginAttempt    `json:"logins"`
+	Solves    []StageSolves     `json:"solves"`
+	Downloads []Download        `json:"downloads"`
+	CSRFToken string            `json:"-"`
+}
+
+// authorizeAdmin checks the admin credentials, asking the browser for them when they are missing
+func authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if adminPassword == "" {
+		respondNotFound(w, r)
+		return false
+	}
+	user, password, ok := r.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(adminUser)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(adminPassword)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+		respondError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// adminCSRFToken is sent with the admin forms. Browsers resend basic credentials on cross-site posts,
+// so the actions also require this token, which other sites cannot read.
+func adminCSRFToken() string {
+	return sign(adminCSRFPurpose, adminUser)
+}
+
+func getAdminData(lang string) (AdminData, error) {
+	list, err := sessions.List()
+	if err != nil {
+		return AdminData{}, err
+	}
+	logins, downloads := activity.recent()
+
+	data := AdminData{
+		Mode:      string(mode),
+		Sessions:  list,
+		Instances: instances.list(),
+		Logins:    logins,
+		Solves:    []StageSolves{},
+		Downloads: downloads,
+		CSRFToken: adminCSRFToken(),
+	}
+	for _, c := range enabledChallenges {
+		players := board.solvers(c.ID())
+		if players == nil {
+			players = []string{}
+		}
+		data.Solves = append(data.Solves, StageSolves{ID: c.ID(), Name: challengeName(lang, c), Players: players})
+	}
+	return data, nil
+}
+
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAdmin(w, r) {
+		return
+	}
+
+	data, err := getAdminData(requestLanguage(r))
+	if err != nil {
+		respondError(w, r, "Session Error", http.StatusInternalServerError)
+		return
+	}
+	respond(w, r, http.StatusOK, "admin", data)
+}
+
+// adminAction checks an admin form post and returns the value of its field
+func adminAction(w http.ResponseWriter, r *http.Request, field string) (string, bool) {
+	if !authorizeAdmin(w, r) {
+		return "", false
+	}
+	if !hmac.Equal([]byte(r.FormValue("csrf_token")), []byte(adminCSRFToken())) {
+		respondError(w, r, "Forbidden", http.StatusForbidden)
+		return "", false
+	}
+	value := r.FormValue(field)
+	if value == "" {
+		respondError(w, r, "Bad Request", http.StatusBadRequest)
+		return "", false
+	}
+	return value, true
+}
+
+// adminResetHandler removes a player's instance; the player gets fresh tables and flags on the next request
+func adminResetHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := adminAction(w, r, "key")
+	if !ok {
+		return
+	}
+	if !instances.reset(key) {
+		respondNotFound(w, r)
+		return
+	}
+	redirectAdmin(w, r)
+}
+
+// adminRevokeHandler deletes a session, logging its user out
+func adminRevokeHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := adminAction(w, r, "id")
+	if !ok {
+		return
+	}
+	if _, found := sessions.Get(id); !found {
+		respondNotFound(w, r)
+		return
+	}
+	if err := sessions.Delete(id); err != nil {
+		respondError(w, r, "Session Error", http.StatusInternalServerError)
+		return
+	}
+	redirectAdmin(w, r)
+}
+
+// redirectAdmin goes back to the dashboard after an action; JSON clients get no content
+func redirectAdmin(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusFound)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAdmin enables the admin area with fresh activity
+func useAdmin(t *testing.T) {
+	t.Helper()
+
+	prevPassword, prevActivity := adminPassword, activity
+	adminPassword, activity = "s3cret", &activityLog{}
+	t.Cleanup(func() { adminPassword, activity = prevPassword, prevActivity })
+}
+
+func newAdminRequest(t *testing.T, method, path string, form url.Values) *http.Request {
+	t.Helper()
+
+	req := newAPIRequest(t, method, path, "", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(adminUser, adminPassword)
+	return req
+}
+
+func TestAdminHandler(t *testing.T) {
+	t.Run("disabled without a password -> 404", func(t *testing.T) {
+		// Input: GET /admin with no admin password configured
+		rr := httptest.NewRecorder()
+		adminHandler(rr, newAPIRequest(t, http.MethodGet, "/admin", "", nil))
+
+		// Expected Output: The admin area does not exist
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("wrong credentials -> 401 with a basic challenge", func(t *testing.T) {
+		useAdmin(t)
+
+		// Input: GET /admin as a player and with a wrong password
+		for _, req := range []*http.Request{
+			newAPIRequest(t, http.MethodGet, "/admin", "kanmu", nil),
+			newAPIRequest(t, http.MethodGet, "/admin", "", nil),
+		} {
+			req.SetBasicAuth(adminUser, "wrong")
+			rr := httptest.NewRecorder()
+			adminHandler(rr, req)
+
+			// Expected Output: 401 asking for the admin credentials
+			if status := rr.Code; status != http.StatusUnauthorized {
+				t.Errorf("Expected status %v, got %v", http.StatusUnauthorized, status)
+			}
+			if !strings.HasPrefix(rr.Header().Get("WWW-Authenticate"), "Basic") {
+				t.Errorf("Expected a basic challenge, got %q", rr.Header().Get("WWW-Authenticate"))
+			}
+		}
+	})
+
+	t.Run("login attempts, solves and downloads are listed", func(t *testing.T) {
+		useAdmin(t)
+		useHints(t, time.Now())
+		login, _ := registry.Get(sqliLoginID)
+		board.record("kanmu", "kanmu", login, time.Now())
+
+		// Input: A SQL injection, a download and GET /admin
+		postLogin(t, "' OR 1=1 --", "x")
+		download := httptest.NewRecorder()
+		router.ServeHTTP(download, newAPIRequest(t, http.MethodGet, "/download/flag.zip", "kanmu", nil))
+		req := newAdminRequest(t, http.MethodGet, apiPrefix+"/admin", nil)
+		rr := httptest.NewRecorder()
+		adminHandler(rr, req)
+
+		// Expected Output: The SQL the login produced, the solve and the download
+		var data AdminData
+		decodeJSON(t, rr, &data)
+		if len(data.Logins) != 1 || data.Logins[0].Query != "SELECT username, password FROM users WHERE username='' OR 1=1 --' AND password='x'" ||
+			data.Logins[0].Result != loginDumpedUsers {
+			t.Errorf("Unexpected login attempts %+v", data.Logins)
+		}
+		if data.Solves[0].ID != sqliLoginID || len(data.Solves[0].Players) != 1 || data.Solves[0].Players[0] != "kanmu" {
+			t.Errorf("Unexpected solves %+v", data.Solves)
+		}
+		if len(data.Downloads) != 1 || data.Downloads[0].User != "kanmu" || data.Downloads[0].File != flagFilename {
+			t.Errorf("Unexpected downloads %+v", data.Downloads)
+		}
+	})
+
+	t.Run("HTML page escapes the injected SQL", func(t *testing.T) {
+		useAdmin(t)
+
+		// Input: A login with markup in the username
+		postLogin(t, "<script>alert(1)</script>", "x")
+		rr := httptest.NewRecorder()
+		adminHandler(rr, newAdminRequest(t, http.MethodGet, "/admin", nil))
+
+		// Expected Output: The attempt is shown as text
+		body := rr.Body.String()
+		if strings.Contains(body, "<script>alert(1)") || !strings.Contains(body, "&lt;script&gt;") {
+			t.Errorf("Expected the username to be escaped, got %s", body)
+		}
+	})
+}
+
+func TestAdminActions(t *testing.T) {
+	t.Run("reset instance", func(t *testing.T) {
+		useAdmin(t)
+		useUserData(t, userData)
+		if _, err := instances.get("player1", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: POST /admin/instances/reset
+		form := url.Values{"csrf_token": {adminCSRFToken()}, "key": {"player1"}}
+		rr := httptest.NewRecorder()
+		adminResetHandler(rr, newAdminRequest(t, http.MethodPost, "/admin/instances/reset", form))
+
+		// Expected Output: Back to /admin, the instance is gone
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		if _, ok := instances.lookup("player1"); ok {
+			t.Error("Expected the instance to be removed")
+		}
+	})
+
+	t.Run("revoke session", func(t *testing.T) {
+		useAdmin(t)
+		setMode(t, modeHardened)
+		s, token, err := createSession("kanmu")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: POST /admin/sessions/revoke
+		form := url.Values{"csrf_token": {adminCSRFToken()}, "id": {s.ID}}
+		rr := httptest.NewRecorder()
+		adminRevokeHandler(rr, newAdminRequest(t, http.MethodPost, "/admin/sessions/revoke", form))
+
+		// Expected Output: The session no longer logs kanmu in
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		if _, ok := lookupSession(token); ok {
+			t.Error("Expected the session to be revoked")
+		}
+	})
+
+	t.Run("missing CSRF token -> 403", func(t *testing.T) {
+		useAdmin(t)
+		useUserData(t, userData)
+		if _, err := instances.get("player1", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: A cross-site form post carrying the browser's basic credentials
+		form := url.Values{"key": {"player1"}}
+		rr := httptest.NewRecorder()
+		adminResetHandler(rr, newAdminRequest(t, http.MethodPost, "/admin/instances/reset", form))
+
+		// Expected Output: Rejected, the instance is kept
+		if status := rr.Code; status != http.StatusForbidden {
+			t.Errorf("Expected status %v, got %v", http.StatusForbidden, status)
+		}
+		if _, ok := instances.lookup("player1"); !ok {
+			t.Error("Expected the instance to be kept")
+		}
+	})
+
+	t.Run("unknown instance -> 404", func(t *testing.T) {
+		useAdmin(t)
+
+		// Input: Reset an instance that does not exist
+		form := url.Values{"csrf_token": {adminCSRFToken()}, "key": {"nope"}}
+		rr := httptest.NewRecorder()
+		adminResetHandler(rr, newAdminRequest(t, http.MethodPost, "/admin/instances/reset", form))
+
+		// Expected Output: Not found
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiPrefix is the path prefix of the JSON versions of the HTML pages
+const apiPrefix = "/api/v1"
+
+// wantsJSON reports whether the response should be JSON instead of HTML,
+// either because the request came in under /api/ or because its Accept header prefers JSON
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || prefersJSON(r.Header.Get("Accept"))
+}
+
+// prefersJSON reports whether an Accept header ranks application/json above text/html
+func prefersJSON(accept string) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = max(jsonQ, q)
+		case "text/html", "*/*":
+			htmlQ = max(htmlQ, q)
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+// pagePath returns the path of the HTML page a request is for, without the API prefix
+func pagePath(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, apiPrefix)
+}
+
+// respond writes data as JSON or renders it with the page template
+func respond(w http.ResponseWriter, r *http.Request, status int, templateName string, data any) {
+	if wantsJSON(r) {
+		writeJSON(w, status, data)
+		return
+	}
+	if err := renderTemplate(w, r, status, templateName, data); err != nil {
+		http.Error(w, "Template Error", http.StatusInternalServerError)
+	}
+}
+
+// respondError writes an error as a JSON error body or as plain text
+func respondError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, message)
+		return
+	}
+	http.Error(w, message, status)
+}
+
+// respondNotFound writes a JSON error or the not found page
+func respondNotFound(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	showNotFound(w, r)
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+type APIError struct {
+	Error string `json:"error"`
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, APIError{Error: message})
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPrefersJSON(t *testing.T) {
+	testCases := []struct {
+		accept   string
+		expected bool
+	}{
+		{"", false},
+		{"application/json", true},
+		{"text/html,application/xhtml+xml,*/*;q=0.8", false},
+		{"application/json, text/html;q=0.5", true},
+		{"text/html, application/json;q=0.9", false},
+		{"application/json;q=0", false},
+		{"*/*", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.accept, func(t *testing.T) {
+			// Input: Accept header
+			// Expected Output: Whether JSON is preferred over HTML
+			if got := prefersJSON(tc.accept); got != tc.expected {
+				t.Errorf("Expected %v, got %v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func newAPIRequest(t *testing.T, method, path, user string, body io.Reader) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(context.Background(), method, path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	return req
+}
+
+func decodeJSON(t *testing.T, rr *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Expected application/json, got %q: %s", ct, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDashboardAPI(t *testing.T) {
+	testCases := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"path", "/api/v1/dashboard", ""},
+		{"Accept header", "/dashboard", "application/json"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: GET the dashboard as JSON with kanmu cookie
+			req := newAPIRequest(t, http.MethodGet, tc.path, "kanmu", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(dashboardHandler).ServeHTTP(rr, req)
+
+			// Expected Output: DashboardData with recipes 2, 3, 5
+			if status := rr.Code; status != http.StatusOK {
+				t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+			}
+			var data DashboardData
+			decodeJSON(t, rr, &data)
+			if data.Title != "kanmuのダッシュボード" || len(data.Recipes) != 3 || data.Recipes[0].ID != 2 {
+				t.Errorf("Unexpected dashboard %+v", data)
+			}
+		})
+	}
+
+	t.Run("without authentication -> 401", func(t *testing.T) {
+		// Input: GET /api/v1/dashboard without cookies
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(dashboardHandler).ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/api/v1/dashboard", "", nil))
+
+		// Expected Output: 401 JSON error instead of a redirect
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Fatalf("Expected status %v, got %v", http.StatusUnauthorized, status)
+		}
+		var body APIError
+		decodeJSON(t, rr, &body)
+		if body.Error == "" {
+			t.Error("Expected error message")
+		}
+	})
+
+	t.Run("empty dashboard -> empty recipe list", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: GET /api/v1/dashboard as a user without recipes
+		req := newAPIRequest(t, http.MethodGet, "/api/v1/dashboard", "", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, "stranger")})
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(dashboardHandler).ServeHTTP(rr, req)
+
+		// Expected Output: "recipes": [] rather than null
+		if !strings.Contains(rr.Body.String(), `"recipes":[]`) {
+			t.Errorf("Expected empty recipes array, got %s", rr.Body.String())
+		}
+	})
+}
+
+func TestRecipeAPI(t *testing.T) {
+	t.Run("recipe 13 -> RecipeDetailData", func(t *testing.T) {
+		// Input: GET /api/v1/recipe/13 with admin cookie
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/api/v1/recipe/13", "admin", nil))
+
+		// Expected Output: Recipe detail with the download flag
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		var data RecipeDetailData
+		decodeJSON(t, rr, &data)
+		if data.ID != 13 || data.Name != "ステーキソース" || !data.ShowDownload || len(data.Steps) == 0 {
+			t.Errorf("Unexpected recipe %+v", data)
+		}
+	})
+
+	t.Run("not found -> JSON 404", func(t *testing.T) {
+		for _, path := range []string{"/api/v1/recipe/999", "/api/v1/recipe/abc"} {
+			// Input: GET a missing recipe
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, path, "admin", nil))
+
+			// Expected Output: 404 with a JSON error body
+			if status := rr.Code; status != http.StatusNotFound {
+				t.Errorf("%s: expected status %v, got %v", path, http.StatusNotFound, status)
+			}
+			var body APIError
+			decodeJSON(t, rr, &body)
+		}
+	})
+
+	t.Run("hardened mode hides other users' recipes", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: GET /api/v1/recipe/2 as admin
+		req := newAPIRequest(t, http.MethodGet, "/api/v1/recipe/2", "", nil)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, "admin")})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 404 like the HTML page
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+	})
+}
+
+func TestLoginAPI(t *testing.T) {
+	postLoginAPI := func(t *testing.T, body string, contentType string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newAPIRequest(t, http.MethodPost, "/api/v1/login", "", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(loginHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("valid JSON credentials -> user and cookie", func(t *testing.T) {
+		// Input: POST /api/v1/login with a JSON body
+		rr := postLoginAPI(t, `{"username":"kanmu","password":"gocon2025"}`, "application/json")
+
+		// Expected Output: 200 with the user and the login cookie
+		if status := rr.Code; status != http.StatusOK {
+			t.Fatalf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		var data LoginData
+		decodeJSON(t, rr, &data)
+		if data.User != "kanmu" {
+			t.Errorf("Expected user kanmu, got %+v", data)
+		}
+		found := false
+		for _, cookie := range rr.Result().Cookies() {
+			if cookie.Name == "user" && cookie.Value == "kanmu" {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Expected user cookie to be set")
+		}
+	})
+
+	t.Run("valid form credentials -> user", func(t *testing.T) {
+		// Input: POST /api/v1/login with a form body
+		form := url.Values{"username": {"admin"}, "password": {"Adm1n$ecur3"}}
+		rr := postLoginAPI(t, form.Encode(), "application/x-www-form-urlencoded")
+
+		// Expected Output: 200 with the user
+		var data LoginData
+		decodeJSON(t, rr, &data)
+		if rr.Code != http.StatusOK || data.User != "admin" {
+			t.Errorf("Expected admin login, got %v %+v", rr.Code, data)
+		}
+	})
+
+	t.Run("invalid credentials -> 401", func(t *testing.T) {
+		// Input: POST /api/v1/login with a wrong password
+		rr := postLoginAPI(t, `{"username":"kanmu","password":"wrong"}`, "application/json")
+
+		// Expected Output: 401 with the login error
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Fatalf("Expected status %v, got %v", http.StatusUnauthorized, status)
+		}
+		var data LoginData
+		decodeJSON(t, rr, &data)
+		if data.Error != "ユーザー名またはパスワードが間違っています" {
+			t.Errorf("Unexpected error %q", data.Error)
+		}
+	})
+
+	t.Run("malformed JSON -> 400", func(t *testing.T) {
+		// Input: POST /api/v1/login with broken JSON
+		rr := postLoginAPI(t, `{"username":`, "application/json")
+
+		// Expected Output: 400 JSON error
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("SQL injection -> every user, like the HTML page", func(t *testing.T) {
+		// Input: POST /api/v1/login with a SQL injection payload
+		rr := postLoginAPI(t, `{"username":"' OR 1=1 --","password":"x"}`, "application/json")
+
+		// Expected Output: The leaked users table as JSON
+		var data LoginData
+		decodeJSON(t, rr, &data)
+		if len(data.Users) < 2 {
+			t.Errorf("Expected every user to be returned, got %+v", data)
+		}
+	})
+
+	t.Run("GET -> method not allowed", func(t *testing.T) {
+		// Input: GET /api/v1/login
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/api/v1/login", "", nil))
+
+		// Expected Output: 405 with Allow header
+		if status := rr.Code; status != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %v, got %v", http.StatusMethodNotAllowed, status)
+		}
+		if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+			t.Errorf("Expected Allow POST, got %q", allow)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+// Package challenge defines the interface implemented by CTF stages and a registry
+// that decides which stages are served.
+package challenge
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Difficulty is the difficulty level of a challenge.
+type Difficulty int
+
+const (
+	Easy Difficulty = iota + 1
+	Medium
+	Hard
+)
+
+// String returns the display name of the difficulty.
+func (d Difficulty) String() string {
+	switch d {
+	case Easy:
+		return "Easy"
+	case Medium:
+		return "Medium"
+	case Hard:
+		return "Hard"
+	default:
+		return "Unknown"
+	}
+}
+
+// Points returns the score awarded for solving a challenge of this difficulty.
+func (d Difficulty) Points() int {
+	switch d {
+	case Easy, Medium, Hard:
+		return int(d) * 100
+	default:
+		return 0
+	}
+}
+
+// Route is an HTTP route served by a challenge.
+type Route struct {
+	// Pattern is an http.ServeMux pattern such as "GET /recipe/{id}". A GET
+	// route also serves HEAD.
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// Hint is a piece of help shown to players. A hint is released for free once
+// ReleaseAfter has passed since the event started, and can be unlocked
+// earlier by spending Cost points. A hint with neither is free at any time.
+type Hint struct {
+	Text string
+	// Cost is the number of points deducted from the player's score, or 0 if
+	// the hint cannot be bought.
+	Cost int
+	// ReleaseAfter is the time after the event start when the hint becomes
+	// free, or 0 if it is never released.
+	ReleaseAfter time.Duration
+}
+
+// Challenge is a single CTF stage.
+type Challenge interface {
+	// ID returns a unique, URL-safe identifier used in configuration.
+	ID() string
+	// Name returns the display name.
+	Name() string
+	// Difficulty returns the difficulty level.
+	Difficulty() Difficulty
+	// Routes returns the HTTP routes the challenge serves.
+	Routes() []Route
+	// Assets returns static files served under /challenges/{id}/, or nil.
+	Assets() fs.FS
+	// FlagDigest returns the hex encoded SHA-256 digest of the flag, or "" if
+	// the challenge has no flag to submit.
+	FlagDigest() string
+	// Hints returns the hints for the challenge.
+	Hints() []Hint
+}
+
+var (
+	// ErrDuplicateID is returned when a challenge ID is registered twice.
+	ErrDuplicateID = errors.New("challenge: duplicate id")
+	// ErrUnknownID is returned when an unregistered challenge ID is enabled.
+	ErrUnknownID = errors.New("challenge: unknown id")
+)
+
+// Registry holds the registered challenges in registration order.
+type Registry struct {
+	mu         sync.RWMutex
+	order      []string
+	challenges map[string]Challenge
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{challenges: make(map[string]Challenge)}
+}
+
+// Register adds a challenge to the registry.
+func (r *Registry) Register(c Challenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.challenges[c.ID()]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateID, c.ID())
+	}
+	r.challenges[c.ID()] = c
+	r.order = append(r.order, c.ID())
+	return nil
+}
+
+// Get returns the challenge with the given ID.
+func (r *Registry) Get(id string) (Challenge, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.challenges[id]
+	return c, ok
+}
+
+// All returns every registered challenge in registration order.
+func (r *Registry) All() []Challenge {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]Challenge, 0, len(r.order))
+	for _, id := range r.order {
+		all = append(all, r.challenges[id])
+	}
+	return all
+}
+
+// Enabled returns the challenges with the given IDs in registration order.
+// An empty list enables every registered challenge.
+func (r *Registry) Enabled(ids []string) ([]Challenge, error) {
+	if len(ids) == 0 {
+		return r.All(), nil
+	}
+
+	want := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if _, ok := r.Get(id); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownID, id)
+		}
+		want[id] = true
+	}
+
+	var enabled []Challenge
+	for _, c := range r.All() {
+		if want[c.ID()] {
+			enabled = append(enabled, c)
+		}
+	}
+	return enabled, nil
+}
+
+// Mount registers the routes and assets of the challenges on mux.
+func Mount(mux *http.ServeMux, challenges []Challenge) {
+	for _, c := range challenges {
+		for _, route := range c.Routes() {
+			mux.HandleFunc(route.Pattern, route.Handler)
+		}
+		if assets := c.Assets(); assets != nil {
+			prefix := "/challenges/" + c.ID() + "/"
+			mux.Handle("GET "+prefix, http.StripPrefix(prefix, http.FileServerFS(assets)))
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+type fakeChallenge struct {
+	id     string
+	routes []Route
+	assets fs.FS
+}
+
+func (f fakeChallenge) ID() string             { return f.id }
+func (f fakeChallenge) Name() string           { return f.id }
+func (f fakeChallenge) Difficulty() Difficulty { return Easy }
+func (f fakeChallenge) Routes() []Route        { return f.routes }
+func (f fakeChallenge) Assets() fs.FS          { return f.assets }
+func (f fakeChallenge) FlagDigest() string     { return "" }
+func (f fakeChallenge) Hints() []Hint          { return nil }
+
+func TestRegistry(t *testing.T) {
+	t.Run("register and list in order", func(t *testing.T) {
+		// Input: Three challenges registered
+		r := NewRegistry()
+		for _, id := range []string{"b", "a", "c"} {
+			if err := r.Register(fakeChallenge{id: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Expected Output: All returns registration order
+		all := r.All()
+		expected := []string{"b", "a", "c"}
+		for i, id := range expected {
+			if all[i].ID() != id {
+				t.Errorf("Expected %s at %d, got %s", id, i, all[i].ID())
+			}
+		}
+	})
+
+	t.Run("duplicate id -> error", func(t *testing.T) {
+		// Input: Same ID registered twice
+		r := NewRegistry()
+		if err := r.Register(fakeChallenge{id: "a"}); err != nil {
+			t.Fatal(err)
+		}
+		err := r.Register(fakeChallenge{id: "a"})
+
+		// Expected Output: ErrDuplicateID
+		if !errors.Is(err, ErrDuplicateID) {
+			t.Errorf("Expected ErrDuplicateID, got %v", err)
+		}
+	})
+
+	t.Run("enabled subset and unknown id", func(t *testing.T) {
+		// Input: Registry with a, b, c
+		r := NewRegistry()
+		for _, id := range []string{"a", "b", "c"} {
+			if err := r.Register(fakeChallenge{id: id}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Expected Output: Subset in registration order, all when empty, error when unknown
+		enabled, err := r.Enabled([]string{"c", "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(enabled) != 2 || enabled[0].ID() != "a" || enabled[1].ID() != "c" {
+			t.Errorf("Expected [a c], got %v", enabled)
+		}
+
+		all, err := r.Enabled(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(all) != 3 {
+			t.Errorf("Expected all 3 challenges, got %d", len(all))
+		}
+
+		if _, err := r.Enabled([]string{"missing"}); !errors.Is(err, ErrUnknownID) {
+			t.Errorf("Expected ErrUnknownID, got %v", err)
+		}
+	})
+}
+
+func TestMount(t *testing.T) {
+	t.Run("routes and assets are served", func(t *testing.T) {
+		// Input: Challenge with one route and one asset
+		c := fakeChallenge{
+			id: "demo",
+			routes: []Route{{Pattern: "/demo", Handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}}},
+			assets: fstest.MapFS{"hello.txt": {Data: []byte("hello")}},
+		}
+		mux := http.NewServeMux()
+		Mount(mux, []Challenge{c})
+
+		// Expected Output: Route handler and asset file respond
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/demo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusTeapot {
+			t.Errorf("Expected status %v, got %v", http.StatusTeapot, rr.Code)
+		}
+
+		req, err = http.NewRequestWithContext(context.Background(), http.MethodGet, "/challenges/demo/hello.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Body.String() != "hello" {
+			t.Errorf("Expected asset body, got %q", rr.Body.String())
+		}
+
+		req, err = http.NewRequestWithContext(context.Background(), http.MethodPost, "/challenges/demo/hello.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr = httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected assets to be read only, got status %v", rr.Code)
+		}
+	})
+}
+
+func TestDifficulty(t *testing.T) {
+	// Input: Each difficulty level
+	// Expected Output: Names and increasing points
+	testCases := []struct {
+		d      Difficulty
+		name   string
+		points int
+	}{
+		{Easy, "Easy", 100},
+		{Medium, "Medium", 200},
+		{Hard, "Hard", 300},
+		{Difficulty(0), "Unknown", 0},
+	}
+	for _, tc := range testCases {
+		if tc.d.String() != tc.name || tc.d.Points() != tc.points {
+			t.Errorf("Expected %s/%d, got %s/%d", tc.name, tc.points, tc.d.String(), tc.d.Points())
+		}
+	}
+}
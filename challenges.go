@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+// Challenge IDs of the built-in recipe site stages
+const (
+	sqliLoginID   = "sqli-login"
+	recipeIDORID  = "recipe-idor"
+	ingredientsID = "ingredients-zip"
+)
+
+// stage is a built-in challenge served from this package
+type stage struct {
+	id         string
+	name       string
+	difficulty challenge.Difficulty
+	hints      []challenge.Hint
+	flagDigest func() string
+}
+
+func (s *stage) ID() string                       { return s.id }
+func (s *stage) Name() string                     { return s.name }
+func (s *stage) Difficulty() challenge.Difficulty { return s.difficulty }
+func (s *stage) Routes() []challenge.Route        { return nil }
+func (s *stage) Assets() fs.FS                    { return nil }
+func (s *stage) Hints() []challenge.Hint          { return s.hints }
+
+func (s *stage) FlagDigest() string {
+	if s.flagDigest == nil {
+		return ""
+	}
+	return s.flagDigest()
+}
+
+// builtinChallenges returns the stages of the recipe site CTF.
+// The stages are played on the pages of the site, which newRouter serves whichever stages are enabled;
+// disabling a stage only switches off its vulnerability.
+// Their hints have no text, which would give the answers away to anyone reading the repository: the organizers supply it with CTF_HINTS.
+func builtinChallenges() []challenge.Challenge {
+	return []challenge.Challenge{
+		&stage{
+			id:         sqliLoginID,
+			name:       "レシピサイトにログイン",
+			difficulty: challenge.Easy,
+			hints: []challenge.Hint{
+				{ReleaseAfter: 15 * time.Minute},
+			},
+		},
+		&stage{
+			id:         recipeIDORID,
+			name:       "隠されたレシピを探せ",
+			difficulty: challenge.Medium,
+			hints: []challenge.Hint{
+				{Cost: 50, ReleaseAfter: time.Hour},
+			},
+		},
+		&stage{
+			id:         ingredientsID,
+			name:       "食材リストを開封せよ",
+			difficulty: challenge.Hard,
+			hints: []challenge.Hint{
+				{Cost: 50, ReleaseAfter: time.Hour},
+				{Cost: 100, ReleaseAfter: 2 * time.Hour},
+			},
+			flagDigest: func() string { return flagDigest },
+		},
+	}
+}
+
+// challengeName returns the name of c in lang. Challenges missing from the catalog keep their own name.
+func challengeName(lang string, c challenge.Challenge) string {
+	if name, ok := lookupMessage(lang, "challenge."+c.ID()); ok {
+		return name
+	}
+	return c.Name()
+}
+
+// newRegistry returns a registry holding the built-in challenges
+func newRegistry() *challenge.Registry {
+	registry := challenge.NewRegistry()
+	for _, c := range builtinChallenges() {
+		if err := registry.Register(c); err != nil {
+			panic(err)
+		}
+	}
+	return registry
+}
+
+var registry = newRegistry()
+
+// enabledChallenges are the challenges served by this instance, set by main from CTF_CHALLENGES
+var enabledChallenges []challenge.Challenge
+
+func init() {
+	enabledChallenges = registry.All()
+}
+
+// vulnerable reports whether the vulnerability of the challenge is served:
+// the site runs in vulnerable mode and the challenge is enabled
+func vulnerable(id string) bool {
+	if mode.hardened() {
+		return false
+	}
+	_, ok := enabledChallenge(id)
+	return ok
+}
+
+// ingredientsEnabled reports whether flag.zip is attached to the steak sauce recipe
+func ingredientsEnabled() bool {
+	_, ok := enabledChallenge(ingredientsID)
+	return ok
+}
+
+// splitList splits a comma separated configuration value
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
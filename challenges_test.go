@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBuiltinChallenges(t *testing.T) {
+	t.Run("all stages registered", func(t *testing.T) {
+		useFlag(t)
+
+		// Input: Built-in registry with a configured flag
+		// Expected Output: Each stage is registered, only the ingredients stage has a flag
+		for _, id := range []string{sqliLoginID, recipeIDORID, ingredientsID} {
+			c, ok := registry.Get(id)
+			if !ok {
+				t.Errorf("Expected challenge %s to be registered", id)
+				continue
+			}
+			if (c.FlagDigest() != "") != (id == ingredientsID) {
+				t.Errorf("Unexpected flag digest for %s: %q", id, c.FlagDigest())
+			}
+		}
+	})
+
+	t.Run("enable from configuration list", func(t *testing.T) {
+		// Input: Comma separated challenge IDs with spaces
+		enabled, err := registry.Enabled(splitList(" recipe-idor, ,sqli-login "))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Two challenges in registration order
+		if len(enabled) != 2 || enabled[0].ID() != sqliLoginID || enabled[1].ID() != recipeIDORID {
+			t.Errorf("Unexpected enabled challenges: %v", enabled)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nao1215/filesql"
+)
+
+const (
+	// tableDatabasePoolSize is the number of copies of the tables a database keeps, and so of the queries it runs at once
+	tableDatabasePoolSize = 4
+	// tableQueryTimeout bounds a query, including the wait for a free copy, so an expensive injected query
+	// such as an endless WITH RECURSIVE cannot hold a copy for long
+	tableQueryTimeout = 2 * time.Second
+	// tableCleanupTimeout bounds the rollback and the change check after a query, which run even when it timed out
+	tableCleanupTimeout = time.Second
+)
+
+var errDatabaseClosed = errors.New("table database is closed")
+
+// tableDatabase is a long-lived in-memory database of CSV tables.
+// The login query is injectable and SQLite runs stacked statements, so every query must see the
+// original data: when a query changes the rows or the schema, the tables are loaded again.
+// Each filesql database is a single in-memory connection, so the database keeps a pool of copies
+// and a query takes one for itself instead of locking the others out.
+type tableDatabase struct {
+	tables map[string][]byte
+
+	idle chan *sql.DB
+	// mu guards the number of copies opened and whether the database is closed
+	mu     sync.Mutex
+	opened int
+	closed bool
+}
+
+// openTableDatabase loads tables, CSV data keyed by table name, into a new in-memory database
+func openTableDatabase(ctx context.Context, tables map[string][]byte) (*tableDatabase, error) {
+	db, err := loadTables(ctx, tables)
+	if err != nil {
+		return nil, err
+	}
+	d := &tableDatabase{tables: tables, idle: make(chan *sql.DB, tableDatabasePoolSize), opened: 1}
+	d.idle <- db
+	return d, nil
+}
+
+func loadTables(ctx context.Context, tables map[string][]byte) (*sql.DB, error) {
+	defer func(start time.Time) { tableLoadDuration.observe(time.Since(start)) }(time.Now())
+
+	builder := filesql.NewBuilder()
+	for name, data := range tables {
+		builder.AddReader(bytes.NewReader(data), name, filesql.FileTypeCSV)
+	}
+	validated, err := builder.Build(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db, err := validated.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// filesql hands database/sql a single in-memory connection; a second one would share it
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	return db, nil
+}
+
+// Close closes the idle copies of the tables. The copies in use are closed when their queries return.
+func (d *tableDatabase) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+	var errs []error
+	for {
+		select {
+		case db := <-d.idle:
+			errs = append(errs, db.Close())
+		default:
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// take returns an idle copy of the tables, loading a new one while the pool is not full, or waits for one until ctx is done
+func (d *tableDatabase) take(ctx context.Context) (*sql.DB, error) {
+	select {
+	case db := <-d.idle:
+		return db, nil
+	default:
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil, errDatabaseClosed
+	}
+	if d.opened < tableDatabasePoolSize {
+		d.opened++
+		d.mu.Unlock()
+		db, err := loadTables(ctx, d.tables)
+		if err != nil {
+			d.mu.Lock()
+			d.opened--
+			d.mu.Unlock()
+			return nil, err
+		}
+		return db, nil
+	}
+	d.mu.Unlock()
+
+	select {
+	case db := <-d.idle:
+		return db, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put returns a copy of the tables to the pool, or closes it when the database was closed meanwhile
+func (d *tableDatabase) put(db *sql.DB) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		_ = db.Close()
+		return
+	}
+	d.idle <- db
+}
+
+// query runs fn on a copy of the tables within tableQueryTimeout and reloads that copy if fn changed it.
+// fn must use the ctx it is given, which carries the deadline.
+func (d *tableDatabase) query(ctx context.Context, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx, cancel := context.WithTimeout(ctx, tableQueryTimeout)
+	defer cancel()
+
+	db, err := d.take(ctx)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		d.put(db)
+		return err
+	}
+	before, err := changes(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		d.put(db)
+		return err
+	}
+	queryErr := fn(ctx, conn)
+
+	cleanup, cancelCleanup := context.WithTimeout(context.WithoutCancel(ctx), tableCleanupTimeout)
+	defer cancelCleanup()
+	// An injected BEGIN would otherwise leave a transaction open for the next request
+	_, _ = conn.ExecContext(cleanup, "ROLLBACK")
+	after, err := changes(cleanup, conn)
+	_ = conn.Close()
+	if err == nil && after == before {
+		d.put(db)
+		return queryErr
+	}
+
+	_ = db.Close()
+	reloaded, err := loadTables(context.WithoutCancel(ctx), d.tables)
+	if err != nil {
+		d.mu.Lock()
+		d.opened--
+		d.mu.Unlock()
+		return errors.Join(queryErr, err)
+	}
+	d.put(reloaded)
+	return queryErr
+}
+
+// changes returns the number of rows changed on the connection and the schema version, which DDL increments
+func changes(ctx context.Context, conn *sql.Conn) ([2]int64, error) {
+	var n [2]int64
+	err := conn.QueryRowContext(ctx, "SELECT total_changes(), schema_version FROM pragma_schema_version").Scan(&n[0], &n[1])
+	return n, err
+}
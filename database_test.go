@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nao1215/filesql"
+)
+
+func newTableDatabase(tb testing.TB) *tableDatabase {
+	tb.Helper()
+
+	d, err := openTableDatabase(context.Background(), map[string][]byte{usersTableName: usersCSV})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = d.Close() })
+	return d
+}
+
+func countUsers(t *testing.T, d *tableDatabase) int {
+	t.Helper()
+
+	var n int
+	err := d.query(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+		return conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&n)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTableDatabase(t *testing.T) {
+	testCases := []struct {
+		name     string
+		username string
+	}{
+		{"DROP TABLE", "'; DROP TABLE users; --"},
+		{"DELETE", "'; DELETE FROM users; --"},
+		{"UPDATE", "'; UPDATE users SET password = 'pwned'; --"},
+		{"INSERT", "'; INSERT INTO users VALUES ('evil', 'evil'); --"},
+		{"COMMIT then DELETE", "'; COMMIT; DELETE FROM users; --"},
+		{"open transaction", "'; BEGIN; DELETE FROM users; --"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newTableDatabase(t)
+			expected := countUsers(t, d)
+
+			// Input: Stacked statements injected into the login query
+			_ = d.query(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+				rows, err := findUsers(ctx, conn, tc.username, "x")
+				if err != nil {
+					return err
+				}
+				return rows.Close()
+			})
+
+			// Expected Output: The next query sees the original table
+			if n := countUsers(t, d); n != expected {
+				t.Errorf("Expected %d users, got %d", expected, n)
+			}
+			var password string
+			err := d.query(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+				return conn.QueryRowContext(ctx, "SELECT password FROM users WHERE username = 'kanmu'").Scan(&password)
+			})
+			if err != nil || password != "gocon2025" {
+				t.Errorf("Expected kanmu's password to be unchanged, got %q %v", password, err)
+			}
+		})
+	}
+
+	t.Run("players share one database without random flags", func(t *testing.T) {
+		useUserData(t, userData)
+
+		// Input: Two players, the first one drops the users table
+		postLogin(t, "'; DROP TABLE users; --", "x")
+		rr := postLogin(t, "kanmu", "gocon2025")
+
+		// Expected Output: One database loaded once, and the second player can still log in
+		a, err := instances.get("a", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := instances.get("b", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.db != b.db || a.db != instances.shared {
+			t.Error("Expected instances to share the database")
+		}
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+}
+
+// BenchmarkLoginQuery compares the original per-login cycle, which wrote the users CSV to a temporary
+// file and loaded it with filesql for every POST /login, with the long-lived database
+func BenchmarkLoginQuery(b *testing.B) {
+	ctx := context.Background()
+	query := fmt.Sprintf("SELECT username, password FROM users WHERE username='%s' AND password='%s'", "kanmu", "gocon2025")
+
+	perLogin := func(dir string) error {
+		tmpFile := filepath.Join(dir, usersTableName+".csv")
+		if err := os.WriteFile(tmpFile, usersCSV, 0o600); err != nil {
+			return err
+		}
+		db, err := filesql.Open(tmpFile)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = db.Close()
+			_ = os.Remove(tmpFile)
+		}()
+
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+		}
+		return rows.Close()
+	}
+
+	longLived := func(d *tableDatabase) error {
+		return d.query(ctx, func(ctx context.Context, conn *sql.Conn) error {
+			rows, err := conn.QueryContext(ctx, query)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+			}
+			return rows.Close()
+		})
+	}
+
+	b.Run("temp file per login", func(b *testing.B) {
+		dir := b.TempDir()
+		for b.Loop() {
+			if err := perLogin(dir); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("temp file per login parallel", func(b *testing.B) {
+		root := b.TempDir()
+		b.RunParallel(func(pb *testing.PB) {
+			// Each goroutine needs its own file, otherwise the cycle races like it did on /tmp/users.csv
+			dir, err := os.MkdirTemp(root, "")
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			for pb.Next() {
+				if err := perLogin(dir); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+
+	b.Run("long-lived database", func(b *testing.B) {
+		d := newTableDatabase(b)
+		for b.Loop() {
+			if err := longLived(d); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("long-lived database parallel", func(b *testing.B) {
+		d := newTableDatabase(b)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if err := longLived(d); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
+
+func TestTableDatabaseLimits(t *testing.T) {
+	t.Run("endless recursive query -> rows capped", func(t *testing.T) {
+		useUserData(t, userData)
+
+		// Input: A login injecting a recursive query that never stops producing rows
+		db, err := instances.sharedDatabase()
+		if err != nil {
+			t.Fatal(err)
+		}
+		users, err := queryUsers(context.Background(), db, "' UNION ALL SELECT * FROM (WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT i, i FROM n) --", "x")
+
+		// Expected Output: At most maxLoginRows users
+		if err != nil || len(users) != maxLoginRows {
+			t.Errorf("Expected %d users, got %d %v", maxLoginRows, len(users), err)
+		}
+	})
+
+	t.Run("slow query -> deadline, other queries go on", func(t *testing.T) {
+		d := newTableDatabase(t)
+		slow := "SELECT COUNT(*) FROM (WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n) SELECT i FROM n)"
+
+		// Input: A query that would never finish, and a login running meanwhile
+		done := make(chan error, 1)
+		start := time.Now()
+		go func() {
+			done <- d.query(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+				var n int
+				return conn.QueryRowContext(ctx, slow).Scan(&n)
+			})
+		}()
+		time.Sleep(50 * time.Millisecond)
+		n := countUsers(t, d)
+
+		// Expected Output: The login is answered at once, the slow query is stopped at the deadline
+		if n == 0 || time.Since(start) > tableQueryTimeout/2 {
+			t.Errorf("Expected the other query to run while the slow one does, got %d users after %v", n, time.Since(start))
+		}
+		if err := <-done; err == nil || time.Since(start) > tableQueryTimeout+time.Second {
+			t.Errorf("Expected the slow query to be stopped at the deadline, got %v after %v", err, time.Since(start))
+		}
+	})
+}
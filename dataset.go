@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nao1215/filesql"
+)
+
+// usersTableName is the table read by the login query
+const usersTableName = "users"
+
+var errNoTables = errors.New("no supported tables found")
+
+// dataset holds the tables copied into every instance, keyed by table name.
+// Each table is a header row followed by the data rows.
+type dataset map[string][][]string
+
+// userData is the dataset of every new instance. CTF_USERS_DATA replaces it; the default is the embedded users CSV.
+var userData = embeddedDataset()
+
+func embeddedDataset() dataset {
+	records, err := csv.NewReader(bytes.NewReader(usersCSV)).ReadAll()
+	if err != nil {
+		panic(err)
+	}
+	return dataset{usersTableName: records}
+}
+
+// compressionExts are the compressed variants filesql reads
+var compressionExts = []string{".gz", ".bz2", ".xz", ".zst"}
+
+// datasetFormat returns the format of a data file from its extension, ignoring any compression extension,
+// or "" when the file is not supported
+func datasetFormat(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	compressed := false
+	for _, ext := range compressionExts {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			compressed = true
+			break
+		}
+	}
+
+	switch ext := filepath.Ext(name); ext {
+	case ".csv", ".tsv", ".ltsv", ".parquet", ".xlsx":
+		return ext
+	case ".json", ".db", ".sqlite", ".sqlite3":
+		if compressed {
+			return ""
+		}
+		return ext
+	default:
+		return ""
+	}
+}
+
+// datasetTableName derives a table name from a file name: users.tsv.gz becomes users
+func datasetTableName(path string) string {
+	name := filepath.Base(path)
+	for _, ext := range compressionExts {
+		if strings.HasSuffix(strings.ToLower(name), ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+	return sanitizeTableName(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// sanitizeTableName replaces characters other than letters, digits and _ with _, so table names never need quoting
+func sanitizeTableName(name string) string {
+	sanitized := []byte(name)
+	for i, c := range sanitized {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			sanitized[i] = '_'
+		}
+	}
+	if len(sanitized) == 0 || (sanitized[0] >= '0' && sanitized[0] <= '9') {
+		sanitized = append([]byte("t_"), sanitized...)
+	}
+	return string(sanitized)
+}
+
+// loadDataset reads the tables of a data file or of every supported file in a directory.
+// A file holding a single table is named after the file; Excel workbooks with several sheets
+// give one <file>_<sheet> table per sheet and SQLite databases keep their table names.
+// The embedded users table is kept unless the data provides its own.
+func loadDataset(ctx context.Context, path string) (dataset, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && datasetFormat(entry.Name()) != "" {
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	} else {
+		if datasetFormat(path) == "" {
+			return nil, fmt.Errorf("%s: unsupported file format", path)
+		}
+		files = []string{path}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, errNoTables)
+	}
+
+	data := dataset{}
+	for _, file := range files {
+		tables, err := readDataFile(ctx, file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for name, records := range tables {
+			if _, ok := data[name]; ok {
+				return nil, fmt.Errorf("%s: duplicate table %s", file, name)
+			}
+			data[name] = records
+		}
+	}
+	if _, ok := data[usersTableName]; !ok {
+		data[usersTableName] = embeddedDataset()[usersTableName]
+	}
+	if err := data.validate(); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// validate checks that the users table has the columns the login query selects
+func (d dataset) validate() error {
+	for _, column := range []string{"username", "password"} {
+		if d.column(usersTableName, column) < 0 {
+			return fmt.Errorf("table %s has no %s column", usersTableName, column)
+		}
+	}
+	return nil
+}
+
+// column returns the index of a column of table, or -1
+func (d dataset) column(table, name string) int {
+	records := d[table]
+	if len(records) == 0 {
+		return -1
+	}
+	return slices.Index(records[0], name)
+}
+
+// tableNames returns the table names in a stable order
+func (d dataset) tableNames() []string {
+	return slices.Sorted(maps.Keys(d))
+}
+
+// readDataFile reads every table of one data file
+func readDataFile(ctx context.Context, path string) (dataset, error) {
+	switch datasetFormat(path) {
+	case ".json":
+		records, err := readJSONTable(path)
+		if err != nil {
+			return nil, err
+		}
+		return dataset{datasetTableName(path): records}, nil
+	case ".db", ".sqlite", ".sqlite3":
+		db, err := sql.Open("sqlite", path)
+		if err != nil {
+			return nil, err
+		}
+		defer db.Close()
+		return dumpTables(ctx, db)
+	}
+
+	db, err := filesql.OpenContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	tables, err := dumpTables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	// filesql names Excel sheets <file>_<sheet>; a single table is named after the file whatever the format
+	if len(tables) == 1 {
+		for _, records := range tables {
+			return dataset{datasetTableName(path): records}, nil
+		}
+	}
+	return tables, nil
+}
+
+// dumpTables reads every table of db as text
+func dumpTables(ctx context.Context, db *sql.DB) (dataset, error) {
+	rows, err := db.QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errNoTables
+	}
+
+	tables := dataset{}
+	for _, name := range names {
+		records, err := dumpTable(ctx, db, name)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", name, err)
+		}
+		tables[sanitizeTableName(name)] = records
+	}
+	return tables, nil
+}
+
+func dumpTable(ctx context.Context, db *sql.DB, name string) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT * FROM "`+strings.ReplaceAll(name, `"`, `""`)+`"`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	records := [][]string{columns}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		record := make([]string, len(values))
+		for i, value := range values {
+			record[i] = formatValue(value)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// readJSONTable reads a JSON array of objects. Columns appear in the order their keys are first seen;
+// values that are not strings are kept as JSON text.
+func readJSONTable(path string) ([][]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var objects []json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	var rows []map[string]string
+	for _, object := range objects {
+		keys, row, err := decodeJSONObject(object)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if !slices.Contains(columns, key) {
+				columns = append(columns, key)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(columns) == 0 {
+		return nil, errNoTables
+	}
+
+	records := [][]string{columns}
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// decodeJSONObject returns the keys of a JSON object in document order and its values as text
+func decodeJSONObject(object json.RawMessage) ([]string, map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, nil, errors.New("expected an array of objects")
+	}
+
+	var keys []string
+	row := map[string]string{}
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		var s string
+		switch {
+		case json.Unmarshal(value, &s) == nil:
+		case string(value) == "null":
+		default:
+			s = string(value)
+		}
+		keys = append(keys, key)
+		row[key] = s
+	}
+	return keys, row, nil
+}
+
+// encodeCSV encodes records as CSV
+func encodeCSV(records [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
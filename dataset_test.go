@@ -0,0 +1,286 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// useUserData replaces the dataset and starts a fresh instance manager, whose shared database is loaded from it
+func useUserData(t *testing.T, data dataset) {
+	t.Helper()
+
+	prev, prevInstances := userData, instances
+	userData, instances = data, newInstanceManager(time.Hour)
+	t.Cleanup(func() {
+		instances.closeAll()
+		userData, instances = prev, prevInstances
+	})
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeGzipFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeSQLiteFile(t *testing.T, path string, statements ...string) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		if _, err := db.ExecContext(context.Background(), statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func writeXLSXFile(t *testing.T, path string, sheets map[string][][]string) {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+	for _, name := range slices.Sorted(maps.Keys(sheets)) {
+		if _, err := f.NewSheet(name); err != nil {
+			t.Fatal(err)
+		}
+		for i, row := range sheets[name] {
+			cell, err := excelize.CoordinatesToCellName(1, i+1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := f.SetSheetRow(name, cell, &row); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatasetTableName(t *testing.T) {
+	testCases := []struct {
+		path     string
+		expected string
+	}{
+		{"users.csv", "users"},
+		{"data/users.tsv.gz", "users"},
+		{"secrets.ltsv.zst", "secrets"},
+		{"Users.XLSX", "Users"},
+		{"users.json", "users"},
+		{"secret-notes v2.csv", "secret_notes_v2"},
+		{"2025.csv", "t_2025"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			// Input: Data file path
+			// Expected Output: Table name without format and compression extensions
+			if got := datasetTableName(tc.path); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("directory of tables in every format", func(t *testing.T) {
+		dir := t.TempDir()
+		writeFile(t, filepath.Join(dir, "users.tsv"), "id\tusername\tpassword\n1\talice\tpassword123\n2\tzip\tqwerty\n")
+		writeGzipFile(t, filepath.Join(dir, "secrets.csv.gz"), "name,secret\nvault,gocon2025{hidden}\n")
+		writeFile(t, filepath.Join(dir, "notes.json"), `[{"title":"memo","body":"hello","pinned":true},{"title":"todo","tags":["a"]}]`)
+		writeSQLiteFile(t, filepath.Join(dir, "legacy.db"), "CREATE TABLE audit (who TEXT, at INTEGER)", "INSERT INTO audit VALUES ('admin', 1700000000)")
+		writeXLSXFile(t, filepath.Join(dir, "staff.xlsx"), map[string][][]string{"roster": {{"name", "role"}, {"kanmu", "chef"}}})
+		writeFile(t, filepath.Join(dir, "README.txt"), "ignored")
+
+		// Input: Load the directory
+		data, err := loadDataset(ctx, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: One table per file, named consistently whatever the format
+		expected := []string{"audit", "notes", "secrets", "staff", "users"}
+		if names := data.tableNames(); !slices.Equal(names, expected) {
+			t.Fatalf("Expected tables %q, got %q", expected, names)
+		}
+		if !slices.Equal(data["users"][0], []string{"id", "username", "password"}) || data["users"][1][1] != "alice" {
+			t.Errorf("Unexpected users table %q", data["users"])
+		}
+		if data["secrets"][1][1] != "gocon2025{hidden}" {
+			t.Errorf("Unexpected secrets table %q", data["secrets"])
+		}
+		if !slices.Equal(data["notes"][0], []string{"title", "body", "pinned", "tags"}) ||
+			!slices.Equal(data["notes"][1], []string{"memo", "hello", "true", ""}) ||
+			data["notes"][2][3] != `["a"]` {
+			t.Errorf("Unexpected notes table %q", data["notes"])
+		}
+		if !slices.Equal(data["audit"][1], []string{"admin", "1700000000"}) {
+			t.Errorf("Unexpected audit table %q", data["audit"])
+		}
+		if !slices.Equal(data["staff"][1], []string{"kanmu", "chef"}) {
+			t.Errorf("Unexpected staff table %q", data["staff"])
+		}
+	})
+
+	t.Run("workbook with several sheets -> table per sheet", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "book.xlsx")
+		writeXLSXFile(t, path, map[string][][]string{
+			"users":   {{"username", "password"}, {"bob", "secret"}},
+			"secrets": {{"secret"}, {"s3cr3t"}},
+		})
+
+		// Input: Load a single workbook
+		data, err := loadDataset(ctx, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: <file>_<sheet> tables plus the embedded users table
+		expected := []string{"book_secrets", "book_users", "users"}
+		if names := data.tableNames(); !slices.Equal(names, expected) {
+			t.Errorf("Expected tables %q, got %q", expected, names)
+		}
+		if !slices.EqualFunc(data["users"], userData["users"], slices.Equal[[]string]) {
+			t.Errorf("Expected the embedded users table")
+		}
+	})
+
+	t.Run("invalid data -> error", func(t *testing.T) {
+		testCases := []struct {
+			name  string
+			files map[string]string
+		}{
+			{"users without password column", map[string]string{"users.csv": "username,pass\nalice,x\n"}},
+			{"duplicate table", map[string]string{"users.csv": "username,password\n", "users.tsv": "username\tpassword\n"}},
+			{"no supported files", map[string]string{"README.txt": "nothing"}},
+			{"JSON that is not an array of objects", map[string]string{"notes.json": `[1, 2]`}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				dir := t.TempDir()
+				for name, content := range tc.files {
+					writeFile(t, filepath.Join(dir, name), content)
+				}
+
+				// Input: Load the directory
+				_, err := loadDataset(ctx, dir)
+
+				// Expected Output: The data is rejected at startup
+				if err == nil {
+					t.Error("Expected an error")
+				}
+			})
+		}
+	})
+}
+
+func TestInstanceDataset(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "users.tsv"), "id\tusername\tpassword\n1\talice\tpassword123\n2\tzip\tqwerty\n")
+	writeFile(t, filepath.Join(dir, "secrets.csv"), "name,secret\nvault,gocon2025{hidden}\nbackup,gocon2025{backup}\n")
+	data, err := loadDataset(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	useUserData(t, data)
+
+	t.Run("login uses the external users table", func(t *testing.T) {
+		// Input: Credentials from users.tsv
+		rr := postLogin(t, "alice", "password123")
+
+		// Expected Output: Logged in, while the embedded users are gone
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		if status := postLogin(t, "kanmu", "gocon2025").Code; status != http.StatusOK {
+			t.Errorf("Expected embedded user to be rejected, got status %v", status)
+		}
+	})
+
+	t.Run("SQL injection reaches the hidden table", func(t *testing.T) {
+		// Input: UNION SELECT from the secrets table
+		rr := postLogin(t, "' UNION SELECT name, secret FROM secrets --", "x")
+
+		// Expected Output: The secrets are dumped like users
+		for _, secret := range []string{"gocon2025{hidden}", "gocon2025{backup}"} {
+			if !strings.Contains(rr.Body.String(), secret) {
+				t.Errorf("Expected %s in the result", secret)
+			}
+		}
+	})
+
+	t.Run("zip password and flag use the named columns", func(t *testing.T) {
+		// Input: Replacement zip password and flag row
+		table, err := usersTable("newpassword", "gocon2025{test}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: The password column is replaced, the flag row fills username and password
+		body := string(table)
+		for _, expected := range []string{"2,zip,newpassword", ",flag,gocon2025{test}"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %q in users table, got %s", expected, body)
+			}
+		}
+	})
+
+	t.Run("hardened accounts are seeded from the external users table", func(t *testing.T) {
+		store := newMemoryUserStore()
+
+		// Input: Seed an empty store
+		if err := seedAccounts(context.Background(), store, userData[usersTableName]); err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: The users of users.tsv
+		list, err := store.List(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 2 || list[0].Username != "alice" || list[1].Username != "zip" {
+			t.Errorf("Unexpected accounts %v", list)
+		}
+	})
+}
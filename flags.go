@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+var (
+	errWrongFlag  = errors.New("wrong flag")
+	errSharedFlag = errors.New("flag issued to another team")
+)
+
+// issuedFlag is a generated flag, remembered only by its digest
+type issuedFlag struct {
+	ChallengeID string
+	Team        string
+}
+
+// FlagShare is a submission of a flag that was issued to another team
+type FlagShare struct {
+	At        time.Time `json:"at"`
+	Player    string    `json:"player"`
+	Team      string    `json:"team"`
+	Owner     string    `json:"owner"`
+	Challenge string    `json:"challenge"`
+}
+
+// flagRegistry maps the digests of generated flags to the team they were issued to
+type flagRegistry struct {
+	mu       sync.Mutex
+	byDigest map[string]issuedFlag
+	shares   []FlagShare
+}
+
+func newFlagRegistry() *flagRegistry {
+	return &flagRegistry{byDigest: make(map[string]issuedFlag)}
+}
+
+var flags = newFlagRegistry()
+
+// issue remembers a generated flag. An empty team means the flag is shared by everyone.
+func (f *flagRegistry) issue(flag, challengeID, team string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.byDigest[flagSHA256(flag)] = issuedFlag{ChallengeID: challengeID, Team: team}
+}
+
+func (f *flagRegistry) lookup(digest string) (issuedFlag, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	issued, ok := f.byDigest[digest]
+	return issued, ok
+}
+
+func (f *flagRegistry) recordShare(share FlagShare) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.shares = append(f.shares, share)
+}
+
+// sharedFlags returns the recorded flag sharing attempts
+func (f *flagRegistry) sharedFlags() []FlagShare {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FlagShare(nil), f.shares...)
+}
+
+// enabledChallenge returns the enabled challenge with the given ID
+func enabledChallenge(id string) (challenge.Challenge, bool) {
+	for _, c := range enabledChallenges {
+		if c.ID() == id {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// matchFlag returns the enabled challenge solved by the submitted flag.
+// Generated flags are only accepted from the team they were issued to.
+func matchFlag(player, flag string, inst *instance) (challenge.Challenge, error) {
+	digest := flagSHA256(flag)
+
+	if issued, ok := flags.lookup(digest); ok {
+		c, enabled := enabledChallenge(issued.ChallengeID)
+		if !enabled {
+			return nil, errWrongFlag
+		}
+		if issued.Team != "" && (inst == nil || inst.key != issued.Team) {
+			share := FlagShare{At: time.Now(), Player: player, Owner: issued.Team, Challenge: c.ID()}
+			if inst != nil {
+				share.Team = inst.key
+			}
+			flags.recordShare(share)
+			return nil, errSharedFlag
+		}
+		return c, nil
+	}
+
+	for _, c := range enabledChallenges {
+		expected := c.FlagDigest()
+		if expected == "" {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) == 1 {
+			return c, nil
+		}
+	}
+	return nil, errWrongFlag
+}
+
+// apiToken authorizes organizer APIs; they are disabled while it is empty
+var apiToken string
+
+// authorizeAPI checks the organizer bearer token
+func authorizeAPI(w http.ResponseWriter, r *http.Request) bool {
+	if apiToken == "" {
+		http.NotFound(w, r)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+type FlagVerification struct {
+	Valid     bool   `json:"valid"`
+	Challenge string `json:"challenge,omitempty"`
+	Team      string `json:"team,omitempty"`
+}
+
+// flagVerifyHandler tells organizers which challenge and team a flag belongs to
+func flagVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAPI(w, r) {
+		return
+	}
+	digest := flagSHA256(r.FormValue("flag"))
+	result := FlagVerification{}
+	if issued, ok := flags.lookup(digest); ok {
+		result = FlagVerification{Valid: true, Challenge: issued.ChallengeID, Team: issued.Team}
+	} else {
+		for _, c := range enabledChallenges {
+			if expected := c.FlagDigest(); expected != "" && subtle.ConstantTimeCompare([]byte(digest), []byte(expected)) == 1 {
+				result = FlagVerification{Valid: true, Challenge: c.ID()}
+				break
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, "Encode Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+var (
+	errUnknownHint     = messageError("hint.unknown")
+	errHintNotReleased = messageError("hint.not_released")
+	errNotEnoughPoints = messageError("hint.not_enough_points")
+)
+
+// hintBudget is the points every player starts with to spend on hints, so that a paid hint can be bought before the first solve
+const hintBudget = 50
+
+// eventStart is when the hint timers start: CTF_EVENT_START, or the server start
+var eventStart = time.Now()
+
+type hintUnlock struct {
+	at   time.Time
+	cost int
+}
+
+// hintStore records the hints each player unlocked, keyed by player and hintKey
+type hintStore struct {
+	mu      sync.Mutex
+	unlocks map[string]map[string]hintUnlock
+}
+
+func newHintStore() *hintStore {
+	return &hintStore{unlocks: make(map[string]map[string]hintUnlock)}
+}
+
+var hintUnlocks = newHintStore()
+
+func hintKey(challengeID string, index int) string {
+	return challengeID + "/" + strconv.Itoa(index)
+}
+
+// hintReleased reports whether the hint is free for everyone at now
+func hintReleased(h challenge.Hint, now time.Time) bool {
+	if h.ReleaseAfter == 0 {
+		return h.Cost == 0
+	}
+	return !now.Before(eventStart.Add(h.ReleaseAfter))
+}
+
+// unlock records that the player opened a hint of c. Before its release the hint costs its points,
+// which must not exceed points, the player's hint budget and score from solves, minus what the player already spent.
+func (s *hintStore) unlock(player string, c challenge.Challenge, index, points int, now time.Time) error {
+	hints := c.Hints()
+	if index < 0 || index >= len(hints) {
+		return errUnknownHint
+	}
+	h := hints[index]
+	key := hintKey(c.ID(), index)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.unlocks[player][key]; ok {
+		return nil
+	}
+	cost := 0
+	if !hintReleased(h, now) {
+		if h.Cost == 0 {
+			return errHintNotReleased
+		}
+		if points-s.spentLocked(player) < h.Cost {
+			return errNotEnoughPoints
+		}
+		cost = h.Cost
+	}
+	if s.unlocks[player] == nil {
+		s.unlocks[player] = make(map[string]hintUnlock)
+	}
+	s.unlocks[player][key] = hintUnlock{at: now, cost: cost}
+	return nil
+}
+
+// unlocked reports whether the player opened the hint
+func (s *hintStore) unlocked(player, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.unlocks[player][key]
+	return ok
+}
+
+// spent returns the points the player paid for hints
+func (s *hintStore) spent(player string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.spentLocked(player)
+}
+
+func (s *hintStore) spentLocked(player string) int {
+	total := 0
+	for _, u := range s.unlocks[player] {
+		total += u.cost
+	}
+	return total
+}
+
+type HintView struct {
+	ChallengeID string `json:"challenge_id"`
+	Challenge   string `json:"challenge"`
+	Index       int    `json:"index"`
+	Unlocked    bool   `json:"unlocked"`
+	// Text is only set once the hint is unlocked or released
+	Text string `json:"text,omitempty"`
+	// Cost is the price of unlocking the hint now, 0 when it can only wait for its release
+	Cost      int    `json:"cost"`
+	ReleaseAt string `json:"release_at,omitempty"`
+}
+
+// hintTexts are the texts of the hints supplied by the organizers, keyed by hintKey and language
+var hintTexts map[string]map[string]string
+
+// loadHintTexts reads CTF_HINTS, a JSON object of hint texts keyed by hintKey and language,
+// e.g. {"sqli-login/0": {"ja": "…", "en": "…"}}
+func loadHintTexts(path string) (map[string]map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var texts map[string]map[string]string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return texts, nil
+}
+
+// hintText returns the text of a hint of c in lang: the organizers' text in lang or the default language,
+// then the text the challenge wrote, then a placeholder saying the hint was not provided
+func hintText(lang string, c challenge.Challenge, index int) string {
+	texts := hintTexts[hintKey(c.ID(), index)]
+	if text, ok := texts[lang]; ok {
+		return text
+	}
+	if text, ok := texts[defaultLanguage]; ok {
+		return text
+	}
+	if text := c.Hints()[index].Text; text != "" {
+		return text
+	}
+	return translate(lang, "hint.unavailable")
+}
+
+// playerHints returns the hints of the enabled challenges in lang as the player sees them at now
+func playerHints(lang, player string, now time.Time) []HintView {
+	views := []HintView{}
+	for _, c := range enabledChallenges {
+		for i, h := range c.Hints() {
+			view := HintView{ChallengeID: c.ID(), Challenge: challengeName(lang, c), Index: i}
+			if hintReleased(h, now) || hintUnlocks.unlocked(player, hintKey(c.ID(), i)) {
+				view.Unlocked = true
+				view.Text = hintText(lang, c, i)
+			} else {
+				view.Cost = h.Cost
+				if h.ReleaseAfter > 0 {
+					view.ReleaseAt = eventStart.Add(h.ReleaseAfter).Format("2006-01-02 15:04")
+				}
+			}
+			views = append(views, view)
+		}
+	}
+	return views
+}
+
+type hintRequest struct {
+	Challenge string `json:"challenge"`
+	Hint      int    `json:"hint"`
+}
+
+// readHintRequest reads the hint to unlock from a form or a JSON object
+func readHintRequest(w http.ResponseWriter, r *http.Request) (hintRequest, error) {
+	var req hintRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormRequestSize)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		err := json.NewDecoder(r.Body).Decode(&req)
+		return req, err
+	}
+	req.Challenge = r.FormValue("challenge")
+	index, err := strconv.Atoi(r.FormValue("hint"))
+	if err != nil {
+		return req, err
+	}
+	req.Hint = index
+	return req, nil
+}
+
+// hintErrorStatus returns the status for an error of unlocking a hint
+func hintErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUnknownHint):
+		return http.StatusNotFound
+	case errors.Is(err, errNotEnoughPoints):
+		return http.StatusPaymentRequired
+	default:
+		return http.StatusForbidden
+	}
+}
+
+// hintUnlockHandler unlocks a hint for the logged in player and goes back to the dashboard
+func hintUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return
+	}
+
+	player, _, ok := playerIdentity(r, user)
+	if !ok {
+		respondUnauthorized(w, r)
+		return
+	}
+
+	req, err := readHintRequest(w, r)
+	if err != nil {
+		respondError(w, r, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	err = errUnknownHint
+	if c, ok := enabledChallenge(req.Challenge); ok {
+		err = hintUnlocks.unlock(player, c, req.Hint, hintBudget+board.score(player), now)
+	}
+	if err == nil && !wantsJSON(r) {
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+		return
+	}
+
+	data, dataErr := requestDashboardData(r, user, player, now)
+	if dataErr != nil {
+		respondError(w, r, "Database Error", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusOK
+	if err != nil {
+		data.Error = errorMessage(requestLanguage(r), err)
+		status = hintErrorStatus(err)
+	}
+	respond(w, r, status, "dashboard", data)
+}
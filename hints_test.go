@@ -0,0 +1,306 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+// testHintTexts stands in for the organizers' CTF_HINTS file
+var testHintTexts = map[string]map[string]string{
+	hintKey(sqliLoginID, 0):   {langJA: "テスト用のヒント（ログイン）", langEN: "Test hint for the login"},
+	hintKey(recipeIDORID, 0):  {langJA: "テスト用のヒント（レシピ）", langEN: "Test hint for the recipes"},
+	hintKey(ingredientsID, 0): {langJA: "テスト用のヒント（食材1）"},
+	hintKey(ingredientsID, 1): {langJA: "テスト用のヒント（食材2）"},
+}
+
+// useHints starts the event at start with an empty scoreboard and no unlocked hints
+func useHints(t *testing.T, start time.Time) {
+	t.Helper()
+
+	prevStart, prevUnlocks, prevBoard := eventStart, hintUnlocks, board
+	eventStart, hintUnlocks, board = start, newHintStore(), newScoreboard()
+	t.Cleanup(func() { eventStart, hintUnlocks, board = prevStart, prevUnlocks, prevBoard })
+}
+
+func postHintUnlock(t *testing.T, path, user, challengeID, index string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"challenge": {challengeID}, "hint": {index}}
+	req := newAPIRequest(t, http.MethodPost, path, user, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	addPlayer(t, req, "team-"+user)
+	rr := httptest.NewRecorder()
+	hintUnlockHandler(rr, req)
+	return rr
+}
+
+func TestHintStore(t *testing.T) {
+	now := time.Date(2025, 9, 27, 10, 0, 0, 0, time.UTC)
+	c := &stage{id: "test", hints: []challenge.Hint{
+		{Text: "free"},
+		{Text: "timed", ReleaseAfter: time.Hour},
+		{Text: "paid", Cost: 50, ReleaseAfter: time.Hour},
+	}}
+
+	testCases := []struct {
+		name     string
+		index    int
+		points   int
+		after    time.Duration
+		expected error
+		spent    int
+	}{
+		{"free hint", 0, 0, 0, nil, 0},
+		{"timed hint before release", 1, 500, 0, errHintNotReleased, 0},
+		{"timed hint after release", 1, 0, time.Hour, nil, 0},
+		{"paid hint with enough points", 2, 100, 0, nil, 50},
+		{"paid hint without enough points", 2, 40, 0, errNotEnoughPoints, 0},
+		{"paid hint after release", 2, 0, time.Hour, nil, 0},
+		{"unknown hint", 3, 100, 0, errUnknownHint, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useHints(t, now)
+
+			// Input: Unlock the hint with the player's points at some time after the start
+			err := hintUnlocks.unlock("alice", c, tc.index, tc.points, now.Add(tc.after))
+
+			// Expected Output: Unlocked or rejected, and the points spent
+			if err != tc.expected {
+				t.Errorf("Expected error %v, got %v", tc.expected, err)
+			}
+			if spent := hintUnlocks.spent("alice"); spent != tc.spent {
+				t.Errorf("Expected %d points spent, got %d", tc.spent, spent)
+			}
+		})
+	}
+
+	t.Run("spent points count against the next hint", func(t *testing.T) {
+		useHints(t, now)
+		c := &stage{id: "test", hints: []challenge.Hint{{Text: "a", Cost: 60}, {Text: "b", Cost: 60}}}
+
+		// Input: Two hints and the first one twice, with 100 points
+		first := hintUnlocks.unlock("alice", c, 0, 100, now)
+		again := hintUnlocks.unlock("alice", c, 0, 100, now)
+		second := hintUnlocks.unlock("alice", c, 1, 100, now)
+
+		// Expected Output: The first hint is paid once, the second one is too expensive
+		if first != nil || again != nil || second != errNotEnoughPoints {
+			t.Errorf("Unexpected errors %v, %v, %v", first, again, second)
+		}
+		if spent := hintUnlocks.spent("alice"); spent != 60 {
+			t.Errorf("Expected 60 points spent, got %d", spent)
+		}
+	})
+}
+
+func TestHintText(t *testing.T) {
+	c := &stage{id: "test", hints: []challenge.Hint{{}, {Text: "written"}, {}}}
+	prev := hintTexts
+	hintTexts = map[string]map[string]string{
+		hintKey("test", 0): {langJA: "ヒント", langEN: "hint"},
+		hintKey("test", 1): {langJA: "ヒント"},
+	}
+	t.Cleanup(func() { hintTexts = prev })
+
+	testCases := []struct {
+		name     string
+		lang     string
+		index    int
+		expected string
+	}{
+		{"organizers' text in the language", langEN, 0, "hint"},
+		{"organizers' text in the default language", langEN, 1, "ヒント"},
+		{"no text -> placeholder", langEN, 2, "The organizers have not provided this hint"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: The text of a hint in a language
+			// Expected Output: The first text available
+			if text := hintText(tc.lang, c, tc.index); text != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, text)
+			}
+		})
+	}
+
+	t.Run("hints file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "hints.json")
+		if err := os.WriteFile(path, []byte(`{"sqli-login/0": {"ja": "ヒント"}}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		broken := filepath.Join(t.TempDir(), "broken.json")
+		if err := os.WriteFile(broken, []byte(`["ヒント"]`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: A CTF_HINTS file, and one that is not an object of texts
+		texts, err := loadHintTexts(path)
+		_, brokenErr := loadHintTexts(broken)
+
+		// Expected Output: The texts by hint and language, and an error
+		if err != nil || texts[hintKey(sqliLoginID, 0)][langJA] != "ヒント" {
+			t.Errorf("Unexpected texts %v %v", texts, err)
+		}
+		if brokenErr == nil {
+			t.Error("Expected an error for the broken file")
+		}
+	})
+}
+
+func TestHintUnlockHandler(t *testing.T) {
+	recipeIDOR, _ := registry.Get(recipeIDORID)
+
+	t.Run("dashboard shows locked hints without their text", func(t *testing.T) {
+		useHints(t, time.Now())
+
+		// Input: GET /dashboard right after the start
+		rr := httptest.NewRecorder()
+		dashboardHandler(rr, newAPIRequest(t, http.MethodGet, "/dashboard", "alice", nil))
+
+		// Expected Output: The cost and release time, but not the hint
+		body := rr.Body.String()
+		if !strings.Contains(body, "50 点で開く") || !strings.Contains(body, "に公開されます") {
+			t.Errorf("Expected locked hints in the dashboard, got %s", body)
+		}
+		if strings.Contains(body, testHintTexts[hintKey(recipeIDORID, 0)][langJA]) {
+			t.Error("Expected the hint text to be hidden")
+		}
+	})
+
+	t.Run("released hint -> shown without unlocking", func(t *testing.T) {
+		useHints(t, time.Now().Add(-3*time.Hour))
+
+		// Input: GET /api/v1/dashboard after every release
+		rr := httptest.NewRecorder()
+		dashboardHandler(rr, newAPIRequest(t, http.MethodGet, apiPrefix+"/dashboard", "alice", nil))
+
+		// Expected Output: Every hint is unlocked
+		var data DashboardData
+		decodeJSON(t, rr, &data)
+		if len(data.Hints) != 4 {
+			t.Fatalf("Expected 4 hints, got %v", data.Hints)
+		}
+		for _, h := range data.Hints {
+			if !h.Unlocked || h.Text == "" {
+				t.Errorf("Expected %s hint %d to be released", h.ChallengeID, h.Index)
+			}
+		}
+	})
+
+	t.Run("buy a hint -> redirect, text on the dashboard and points deducted", func(t *testing.T) {
+		useHints(t, time.Now())
+		board.record("team-alice", "alice#team-a", recipeIDOR, time.Now())
+
+		// Input: POST /hints/unlock with 200 points
+		rr := postHintUnlock(t, "/hints/unlock", "alice", recipeIDORID, "0")
+
+		// Expected Output: Back to the dashboard, which shows the hint, and 50 points less on the scoreboard
+		if status := rr.Code; status != http.StatusFound {
+			t.Fatalf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		dashboard := httptest.NewRecorder()
+		dashboardReq := newAPIRequest(t, http.MethodGet, "/dashboard", "alice", nil)
+		addPlayer(t, dashboardReq, "team-alice")
+		dashboardHandler(dashboard, dashboardReq)
+		if !strings.Contains(dashboard.Body.String(), testHintTexts[hintKey(recipeIDORID, 0)][langJA]) {
+			t.Error("Expected the hint in the dashboard")
+		}
+		if entries := board.ranking(); len(entries) != 1 || entries[0].Score != 150 {
+			t.Errorf("Expected a score of 150, got %v", entries)
+		}
+	})
+
+	t.Run("buy a hint before any solve -> paid from the starting budget", func(t *testing.T) {
+		useHints(t, time.Now())
+
+		// Input: POST /hints/unlock for a 50 point hint with no solves
+		rr := postHintUnlock(t, "/hints/unlock", "alice", recipeIDORID, "0")
+
+		// Expected Output: Back to the dashboard, with the hint unlocked and its points spent
+		if status := rr.Code; status != http.StatusFound {
+			t.Fatalf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		if !hintUnlocks.unlocked("team-alice", hintKey(recipeIDORID, 0)) {
+			t.Error("Expected the hint to be unlocked")
+		}
+		if spent := hintUnlocks.spent("team-alice"); spent != hintBudget {
+			t.Errorf("Expected %d points spent, got %d", hintBudget, spent)
+		}
+	})
+
+	t.Run("not enough points -> 402", func(t *testing.T) {
+		useHints(t, time.Now())
+
+		// Input: POST /api/v1/hints/unlock for a 100 point hint with only the starting budget
+		rr := postHintUnlock(t, apiPrefix+"/hints/unlock", "alice", ingredientsID, "1")
+
+		// Expected Output: The error, and the hint stays locked
+		if status := rr.Code; status != http.StatusPaymentRequired {
+			t.Errorf("Expected status %v, got %v", http.StatusPaymentRequired, status)
+		}
+		var data DashboardData
+		decodeJSON(t, rr, &data)
+		if data.Error != errNotEnoughPoints.Error() {
+			t.Errorf("Expected not enough points, got %q", data.Error)
+		}
+		if hintUnlocks.unlocked("team-alice", hintKey(ingredientsID, 1)) {
+			t.Error("Expected the hint to stay locked")
+		}
+	})
+
+	t.Run("failed unlock -> the dashboard can still log out", func(t *testing.T) {
+		useHints(t, time.Now())
+
+		// Input: POST /hints/unlock with no points, then POST /logout with the token of the rendered form
+		rr := postHintUnlock(t, "/hints/unlock", "alice", ingredientsID, "1")
+		match := regexp.MustCompile(`name="csrf_token" value="([^"]*)"`).FindStringSubmatch(rr.Body.String())
+		if match == nil || match[1] == "" {
+			t.Fatalf("Expected a logout token, got %s", rr.Body.String())
+		}
+		logout := httptest.NewRecorder()
+		router.ServeHTTP(logout, newLogoutRequest(t, &http.Cookie{Name: "user", Value: "alice"}, html.UnescapeString(match[1])))
+
+		// Expected Output: Logged out
+		if status := logout.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("unknown challenge -> 404", func(t *testing.T) {
+		useHints(t, time.Now())
+
+		// Input: POST /api/v1/hints/unlock for a challenge that does not exist
+		rr := postHintUnlock(t, apiPrefix+"/hints/unlock", "alice", "nope", "0")
+
+		// Expected Output: Not found
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+	})
+
+	t.Run("GET -> method not allowed", func(t *testing.T) {
+		// Input: GET /hints/unlock
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/hints/unlock", "alice", nil))
+
+		// Expected Output: 405 with Allow header
+		if status := rr.Code; status != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %v, got %v", http.StatusMethodNotAllowed, status)
+		}
+		if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+			t.Errorf("Expected Allow POST, got %v", allow)
+		}
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Languages of the user interface
+const (
+	langJA = "ja"
+	langEN = "en"
+)
+
+// defaultLanguage is used when a request names no supported language
+const defaultLanguage = langJA
+
+// languages are the supported languages in the order of the language switcher
+var languages = []string{langJA, langEN}
+
+// languageNames are the names of the languages in themselves, shown by the language switcher
+var languageNames = map[string]string{
+	langJA: "日本語",
+	langEN: "English",
+}
+
+// languageCookieName is the cookie remembering the language chosen with the switcher
+const languageCookieName = "lang"
+
+// catalog holds the user-facing messages by key and language. Messages with arguments are fmt formats.
+var catalog = map[string]map[string]string{
+	"site.name":             {langJA: "レシピサイト", langEN: "Recipe Site"},
+	"language.switcher":     {langJA: "言語", langEN: "Language"},
+	"nav.back_to_dashboard": {langJA: "🏠 レシピ一覧に戻る", langEN: "🏠 Back to recipes"},
+	"nav.back_to_recipes":   {langJA: "レシピ一覧に戻る", langEN: "Back to recipes"},
+	"nav.back_to_login":     {langJA: "ログインに戻る", langEN: "Back to login"},
+
+	"login.title":             {langJA: "ログイン", langEN: "Log in"},
+	"login.username":          {langJA: "ユーザー名:", langEN: "Username:"},
+	"login.password":          {langJA: "パスワード:", langEN: "Password:"},
+	"login.submit":            {langJA: "ログイン", langEN: "Log in"},
+	"login.register":          {langJA: "アカウントを作成する", langEN: "Create an account"},
+	"login.repository_prefix": {langJA: "（GitHubリポジトリは", langEN: "(The GitHub repository is "},
+	"login.repository_link":   {langJA: "こちら", langEN: "here"},
+	"login.repository_suffix": {langJA: "）", langEN: ")"},
+	"login.failed":            {langJA: "ユーザー名またはパスワードが間違っています", langEN: "Incorrect username or password"},
+	"login.all_users":         {langJA: "全ユーザー情報", langEN: "All users"},
+	"login.username_column":   {langJA: "ユーザー名", langEN: "Username"},
+	"login.password_column":   {langJA: "パスワード", langEN: "Password"},
+
+	"not_found.title":   {langJA: "レシピが見つかりません", langEN: "Recipe not found"},
+	"not_found.message": {langJA: "指定されたレシピは存在しません。", langEN: "The recipe you requested does not exist."},
+
+	"rate_limit.title": {langJA: "しばらくお待ちください", langEN: "Please wait"},
+	"rate_limit.error": {langJA: "ログインの試行回数が多すぎます。しばらくしてから再度お試しください", langEN: "Too many login attempts. Please try again later"},
+	"rate_limit.retry": {langJA: "%d 秒後に再度お試しいただけます。", langEN: "You can try again in %d seconds."},
+
+	"account.register_title":    {langJA: "ユーザー登録", langEN: "Sign up"},
+	"account.password_title":    {langJA: "パスワード変更", langEN: "Change password"},
+	"account.password":          {langJA: "パスワード（8文字以上）:", langEN: "Password (8 characters or more):"},
+	"account.confirm":           {langJA: "パスワード（確認）:", langEN: "Confirm password:"},
+	"account.register":          {langJA: "登録", langEN: "Sign up"},
+	"account.current_password":  {langJA: "現在のパスワード:", langEN: "Current password:"},
+	"account.new_password":      {langJA: "新しいパスワード（8文字以上）:", langEN: "New password (8 characters or more):"},
+	"account.new_confirm":       {langJA: "新しいパスワード（確認）:", langEN: "Confirm new password:"},
+	"account.change":            {langJA: "変更", langEN: "Change"},
+	"account.password_changed":  {langJA: "パスワードを変更しました", langEN: "Your password has been changed"},
+	"account.password_mismatch": {langJA: "確認用のパスワードが一致しません", langEN: "The passwords do not match"},
+	"account.wrong_password":    {langJA: "現在のパスワードが間違っています", langEN: "Your current password is incorrect"},
+	"account.user_exists":       {langJA: "このユーザー名は既に使われています", langEN: "This username is already taken"},
+	"account.invalid_username":  {langJA: "ユーザー名は英数字・-・_ の 3〜32 文字にしてください", langEN: "Usernames must be 3 to 32 letters, digits, - or _"},
+	"account.weak_password":     {langJA: "パスワードは 8〜72 バイトにしてください", langEN: "Passwords must be 8 to 72 bytes"},
+
+	"dashboard.title":           {langJA: "レシピダッシュボード", langEN: "Recipe Dashboard"},
+	"dashboard.owner_title":     {langJA: "%sのダッシュボード", langEN: "%s's Dashboard"},
+	"dashboard.welcome":         {langJA: "✨ こんにちは、%sさん！利用可能なレシピをご覧ください。", langEN: "✨ Hello, %s! Take a look at the recipes available to you."},
+	"dashboard.owner_welcome":   {langJA: "🎉 こんにちは、%sさん！あなたの美味しいレシピコレクションをお楽しみください。", langEN: "🎉 Hello, %s! Enjoy your delicious recipe collection."},
+	"dashboard.heading":         {langJA: "🍳 レシピコレクション", langEN: "🍳 Recipe Collection"},
+	"dashboard.subtitle":        {langJA: "美味しい料理のレシピをお楽しみください", langEN: "Enjoy recipes for delicious dishes"},
+	"dashboard.no_recipes":      {langJA: "現在表示できるレシピはありません", langEN: "There are no recipes to show right now"},
+	"dashboard.hints":           {langJA: "💡 ヒント", langEN: "💡 Hints"},
+	"dashboard.hint_release":    {langJA: "%s に公開されます", langEN: "Released at %s"},
+	"dashboard.hint_unreleased": {langJA: "未公開のヒントです", langEN: "This hint has not been released"},
+	"dashboard.hint_unlock":     {langJA: "%d 点で開く", langEN: "Unlock for %d points"},
+	"dashboard.new_recipe":      {langJA: "レシピを投稿", langEN: "Post a recipe"},
+	"dashboard.logout":          {langJA: "ログアウト", langEN: "Log out"},
+
+	"hint.unknown":           {langJA: "ヒントが見つかりません", langEN: "Hint not found"},
+	"hint.not_released":      {langJA: "このヒントはまだ公開されていません", langEN: "This hint has not been released yet"},
+	"hint.not_enough_points": {langJA: "得点が足りないため、このヒントは開けません", langEN: "You do not have enough points to unlock this hint"},
+	"hint.unavailable":       {langJA: "このヒントは運営から配布されていません", langEN: "The organizers have not provided this hint"},
+
+	"recipe.detail":          {langJA: "レシピ詳細", langEN: "Recipe Details"},
+	"recipe.steps":           {langJA: "作り方", langEN: "Directions"},
+	"recipe.edit":            {langJA: "✏️ 編集", langEN: "✏️ Edit"},
+	"recipe.delete":          {langJA: "🗑️ 削除", langEN: "🗑️ Delete"},
+	"recipe.delete_confirm":  {langJA: "このレシピを削除しますか？", langEN: "Delete this recipe?"},
+	"recipe.flag_download":   {langJA: "🚩 フラグGet！ 次の問題はこちら", langEN: "🚩 Got the flag! On to the next challenge"},
+	"recipe.export_markdown": {langJA: "📄 Markdown で保存", langEN: "📄 Save as Markdown"},
+	"recipe.print_view":      {langJA: "🖨️ 印刷用ページ", langEN: "🖨️ Print view"},
+	"recipe.print":           {langJA: "🖨️ 印刷する", langEN: "🖨️ Print"},
+	"recipe.back":            {langJA: "← レシピに戻る", langEN: "← Back to the recipe"},
+
+	"recipe_form.new_title":        {langJA: "📝 レシピを投稿", langEN: "📝 Post a Recipe"},
+	"recipe_form.edit_title":       {langJA: "✏️ レシピを編集", langEN: "✏️ Edit Recipe"},
+	"recipe_form.name":             {langJA: "料理名", langEN: "Dish name"},
+	"recipe_form.emoji":            {langJA: "絵文字", langEN: "Emoji"},
+	"recipe_form.description":      {langJA: "説明", langEN: "Description"},
+	"recipe_form.steps_note":       {langJA: "1行に1つの手順を書いてください", langEN: "Write one step per line"},
+	"recipe_form.visibility":       {langJA: "公開範囲", langEN: "Visibility"},
+	"recipe_form.private":          {langJA: "自分だけ", langEN: "Only me"},
+	"recipe_form.shared":           {langJA: "指定したユーザーと共有", langEN: "Shared with specific users"},
+	"recipe_form.public":           {langJA: "全員に公開", langEN: "Everyone"},
+	"recipe_form.shared_with":      {langJA: "共有するユーザー", langEN: "Share with"},
+	"recipe_form.shared_with_note": {langJA: "「指定したユーザーと共有」のときだけ使われます。カンマ区切りで入力してください", langEN: "Only used when shared with specific users. Separate the usernames with commas"},
+	"recipe_form.image":            {langJA: "画像", langEN: "Image"},
+	"recipe_form.image_note":       {langJA: "画像を選択しない場合は現在の画像のままです", langEN: "The current image is kept if you do not choose a new one"},
+	"recipe_form.translation":      {langJA: "🌐 翻訳（%s）", langEN: "🌐 Translation (%s)"},
+	"recipe_form.translation_note": {langJA: "空欄の項目は元の内容で表示されます", langEN: "Empty fields are shown with the original content"},
+	"recipe_form.cancel":           {langJA: "キャンセル", langEN: "Cancel"},
+	"recipe_form.save":             {langJA: "💾 保存", langEN: "💾 Save"},
+
+	"recipe.missing_name":       {langJA: "料理名を入力してください", langEN: "Enter the name of the dish"},
+	"recipe.invalid_image":      {langJA: "画像は JPEG、PNG、GIF、WebP のいずれかを選択してください", langEN: "Choose a JPEG, PNG, GIF or WebP image"},
+	"recipe.image_too_large":    {langJA: "画像は 5MB 以下にしてください", langEN: "Images must be 5MB or smaller"},
+	"recipe.unknown_visibility": {langJA: "公開範囲は private、shared、public のいずれかを選択してください", langEN: "Choose private, shared or public as the visibility"},
+	"recipe.unknown_language":   {langJA: "翻訳の言語は ja、en のいずれかを指定してください", langEN: "Translations must be in ja or en"},
+
+	"scoreboard.title":          {langJA: "スコアボード", langEN: "Scoreboard"},
+	"scoreboard.submit_heading": {langJA: "🚩 フラグを提出", langEN: "🚩 Submit a Flag"},
+	"scoreboard.flag":           {langJA: "フラグを入力してください", langEN: "Enter a flag"},
+	"scoreboard.submit":         {langJA: "提出", langEN: "Submit"},
+	"scoreboard.challenges":     {langJA: "🧩 チャレンジ", langEN: "🧩 Challenges"},
+	"scoreboard.challenge":      {langJA: "チャレンジ", langEN: "Challenge"},
+	"scoreboard.difficulty":     {langJA: "難易度", langEN: "Difficulty"},
+	"scoreboard.points":         {langJA: "得点", langEN: "Points"},
+	"scoreboard.status":         {langJA: "状態", langEN: "Status"},
+	"scoreboard.ranking":        {langJA: "📊 ランキング", langEN: "📊 Ranking"},
+	"scoreboard.rank":           {langJA: "順位", langEN: "Rank"},
+	"scoreboard.player":         {langJA: "プレイヤー", langEN: "Player"},
+	"scoreboard.solves":         {langJA: "正解数", langEN: "Solves"},
+	"scoreboard.last_solve":     {langJA: "最終正解時刻", langEN: "Last solve"},
+	"scoreboard.no_solves":      {langJA: "まだ正解者はいません", langEN: "Nobody has solved a challenge yet"},
+	"scoreboard.shared_flag":    {langJA: "このフラグは他のチームに発行されたものです", langEN: "This flag was issued to another team"},
+	"scoreboard.wrong_flag":     {langJA: "フラグが間違っています", langEN: "Wrong flag"},
+	"scoreboard.solved":         {langJA: "🎉 正解です！「%s」をスコアボードに記録しました", langEN: "🎉 Correct! \"%s\" has been recorded on the scoreboard"},
+	"scoreboard.already_solved": {langJA: "既に正解済みです", langEN: "You have already solved this challenge"},
+
+	"admin.title":                 {langJA: "管理画面", langEN: "Admin"},
+	"admin.mode":                  {langJA: "%s モード", langEN: "%s mode"},
+	"admin.solves":                {langJA: "🧩 ステージごとの正解者", langEN: "🧩 Solves by Stage"},
+	"admin.solvers":               {langJA: "正解者（早い順）", langEN: "Solvers (earliest first)"},
+	"admin.sessions":              {langJA: "🔑 セッション", langEN: "🔑 Sessions"},
+	"admin.user":                  {langJA: "ユーザー", langEN: "User"},
+	"admin.logged_in_at":          {langJA: "ログイン日時", langEN: "Logged in at"},
+	"admin.expires_at":            {langJA: "有効期限", langEN: "Expires at"},
+	"admin.revoke":                {langJA: "失効", langEN: "Revoke"},
+	"admin.no_sessions":           {langJA: "有効なセッションはありません", langEN: "No active sessions"},
+	"admin.sessions_not_recorded": {langJA: "（vulnerable モードでは user Cookie を使うため記録されません）", langEN: " (not recorded in vulnerable mode, which uses the user cookie)"},
+	"admin.instances":             {langJA: "🧪 プレイヤーのインスタンス", langEN: "🧪 Player Instances"},
+	"admin.last_seen":             {langJA: "最終アクセス", langEN: "Last seen"},
+	"admin.reset":                 {langJA: "リセット", langEN: "Reset"},
+	"admin.no_instances":          {langJA: "インスタンスはありません", langEN: "No instances"},
+	"admin.logins":                {langJA: "🚪 ログイン試行", langEN: "🚪 Login Attempts"},
+	"admin.at":                    {langJA: "日時", langEN: "Time"},
+	"admin.result":                {langJA: "結果", langEN: "Result"},
+	"admin.matched":               {langJA: "（%d 件）", langEN: " (%d rows)"},
+	"admin.no_logins":             {langJA: "ログイン試行はありません", langEN: "No login attempts"},
+	"admin.downloads":             {langJA: "📦 flag.zip のダウンロード", langEN: "📦 flag.zip Downloads"},
+	"admin.no_downloads":          {langJA: "ダウンロードはありません", langEN: "No downloads"},
+
+	// The names of the built-in challenges, keyed by challenge ID
+	"challenge." + sqliLoginID:   {langJA: "レシピサイトにログイン", langEN: "Log in to the Recipe Site"},
+	"challenge." + recipeIDORID:  {langJA: "隠されたレシピを探せ", langEN: "Find the Hidden Recipe"},
+	"challenge." + ingredientsID: {langJA: "食材リストを開封せよ", langEN: "Open the Ingredients List"},
+}
+
+// lookupMessage returns the message key in lang, falling back to the default language
+func lookupMessage(lang, key string) (string, bool) {
+	messages, ok := catalog[key]
+	if !ok {
+		return "", false
+	}
+	if message, ok := messages[lang]; ok {
+		return message, true
+	}
+	message, ok := messages[defaultLanguage]
+	return message, ok
+}
+
+// translate returns the message key in lang formatted with args, or the key itself if the catalog has no such message
+func translate(lang, key string, args ...any) string {
+	message, ok := lookupMessage(lang, key)
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(message, args...)
+	}
+	return message
+}
+
+// localize translates the message key to the language of the request
+func localize(r *http.Request, key string, args ...any) string {
+	return translate(requestLanguage(r), key, args...)
+}
+
+// messageError is an error shown to users. Its value is the catalog key of the message;
+// Error returns the message in the default language and errorMessage translates it.
+type messageError string
+
+func (e messageError) Error() string {
+	return translate(defaultLanguage, string(e))
+}
+
+// errorMessage returns the text of err in lang
+func errorMessage(lang string, err error) string {
+	var m messageError
+	if errors.As(err, &m) {
+		return translate(lang, string(m))
+	}
+	return err.Error()
+}
+
+// supportedLanguage returns the supported language of a language tag such as "en-US"
+func supportedLanguage(tag string) (string, bool) {
+	primary, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+	primary = strings.ToLower(primary)
+	for _, lang := range languages {
+		if primary == lang {
+			return lang, true
+		}
+	}
+	return "", false
+}
+
+// acceptedLanguage returns the supported language an Accept-Language header ranks highest, or the default language
+func acceptedLanguage(header string) string {
+	best, bestQ := defaultLanguage, 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if lang, ok := supportedLanguage(tag); ok && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
+
+// requestLanguage returns the language to answer a request in: the lang query parameter of the switcher,
+// then the language remembered in the cookie, then the Accept-Language header
+func requestLanguage(r *http.Request) string {
+	if lang, ok := supportedLanguage(r.URL.Query().Get("lang")); ok {
+		return lang
+	}
+	if cookie, err := r.Cookie(languageCookieName); err == nil {
+		if lang, ok := supportedLanguage(cookie.Value); ok {
+			return lang
+		}
+	}
+	return acceptedLanguage(r.Header.Get("Accept-Language"))
+}
+
+// withLanguage remembers the language chosen with the switcher's lang query parameter in a cookie
+func withLanguage(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lang, ok := supportedLanguage(r.URL.Query().Get("lang")); ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     languageCookieName,
+				Value:    lang,
+				Path:     "/",
+				MaxAge:   int((365 * 24 * time.Hour).Seconds()),
+				Secure:   secureCookies || r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r)
+	})
+}
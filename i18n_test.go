@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptedLanguage(t *testing.T) {
+	testCases := []struct {
+		header   string
+		expected string
+	}{
+		{"", langJA},
+		{"en", langEN},
+		{"en-US,en;q=0.9", langEN},
+		{"fr-FR, en;q=0.8, ja;q=0.9", langJA},
+		{"fr, de", langJA},
+		{"EN-gb", langEN},
+		{"ja;q=0, en;q=0.1", langEN},
+		{"en;q=x, ja", langJA},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.header, func(t *testing.T) {
+			// Input: Accept-Language header
+			// Expected Output: The supported language ranked highest, or Japanese
+			if got := acceptedLanguage(tc.header); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequestLanguage(t *testing.T) {
+	testCases := []struct {
+		name     string
+		query    string
+		cookie   string
+		header   string
+		expected string
+	}{
+		{"nothing -> default", "", "", "", langJA},
+		{"header", "", "", "en-US", langEN},
+		{"cookie over header", "", "ja", "en", langJA},
+		{"query over cookie", "?lang=en", "ja", "", langEN},
+		{"unsupported values ignored", "?lang=fr", "de", "en", langEN},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: A request choosing its language in different ways
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/dashboard"+tc.query, nil)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: languageCookieName, Value: tc.cookie})
+			}
+			if tc.header != "" {
+				req.Header.Set("Accept-Language", tc.header)
+			}
+
+			// Expected Output: The switcher, then the cookie, then the header
+			if got := requestLanguage(req); got != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	verb := regexp.MustCompile(`%[a-z]`)
+
+	t.Run("every message in every language with the same arguments", func(t *testing.T) {
+		for key, messages := range catalog {
+			// Input: Each catalog entry
+			// Expected Output: A translation for every language using the same format verbs
+			for _, lang := range languages {
+				message, ok := messages[lang]
+				if !ok || message == "" {
+					t.Errorf("%s: missing %s", key, lang)
+					continue
+				}
+				if got, expected := verb.FindAllString(message, -1), verb.FindAllString(messages[defaultLanguage], -1); !slices.Equal(got, expected) {
+					t.Errorf("%s: %s uses %q, %s uses %q", key, lang, got, defaultLanguage, expected)
+				}
+			}
+		}
+	})
+
+	t.Run("every key used by the templates exists", func(t *testing.T) {
+		used := regexp.MustCompile(`\{\{t "([^"]+)"`)
+		err := fs.WalkDir(templateFiles, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			data, err := fs.ReadFile(templateFiles, path)
+			if err != nil {
+				return err
+			}
+
+			// Input: The keys translated by a template
+			// Expected Output: Each key is in the catalog
+			for _, m := range used.FindAllStringSubmatch(string(data), -1) {
+				if _, ok := catalog[m[1]]; !ok {
+					t.Errorf("%s: unknown key %q", path, m[1])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unknown key -> the key itself", func(t *testing.T) {
+		// Input: A key missing from the catalog
+		// Expected Output: The key, so the missing message is visible on the page
+		if got := translate(langEN, "nope.missing"); got != "nope.missing" {
+			t.Errorf("Expected the key, got %q", got)
+		}
+	})
+
+	t.Run("message errors", func(t *testing.T) {
+		// Input: A wrapped message error and an ordinary error
+		err := errors.Join(errors.New("context"), errWeakPassword)
+
+		// Expected Output: Japanese from Error, translated by errorMessage, ordinary errors unchanged
+		if errWeakPassword.Error() != "パスワードは 8〜72 バイトにしてください" {
+			t.Errorf("Expected the Japanese message, got %q", errWeakPassword.Error())
+		}
+		if got := errorMessage(langEN, err); got != "Passwords must be 8 to 72 bytes" {
+			t.Errorf("Expected the English message, got %q", got)
+		}
+		if got := errorMessage(langEN, errUserNotFound); got != errUserNotFound.Error() {
+			t.Errorf("Expected the error text, got %q", got)
+		}
+	})
+}
+
+func TestRecipeText(t *testing.T) {
+	recipe := &Recipe{
+		Name:        "カレー",
+		Description: "辛い",
+		Steps:       []string{"煮る"},
+		Translations: map[string]RecipeText{
+			langEN: {Name: "Curry"},
+		},
+	}
+
+	// Input: The recipe in a translated, a partly translated and an untranslated language
+	en, ja := recipe.text(langEN), recipe.text(langJA)
+
+	// Expected Output: Translated fields, with the original content for the rest
+	if en.Name != "Curry" || en.Description != "辛い" || !slices.Equal(en.Steps, recipe.Steps) {
+		t.Errorf("Unexpected English text %+v", en)
+	}
+	if ja.Name != "カレー" {
+		t.Errorf("Unexpected Japanese text %+v", ja)
+	}
+}
+
+func TestLocalizedPages(t *testing.T) {
+	t.Run("switcher -> page in English and the language remembered", func(t *testing.T) {
+		// Input: GET the login page with the switcher's lang parameter
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/?lang=en", nil))
+
+		// Expected Output: The English page with links to every language, and the cookie
+		body := rr.Body.String()
+		if !strings.Contains(body, `<html lang="en">`) || !strings.Contains(body, "<title>Recipe Site - Log in</title>") {
+			t.Errorf("Expected the English login page, got %q", body)
+		}
+		if !strings.Contains(body, `href="?lang=ja"`) || !strings.Contains(body, `href="?lang=en"`) {
+			t.Error("Expected the language switcher")
+		}
+		if lang := responseCookie(rr, languageCookieName); lang != langEN {
+			t.Errorf("Expected the lang cookie, got %v", rr.Result().Cookies())
+		}
+		if !slices.Contains(rr.Header().Values("Vary"), "Accept-Language") {
+			t.Errorf("Expected Vary: Accept-Language, got %q", rr.Header().Values("Vary"))
+		}
+	})
+
+	t.Run("switcher -> links keep the rest of the query", func(t *testing.T) {
+		// Input: GET the print view of a recipe in English
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/recipe/2?format=print&lang=en", kanmuUser, nil))
+
+		// Expected Output: Links to the print view in every language
+		body := rr.Body.String()
+		if !strings.Contains(body, `href="?format=print&amp;lang=ja"`) || !strings.Contains(body, `href="?format=print&amp;lang=en"`) {
+			t.Errorf("Expected the switcher to keep format=print, got %q", body)
+		}
+	})
+
+	t.Run("dashboard -> English messages, recipes and hints", func(t *testing.T) {
+		prev := eventStart
+		eventStart = time.Now().Add(-24 * time.Hour)
+		t.Cleanup(func() { eventStart = prev })
+
+		// Input: The kanmu dashboard for a browser preferring English
+		req := newAPIRequest(t, http.MethodGet, "/dashboard", kanmuUser, nil)
+		req.Header.Set("Accept-Language", "en-US,en;q=0.9,ja;q=0.8")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: The page, the recipes and the hints in English
+		body := rr.Body.String()
+		for _, expected := range []string{"kanmu&#39;s Dashboard", "🍳 Recipe Collection", "Gyoza", "Log in to the Recipe Site", "Test hint for the login"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %q in the dashboard", expected)
+			}
+		}
+		if strings.Contains(body, "ぎょうざ") {
+			t.Error("Expected the translated recipe name only")
+		}
+	})
+
+	t.Run("recipe JSON -> translated content", func(t *testing.T) {
+		// Input: GET a recipe from the API in English
+		req := newAPIRequest(t, http.MethodGet, apiPrefix+"/recipe/3", kanmuUser, nil)
+		req.Header.Set("Accept-Language", "en")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: The English name and steps
+		var detail RecipeDetailData
+		decodeJSON(t, rr, &detail)
+		if detail.Name != "Ikura and Potatoes" || len(detail.Steps) != 6 || !strings.HasPrefix(detail.Steps[0], "Boil") {
+			t.Errorf("Unexpected recipe %+v", detail)
+		}
+	})
+
+	t.Run("failed login -> English error", func(t *testing.T) {
+		// Input: Wrong credentials from a browser preferring English
+		form := url.Values{"username": {"kanmu"}, "password": {"wrong"}}
+		req := httptest.NewRequestWithContext(context.Background(), http.MethodPost, "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept-Language", "en")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: The login page with the English error
+		if !strings.Contains(rr.Body.String(), "Incorrect username or password") {
+			t.Errorf("Expected the English error, got %q", rr.Body.String())
+		}
+	})
+
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	_ "image/gif" // registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder
+)
+
+// imageSizes are the sizes served besides the original image, by the longest edge in pixels
+var imageSizes = map[string]int{
+	"thumb":  480,
+	"medium": 1280,
+}
+
+const (
+	// maxResizePixels is the largest image that is resized; larger ones are served as they are
+	maxResizePixels = 25_000_000
+	// maxCachedImages bounds the number of image variants kept in memory
+	maxCachedImages = 256
+	// thumbnailQuality is the JPEG quality of the resized images
+	thumbnailQuality = 80
+	// imageCacheControl lets browsers keep images but revalidate them, so an edited image shows at once
+	imageCacheControl = "private, no-cache"
+)
+
+// imagesModified is the Last-Modified of recipes stored without an update time, such as the built-in ones
+var imagesModified = time.Now()
+
+// recipeThumbnailURL returns the path of the image of a recipe resized to one of imageSizes
+func recipeThumbnailURL(id int, size string) string {
+	return recipeImageURL(id) + "&size=" + size
+}
+
+// imageVariant is a recipe image at one size
+type imageVariant struct {
+	once        sync.Once
+	updatedAt   time.Time
+	data        []byte // nil when the original image is served
+	contentType string
+	etag        string
+}
+
+type imageVariantKey struct {
+	id   int
+	size string
+}
+
+// imageCache keeps the resized images and the ETags of the originals
+type imageCache struct {
+	mu       sync.Mutex
+	variants map[imageVariantKey]*imageVariant
+}
+
+var recipeImages = &imageCache{variants: make(map[imageVariantKey]*imageVariant)}
+
+// variant returns the image of the recipe at size ("" for the original), rendering it on first use.
+// Concurrent requests for the same variant wait for a single rendering.
+func (c *imageCache) variant(recipe *Recipe, size string) *imageVariant {
+	key := imageVariantKey{id: recipe.ID, size: size}
+
+	c.mu.Lock()
+	v, ok := c.variants[key]
+	if !ok || !v.updatedAt.Equal(recipe.UpdatedAt) {
+		if !ok && len(c.variants) >= maxCachedImages {
+			for k := range c.variants {
+				delete(c.variants, k)
+				break
+			}
+		}
+		v = &imageVariant{updatedAt: recipe.UpdatedAt}
+		c.variants[key] = v
+	}
+	c.mu.Unlock()
+
+	v.once.Do(func() {
+		v.data, v.contentType = resizeImage(recipe.Image, imageSizes[size])
+		if v.data == nil {
+			v.contentType = recipe.ContentType
+		}
+		sum := sha256.Sum256(v.bytes(recipe))
+		v.etag = `"` + hex.EncodeToString(sum[:12]) + `"`
+	})
+	return v
+}
+
+// bytes returns the encoded image
+func (v *imageVariant) bytes(recipe *Recipe) []byte {
+	if v.data == nil {
+		return recipe.Image
+	}
+	return v.data
+}
+
+// resizeImage scales data down so its longest edge is at most size pixels.
+// It returns nil when the original should be served: no size was asked for, the image is already small enough,
+// or it cannot be decoded or is too large to decode safely.
+// Images with transparency are encoded as PNG, the others as JPEG.
+func resizeImage(data []byte, size int) ([]byte, string) {
+	if size == 0 {
+		return nil, ""
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || max(config.Width, config.Height) <= size || config.Width*config.Height > maxResizePixels {
+		return nil, ""
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ""
+	}
+
+	width, height := size, config.Height*size/config.Width
+	if config.Height > config.Width {
+		width, height = config.Width*size/config.Height, size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if opaque, ok := src.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, ""
+		}
+		return buf.Bytes(), "image/png"
+	}
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil, ""
+	}
+	return buf.Bytes(), "image/jpeg"
+}
+
+// serveRecipeImage serves the image of the recipe at the size given by the size parameter.
+// http.ServeContent answers conditional requests from the ETag and Last-Modified headers, HEAD and Range requests.
+func serveRecipeImage(w http.ResponseWriter, r *http.Request, recipe *Recipe) {
+	size := r.URL.Query().Get("size")
+	if _, ok := imageSizes[size]; size != "" && !ok {
+		respondError(w, r, "Unknown image size", http.StatusBadRequest)
+		return
+	}
+	if len(recipe.Image) == 0 {
+		respondNotFound(w, r)
+		return
+	}
+
+	v := recipeImages.variant(recipe, size)
+	modified := recipe.UpdatedAt
+	if modified.IsZero() {
+		modified = imagesModified
+	}
+	w.Header().Set("Content-Type", v.contentType)
+	w.Header().Set("ETag", v.etag)
+	w.Header().Set("Cache-Control", imageCacheControl)
+	http.ServeContent(w, r, "recipe-"+strconv.Itoa(recipe.ID), modified, bytes.NewReader(v.bytes(recipe)))
+}
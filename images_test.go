@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// encodePNG returns a width x height PNG, transparent unless opaque
+func encodePNG(t *testing.T, width, height int, opaque bool) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	fill := color.NRGBA{R: 255, A: 128}
+	if opaque {
+		fill.A = 255
+	}
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestResizeImage(t *testing.T) {
+	t.Run("opaque image -> JPEG within the size", func(t *testing.T) {
+		// Input: An opaque 1000x500 image resized to 480
+		data, contentType := resizeImage(encodePNG(t, 1000, 500, true), 480)
+
+		// Expected Output: A 480x240 JPEG
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != "jpeg" || contentType != "image/jpeg" {
+			t.Fatalf("Expected a JPEG, got %q %q %v", format, contentType, err)
+		}
+		if config.Width != 480 || config.Height != 240 {
+			t.Errorf("Expected 480x240, got %dx%d", config.Width, config.Height)
+		}
+	})
+
+	t.Run("transparent portrait image -> PNG within the size", func(t *testing.T) {
+		// Input: A transparent 300x600 image resized to 100
+		data, contentType := resizeImage(encodePNG(t, 300, 600, false), 100)
+
+		// Expected Output: A 50x100 PNG keeping the transparency
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != "png" || contentType != "image/png" {
+			t.Fatalf("Expected a PNG, got %q %q %v", format, contentType, err)
+		}
+		if config.Width != 50 || config.Height != 100 {
+			t.Errorf("Expected 50x100, got %dx%d", config.Width, config.Height)
+		}
+	})
+
+	t.Run("small or broken image -> original", func(t *testing.T) {
+		// Input: An image already within the size, and bytes that are not an image
+		// Expected Output: nil, so the original is served
+		if data, _ := resizeImage(encodePNG(t, 10, 10, true), 480); data != nil {
+			t.Error("Expected the small image to be kept")
+		}
+		if data, _ := resizeImage([]byte("not an image"), 480); data != nil {
+			t.Error("Expected the broken image to be kept")
+		}
+	})
+}
+
+func TestServeRecipeImage(t *testing.T) {
+	get := func(t *testing.T, path string, header http.Header) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newAPIRequest(t, http.MethodGet, path, kanmuUser, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("thumbnail -> smaller JPEG with caching headers", func(t *testing.T) {
+		// Input: GET the thumbnail of recipe 2
+		rr := get(t, recipeThumbnailURL(2, "thumb"), nil)
+
+		// Expected Output: A JPEG within the thumbnail size, much smaller than the original
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "image/jpeg" {
+			t.Fatalf("Expected a JPEG, got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		config, _, err := image.DecodeConfig(bytes.NewReader(rr.Body.Bytes()))
+		if err != nil || max(config.Width, config.Height) != imageSizes["thumb"] {
+			t.Errorf("Expected the longest edge to be %d, got %dx%d %v", imageSizes["thumb"], config.Width, config.Height, err)
+		}
+		if rr.Body.Len() >= len(gyozaImage)/10 {
+			t.Errorf("Expected a small thumbnail, got %d bytes", rr.Body.Len())
+		}
+		for _, name := range []string{"ETag", "Last-Modified", "Cache-Control"} {
+			if rr.Header().Get(name) == "" {
+				t.Errorf("Expected the %s header", name)
+			}
+		}
+	})
+
+	t.Run("conditional requests -> 304", func(t *testing.T) {
+		first := get(t, recipeImageURL(2), nil)
+
+		// Input: Requests revalidating the image with its ETag and with its Last-Modified
+		byETag := get(t, recipeImageURL(2), http.Header{"If-None-Match": {first.Header().Get("ETag")}})
+		byDate := get(t, recipeImageURL(2), http.Header{"If-Modified-Since": {first.Header().Get("Last-Modified")}})
+
+		// Expected Output: Not Modified without the image
+		for _, rr := range []*httptest.ResponseRecorder{byETag, byDate} {
+			if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+				t.Errorf("Expected 304 without a body, got %v with %d bytes", rr.Code, rr.Body.Len())
+			}
+		}
+	})
+
+	t.Run("sizes -> different ETags", func(t *testing.T) {
+		// Input: The original and the resized images
+		original := get(t, recipeImageURL(2), nil).Header().Get("ETag")
+		thumb := get(t, recipeThumbnailURL(2, "thumb"), nil).Header().Get("ETag")
+		medium := get(t, recipeThumbnailURL(2, "medium"), nil).Header().Get("ETag")
+
+		// Expected Output: Each representation has its own ETag
+		if original == thumb || thumb == medium || original == medium {
+			t.Errorf("Expected distinct ETags, got %q %q %q", original, thumb, medium)
+		}
+	})
+
+	t.Run("range -> partial content", func(t *testing.T) {
+		// Input: GET the first 100 bytes of the image
+		rr := get(t, recipeImageURL(2), http.Header{"Range": {"bytes=0-99"}})
+
+		// Expected Output: 206 with those bytes
+		if rr.Code != http.StatusPartialContent || !bytes.Equal(rr.Body.Bytes(), gyozaImage[:100]) {
+			t.Errorf("Expected the first 100 bytes, got %v with %d bytes", rr.Code, rr.Body.Len())
+		}
+	})
+
+	t.Run("HEAD -> headers only", func(t *testing.T) {
+		// Input: HEAD the thumbnail
+		req := newAPIRequest(t, http.MethodHead, recipeThumbnailURL(2, "thumb"), kanmuUser, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: The length of the thumbnail without its bytes
+		if rr.Code != http.StatusOK || rr.Body.Len() != 0 || rr.Header().Get("Content-Length") == "" {
+			t.Errorf("Expected headers only, got %v with %d bytes", rr.Code, rr.Body.Len())
+		}
+	})
+
+	t.Run("unknown size -> 400", func(t *testing.T) {
+		// Input: A size that is not served
+		rr := get(t, recipeThumbnailURL(2, "huge"), nil)
+
+		// Expected Output: Bad Request
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %v", rr.Code)
+		}
+	})
+
+	t.Run("edited image -> new ETag and thumbnail", func(t *testing.T) {
+		useRecipes(t)
+		recipe := &Recipe{Owner: kanmuUser, Name: "テスト", Image: encodePNG(t, 1000, 1000, true), ContentType: "image/png"}
+		if err := recipes.Create(context.Background(), recipe); err != nil {
+			t.Fatal(err)
+		}
+		before := get(t, recipeThumbnailURL(recipe.ID, "thumb"), nil)
+
+		// Input: Replace the image, then GET the thumbnail again
+		recipe.Image = encodePNG(t, 1000, 500, true)
+		if err := recipes.Update(context.Background(), recipe); err != nil {
+			t.Fatal(err)
+		}
+		after := get(t, recipeThumbnailURL(recipe.ID, "thumb"), http.Header{"If-None-Match": {before.Header().Get("ETag")}})
+
+		// Expected Output: The thumbnail of the new image
+		if after.Code != http.StatusOK || after.Header().Get("ETag") == before.Header().Get("ETag") {
+			t.Fatalf("Expected a new thumbnail, got %v %q", after.Code, after.Header().Get("ETag"))
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(after.Body.Bytes())); err != nil || config.Height != 240 {
+			t.Errorf("Expected the resized new image, got %+v %v", config, err)
+		}
+	})
+
+	t.Run("recipe without an image -> 404", func(t *testing.T) {
+		useRecipes(t)
+		recipe := &Recipe{Owner: kanmuUser, Name: "テスト"}
+		if err := recipes.Create(context.Background(), recipe); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: GET the image of a recipe that has none
+		rr := get(t, recipeImageURL(recipe.ID), nil)
+
+		// Expected Output: Not Found
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %v", rr.Code)
+		}
+	})
+}
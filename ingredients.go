@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"math/big"
+	"slices"
+)
+
+const ingredientsRoot = "ingredients_list"
+
+// zipUser is the user whose password unlocks flag.zip
+const zipUser = "zip"
+
+// ingredientsArchive is a flag.zip together with the password that unlocks it
+type ingredientsArchive struct {
+	data     []byte
+	password string
+	flag     string
+}
+
+// ingredients is the archive served to players without their own archive.
+// It is the embedded flag.zip unless CTF_GENERATE_INGREDIENTS is set.
+var ingredients = &ingredientsArchive{data: Ingredients}
+
+// ingredientsTemplate is the directory archived into generated flag.zip files, set from CTF_INGREDIENTS_TEMPLATE.
+// The repository only holds the encrypted flag.zip, so that its contents cannot be read from the source.
+var ingredientsTemplate fs.FS
+
+// errNoIngredientsTemplate is returned when a flag.zip is generated without a template
+var errNoIngredientsTemplate = errors.New("generating flag.zip needs CTF_INGREDIENTS_TEMPLATE")
+
+// flagSeed derives generated flags and passwords; set CTF_FLAG_SEED to keep them across restarts
+var flagSeed = newSecret()
+
+const secretAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// deriveSecret derives an alphanumeric secret of length n for label from the flag seed
+func deriveSecret(label string, n int) string {
+	mac := hmac.New(sha256.New, flagSeed)
+	mac.Write([]byte(label))
+	num := new(big.Int).SetBytes(mac.Sum(nil))
+
+	base := big.NewInt(int64(len(secretAlphabet)))
+	digit := new(big.Int)
+	out := make([]byte, n)
+	for i := range out {
+		num.DivMod(num, base, digit)
+		out[i] = secretAlphabet[digit.Int64()]
+	}
+	return string(out)
+}
+
+// generateIngredients builds a flag.zip for team from the template with a derived password and flag.
+// The caller issues the flag once the archive is served, so that the flags of discarded archives are never accepted.
+func generateIngredients(team string) (*ingredientsArchive, error) {
+	if ingredientsTemplate == nil {
+		return nil, errNoIngredientsTemplate
+	}
+	password := deriveSecret("zip-password:"+team, 12)
+	flag := "gocon2025{" + deriveSecret("flag:"+team, 24) + "}"
+
+	data, err := buildEncryptedZip(ingredientsTemplate, ingredientsRoot, password, map[string][]byte{
+		"flag.txt": []byte(flag + "\n"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ingredientsArchive{data: data, password: password, flag: flag}, nil
+}
+
+// usersTable returns the users table of userData as CSV with the zip user's password replaced and an optional flag row appended
+func usersTable(zipPassword, flag string) ([]byte, error) {
+	username := userData.column(usersTableName, "username")
+	password := userData.column(usersTableName, "password")
+
+	records := slices.Clone(userData[usersTableName])
+	for i, record := range records[1:] {
+		if zipPassword != "" && record[username] == zipUser {
+			record = slices.Clone(record)
+			record[password] = zipPassword
+			records[i+1] = record
+		}
+	}
+	if flag != "" {
+		row := make([]string, len(records[0]))
+		row[username] = "flag"
+		row[password] = flag
+		records = append(records, row)
+	}
+	return encodeCSV(records)
+}
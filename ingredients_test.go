@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// testIngredientsTemplate stands in for the organizers' CTF_INGREDIENTS_TEMPLATE directory
+var testIngredientsTemplate = fstest.MapFS{
+	"README.md": {Data: []byte("# テスト用の食材リスト\n")},
+	"apple":     {Data: []byte("apple\n")},
+}
+
+// decryptZipFile reverses writeEncryptedFile for one archive entry
+func decryptZipFile(t *testing.T, f *zip.File, password string) []byte {
+	t.Helper()
+
+	rc, err := f.OpenRaw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z := newZipCrypto(password)
+	plain := make([]byte, len(raw))
+	for i, c := range raw {
+		temp := z.keys[2] | 2
+		plain[i] = c ^ byte((temp*(temp^1))>>8)
+		z.update(plain[i])
+	}
+	if plain[11] != byte(f.CRC32>>24) {
+		t.Fatalf("%s: password check byte mismatch", f.Name)
+	}
+
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(plain[12:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestGenerateIngredients(t *testing.T) {
+	t.Run("archive is encrypted with the derived password and contains the flag", func(t *testing.T) {
+		// Input: Generated archive for a team
+		archive, err := generateIngredients("team-a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(archive.data), int64(len(archive.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Every file is encrypted, flag.txt holds the flag, README matches the template
+		names := map[string]bool{}
+		for _, f := range zr.File {
+			names[f.Name] = true
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if f.Flags&0x1 == 0 {
+				t.Errorf("Expected %s to be encrypted", f.Name)
+			}
+			data := decryptZipFile(t, f, archive.password)
+			switch f.Name {
+			case "ingredients_list/flag.txt":
+				if strings.TrimSpace(string(data)) != archive.flag {
+					t.Errorf("Expected flag %s, got %s", archive.flag, data)
+				}
+			case "ingredients_list/README.md":
+				if !strings.Contains(string(data), "テスト用の食材リスト") {
+					t.Errorf("Expected template README, got %s", data)
+				}
+			}
+		}
+		for _, name := range []string{"ingredients_list/", "ingredients_list/flag.txt", "ingredients_list/apple", "ingredients_list/README.md"} {
+			if !names[name] {
+				t.Errorf("Expected %s in archive", name)
+			}
+		}
+	})
+
+	t.Run("no template -> error", func(t *testing.T) {
+		prev := ingredientsTemplate
+		ingredientsTemplate = nil
+		t.Cleanup(func() { ingredientsTemplate = prev })
+
+		// Input: Generate an archive without CTF_INGREDIENTS_TEMPLATE
+		_, err := generateIngredients("team-a")
+
+		// Expected Output: The template is required
+		if !errors.Is(err, errNoIngredientsTemplate) {
+			t.Errorf("Expected errNoIngredientsTemplate, got %v", err)
+		}
+	})
+
+	t.Run("passwords and flags differ per team and are stable", func(t *testing.T) {
+		// Input: Derived secrets for two teams
+		a := deriveSecret("zip-password:team-a", 12)
+		b := deriveSecret("zip-password:team-b", 12)
+
+		// Expected Output: Different teams differ, the same team is stable
+		if a == b {
+			t.Errorf("Expected different passwords per team")
+		}
+		if a != deriveSecret("zip-password:team-a", 12) || len(a) != 12 {
+			t.Errorf("Expected stable 12 character password, got %q", a)
+		}
+	})
+
+	t.Run("users table carries the zip password", func(t *testing.T) {
+		// Input: Replacement zip password and flag row
+		table, err := usersTable("newpassword", "gocon2025{test}")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: zip user updated, other users untouched, flag row appended
+		body := string(table)
+		for _, expected := range []string{"zip,newpassword", "kanmu,gocon2025", "flag,gocon2025{test}"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %q in users table, got %s", expected, body)
+			}
+		}
+		if strings.Contains(body, "qwerty123456") {
+			t.Errorf("Expected original zip password to be replaced")
+		}
+	})
+}
+
+func TestFlagVerifyHandler(t *testing.T) {
+	prevToken := apiToken
+	apiToken = "organizer"
+	t.Cleanup(func() { apiToken = prevToken })
+
+	archive, err := generateIngredients("team-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags.issue(archive.flag, ingredientsID, "team-verify")
+
+	verify := func(t *testing.T, token, flag string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		form := url.Values{}
+		form.Add("flag", flag)
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/api/flags/verify", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(flagVerifyHandler).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("without token -> unauthorized", func(t *testing.T) {
+		// Input: Request without bearer token
+		rr := verify(t, "", archive.flag)
+
+		// Expected Output: 401
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %v, got %v", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("team flag -> challenge and team", func(t *testing.T) {
+		// Input: Generated flag of team-verify
+		rr := verify(t, "organizer", archive.flag)
+
+		// Expected Output: Valid, issued to team-verify for the ingredients stage
+		var result FlagVerification
+		if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid || result.Team != "team-verify" || result.Challenge != ingredientsID {
+			t.Errorf("Unexpected verification result: %+v", result)
+		}
+	})
+
+	t.Run("unknown flag -> invalid", func(t *testing.T) {
+		// Input: Random string
+		rr := verify(t, "organizer", "gocon2025{nope}")
+
+		// Expected Output: Not valid
+		if !strings.Contains(rr.Body.String(), `"valid":false`) {
+			t.Errorf("Expected invalid result, got %s", rr.Body.String())
+		}
+	})
+}
+
+func TestPerTeamDownload(t *testing.T) {
+	t.Run("each team downloads its own archive and cannot submit another team's flag", func(t *testing.T) {
+		prev := instances
+		instances = newInstanceManager(time.Hour)
+		instances.randomFlags = true
+		board = newScoreboard()
+		t.Cleanup(func() {
+			instances.closeAll()
+			instances = prev
+		})
+
+		a, err := instances.get("team-a", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := instances.get("team-b", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: GET /download/flag.zip as team-a
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/download/flag.zip", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "user", Value: "admin"})
+		req.AddCookie(playerCookie("team-a"))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: team-a's archive
+		if !bytes.Equal(rr.Body.Bytes(), a.ingredients.data) {
+			t.Errorf("Expected team-a's archive")
+		}
+
+		// Input: team-b submits team-a's flag
+		submit := newSubmitRequest(t, "gocon", a.ingredients.flag)
+		submit.AddCookie(playerCookie("team-b"))
+		result := httptest.NewRecorder()
+		http.HandlerFunc(submitHandler).ServeHTTP(result, submit)
+
+		// Expected Output: Rejected and recorded as sharing
+		if !strings.Contains(result.Body.String(), "他のチーム") {
+			t.Errorf("Expected flag sharing message")
+		}
+		found := false
+		for _, share := range flags.sharedFlags() {
+			if share.Team == "team-b" && share.Owner == "team-a" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected flag sharing to be recorded")
+		}
+	})
+}
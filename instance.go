@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	playerCookieName = "ctf_player"
+	// defaultMaxInstances bounds the live instances with a database of their own unless CTF_MAX_INSTANCES is set
+	defaultMaxInstances = 500
+	// defaultMaxInstancesPerClient bounds those created from one client IP address unless CTF_MAX_INSTANCES_PER_CLIENT is set
+	defaultMaxInstancesPerClient = 20
+)
+
+// errTooManyInstances is returned when a new player would exceed the limit of live instances
+var errTooManyInstances = errors.New("too many players, try again later")
+
+// instance is the isolated copy of the challenge state owned by one player
+type instance struct {
+	key         string
+	flag        string
+	ingredients *ingredientsArchive
+	// db holds the tables of the instance, or of every instance when the flags are not random
+	db *tableDatabase
+	// ownsDB is set when db belongs to this instance rather than being the shared database
+	ownsDB bool
+	// client is the IP address of the client that created the instance
+	client string
+
+	mu       sync.Mutex
+	lastSeen time.Time
+	// refs counts the requests using db. A removed instance is closed once the last one releases it.
+	refs    int
+	removed bool
+}
+
+// touch marks the instance as active
+func (i *instance) touch(now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.lastSeen = now
+}
+
+func (i *instance) idleSince() time.Time {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.lastSeen
+}
+
+// acquire marks the instance as used by a request at now
+func (i *instance) acquire(now time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.refs++
+	i.lastSeen = now
+}
+
+// issueFlags registers the random flags of the instance as issued to its player.
+// It is called once the instance is kept, so the flags of discarded instances are never accepted.
+func (i *instance) issueFlags() {
+	if i.flag != "" {
+		flags.issue(i.flag, sqliLoginID, i.key)
+	}
+	if i.ingredients != nil {
+		flags.issue(i.ingredients.flag, ingredientsID, i.key)
+	}
+}
+
+// release ends a use of the instance, closing it if it was removed meanwhile
+func (i *instance) release() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.refs--
+	if i.removed && i.refs == 0 {
+		i.close()
+	}
+}
+
+// retire marks the instance as removed and closes it unless a request still uses it
+func (i *instance) retire() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.removed = true
+	if i.refs == 0 {
+		i.close()
+	}
+}
+
+// close closes the database the instance owns
+func (i *instance) close() {
+	if i.ownsDB {
+		_ = i.db.Close()
+	}
+}
+
+// instanceManager creates instances on demand and removes them after inactivity
+type instanceManager struct {
+	mu          sync.Mutex
+	instances   map[string]*instance
+	ttl         time.Duration
+	max         int
+	randomFlags bool
+
+	// Only the instances owning a database count towards the limits; the others cost next to nothing.
+	// owned counts them, and byClient counts them per client that created them.
+	maxPerClient int
+	owned        int
+	byClient     map[string]int
+
+	// shared is the database of the instances without random flags, whose tables are all the same,
+	// and of the logins of players without an instance. It is opened on first use.
+	sharedMu sync.Mutex
+	shared   *tableDatabase
+}
+
+func newInstanceManager(ttl time.Duration) *instanceManager {
+	return &instanceManager{
+		instances:    make(map[string]*instance),
+		ttl:          ttl,
+		max:          defaultMaxInstances,
+		maxPerClient: defaultMaxInstancesPerClient,
+		byClient:     make(map[string]int),
+	}
+}
+
+var instances = newInstanceManager(30 * time.Minute)
+
+// get returns the instance for key, creating it on first use for client. The caller must release it.
+// A new instance is built without holding m.mu and is refused with errTooManyInstances when it would exceed the limits.
+func (m *instanceManager) get(key, client string) (*instance, error) {
+	now := time.Now()
+	if inst, err := m.acquire(key, client, now); inst != nil || err != nil {
+		return inst, err
+	}
+
+	inst, err := m.build(key, client, now)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Another request for the same player may have created the instance meanwhile
+	if existing, ok := m.instances[key]; ok {
+		inst.close()
+		existing.acquire(now)
+		return existing, nil
+	}
+	if err := m.admit(client); err != nil {
+		inst.close()
+		return nil, err
+	}
+	inst.acquire(now)
+	m.add(key, inst)
+	inst.issueFlags()
+	return inst, nil
+}
+
+// acquire returns the live instance for key, or nil when there is none and a new one may be created for client
+func (m *instanceManager) acquire(key, client string, now time.Time) (*instance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inst, ok := m.instances[key]; ok {
+		inst.acquire(now)
+		return inst, nil
+	}
+	return nil, m.admit(client)
+}
+
+// admit returns errTooManyInstances when a new instance for client would exceed the limits. m.mu must be held.
+func (m *instanceManager) admit(client string) error {
+	if !m.randomFlags {
+		return nil
+	}
+	if m.owned >= m.max || (client != "" && m.byClient[client] >= m.maxPerClient) {
+		return errTooManyInstances
+	}
+	return nil
+}
+
+// add keeps the instance of key and counts it towards the limits. m.mu must be held.
+func (m *instanceManager) add(key string, inst *instance) {
+	m.instances[key] = inst
+	if inst.ownsDB {
+		m.owned++
+		m.byClient[inst.client]++
+	}
+}
+
+// forget takes the instance of key out of the manager and its limits. m.mu must be held.
+func (m *instanceManager) forget(key string, inst *instance) {
+	delete(m.instances, key)
+	if inst.ownsDB {
+		m.owned--
+		if m.byClient[inst.client]--; m.byClient[inst.client] <= 0 {
+			delete(m.byClient, inst.client)
+		}
+	}
+}
+
+// build creates the instance for key and client
+func (m *instanceManager) build(key, client string, now time.Time) (*instance, error) {
+	if m.randomFlags {
+		return newInstance(key, client, now, true, nil)
+	}
+	shared, err := m.sharedDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return newInstance(key, client, now, false, shared)
+}
+
+// sharedDatabase returns the database holding the tables of userData with the password of the served flag.zip
+func (m *instanceManager) sharedDatabase() (*tableDatabase, error) {
+	m.sharedMu.Lock()
+	defer m.sharedMu.Unlock()
+
+	if m.shared != nil {
+		return m.shared, nil
+	}
+	tables, err := instanceTables(ingredients.password, "")
+	if err != nil {
+		return nil, err
+	}
+	if m.shared, err = openTableDatabase(context.Background(), tables); err != nil {
+		return nil, err
+	}
+	return m.shared, nil
+}
+
+// lookup returns an existing instance without creating one
+func (m *instanceManager) lookup(key string) (*instance, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inst, ok := m.instances[key]
+	return inst, ok
+}
+
+type InstanceSummary struct {
+	Key      string    `json:"key"`
+	Flag     string    `json:"flag,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// list returns the live instances, most recently active first
+func (m *instanceManager) list() []InstanceSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]InstanceSummary, 0, len(m.instances))
+	for key, inst := range m.instances {
+		list = append(list, InstanceSummary{Key: key, Flag: inst.flag, LastSeen: inst.idleSince()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen.After(list[j].LastSeen) })
+	return list
+}
+
+// reset removes the instance of key, so that the player gets a fresh one on the next request
+func (m *instanceManager) reset(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inst, ok := m.instances[key]
+	if ok {
+		m.remove(key, inst)
+	}
+	return ok
+}
+
+// reap removes the instances that have been idle for longer than the TTL
+func (m *instanceManager) reap(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, inst := range m.instances {
+		if now.Sub(inst.idleSince()) > m.ttl {
+			m.remove(key, inst)
+		}
+	}
+}
+
+// run reaps idle instances every interval until ctx is done
+func (m *instanceManager) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.reap(now)
+		}
+	}
+}
+
+// closeAll removes every instance and closes the shared database, once no request is served anymore
+func (m *instanceManager) closeAll() {
+	m.mu.Lock()
+	for key, inst := range m.instances {
+		m.forget(key, inst)
+		inst.close()
+	}
+	m.mu.Unlock()
+
+	m.sharedMu.Lock()
+	defer m.sharedMu.Unlock()
+	if m.shared != nil {
+		_ = m.shared.Close()
+		m.shared = nil
+	}
+}
+
+// remove takes the instance out of the manager. Its database is closed when the requests using it are done.
+// m.mu must be held.
+func (m *instanceManager) remove(key string, inst *instance) {
+	m.forget(key, inst)
+	inst.retire()
+}
+
+// newInstance creates the instance of key. Without random flags every instance holds the same tables,
+// so it uses the shared database. With random flags the instance gets its own flag.zip, whose password
+// replaces the zip user's password, and a login flag stored as an extra row so that dumping the table reveals it,
+// loaded into a database of its own.
+func newInstance(key, client string, now time.Time, randomFlags bool, shared *tableDatabase) (*instance, error) {
+	inst := &instance{key: key, client: client, lastSeen: now}
+	if !randomFlags {
+		inst.db = shared
+		return inst, nil
+	}
+
+	var err error
+	if inst.flag, err = newRandomFlag(); err != nil {
+		return nil, err
+	}
+	if inst.ingredients, err = generateIngredients(key); err != nil {
+		return nil, err
+	}
+
+	tables, err := instanceTables(inst.ingredients.password, inst.flag)
+	if err != nil {
+		return nil, err
+	}
+	if inst.db, err = openTableDatabase(context.Background(), tables); err != nil {
+		return nil, err
+	}
+	inst.ownsDB = true
+	return inst, nil
+}
+
+// instanceTables returns the tables of userData as CSV keyed by table name, with the users table of usersTable
+func instanceTables(zipPassword, flag string) (map[string][]byte, error) {
+	users, err := usersTable(zipPassword, flag)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string][]byte{usersTableName: users}
+	for _, name := range userData.tableNames() {
+		if name == usersTableName {
+			continue
+		}
+		if tables[name], err = encodeCSV(userData[name]); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+// archiveFor returns the flag.zip served to the player making the request
+func archiveFor(r *http.Request) *ingredientsArchive {
+	if inst, ok := playerInstance(r); ok && inst.ingredients != nil {
+		return inst.ingredients
+	}
+	return ingredients
+}
+
+func newRandomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newRandomFlag() (string, error) {
+	id, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	return "gocon2025{" + id + "}", nil
+}
+
+// playerCookieKey returns the instance key of the player cookie of the request if its signature is valid
+func playerCookieKey(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(playerCookieName)
+	if err != nil {
+		return "", false
+	}
+	return verifySignedValue(playerPurpose, cookie.Value)
+}
+
+// issuePlayerCookie sets a player cookie for a new random key, signed so that players cannot pick keys, and returns the key
+func issuePlayerCookie(w http.ResponseWriter) (string, error) {
+	key, err := newRandomID()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     playerCookieName,
+		Value:    signValue(playerPurpose, key),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return key, nil
+}
+
+// playerInstance returns the existing instance of the player making the request
+func playerInstance(r *http.Request) (*instance, bool) {
+	key, ok := playerCookieKey(r)
+	if !ok {
+		return nil, false
+	}
+	return instances.lookup(key)
+}
+
+// loginDatabase returns the database the login query of the request runs on, the key of the player
+// and a func to call once the query is done. Only a player with a valid cookie, which the login page issues,
+// gets an instance. Other requests are issued a cookie and query the shared database,
+// so requests that do not keep cookies cannot create instances.
+func loginDatabase(w http.ResponseWriter, r *http.Request) (*tableDatabase, string, func(), error) {
+	if key, ok := playerCookieKey(r); ok {
+		inst, err := instances.get(key, clientIP(r))
+		if err != nil {
+			return nil, "", nil, err
+		}
+		return inst.db, key, inst.release, nil
+	}
+
+	key, err := issuePlayerCookie(w)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	db, err := instances.sharedDatabase()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return db, key, func() {}, nil
+}
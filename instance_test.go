@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// playerCookie returns the signed player cookie of key
+func playerCookie(key string) *http.Cookie {
+	return &http.Cookie{Name: playerCookieName, Value: signValue(playerPurpose, key)}
+}
+
+// pingTableDatabase runs a query on d
+func pingTableDatabase(d *tableDatabase) error {
+	return d.query(context.Background(), func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, "SELECT 1")
+		return err
+	})
+}
+
+func TestInstanceManager(t *testing.T) {
+	t.Run("each player gets an isolated instance", func(t *testing.T) {
+		// Input: Two player keys with random flags
+		m := newInstanceManager(time.Hour)
+		m.randomFlags = true
+		t.Cleanup(m.closeAll)
+
+		a, err := m.get("a", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := m.get("b", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := m.get("a", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Distinct databases and flags, same instance on reuse
+		if a.db == b.db || a.flag == b.flag {
+			t.Errorf("Expected isolated instances")
+		}
+		if again != a {
+			t.Errorf("Expected the same instance for the same key")
+		}
+	})
+
+	t.Run("idle instances are reaped", func(t *testing.T) {
+		// Input: Instance idle for longer than the TTL
+		m := newInstanceManager(time.Minute)
+		m.randomFlags = true
+		t.Cleanup(m.closeAll)
+		inst, err := m.get("idle", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst.release()
+		m.reap(time.Now().Add(2 * time.Minute))
+
+		// Expected Output: Database closed and instance forgotten
+		if err := pingTableDatabase(inst.db); !errors.Is(err, errDatabaseClosed) {
+			t.Errorf("Expected the database to be closed, got %v", err)
+		}
+		if _, ok := m.lookup("idle"); ok {
+			t.Errorf("Expected idle instance to be forgotten")
+		}
+	})
+
+	t.Run("instance removed while in use -> closed after release", func(t *testing.T) {
+		// Input: Reset an instance while a request still holds it, then release it
+		m := newInstanceManager(time.Hour)
+		m.randomFlags = true
+		t.Cleanup(m.closeAll)
+		inst, err := m.get("busy", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.reset("busy")
+
+		// Expected Output: The database stays usable until the release
+		if err := pingTableDatabase(inst.db); err != nil {
+			t.Errorf("Expected the database to stay open while in use: %v", err)
+		}
+		inst.release()
+		if err := pingTableDatabase(inst.db); !errors.Is(err, errDatabaseClosed) {
+			t.Errorf("Expected the database to be closed after the release, got %v", err)
+		}
+	})
+
+	t.Run("limit reached -> no new instance", func(t *testing.T) {
+		// Input: A manager limited to one instance with its own database, asked for two
+		m := newInstanceManager(time.Hour)
+		m.randomFlags = true
+		m.max = 1
+		t.Cleanup(m.closeAll)
+		if _, err := m.get("first", ""); err != nil {
+			t.Fatal(err)
+		}
+		_, err := m.get("second", "")
+
+		// Expected Output: The second player is refused, the first one keeps its instance
+		if !errors.Is(err, errTooManyInstances) {
+			t.Errorf("Expected errTooManyInstances, got %v", err)
+		}
+		if _, err := m.get("first", ""); err != nil {
+			t.Errorf("Expected the existing instance, got %v", err)
+		}
+	})
+
+	t.Run("discarded instance -> flags not issued", func(t *testing.T) {
+		// Input: An instance built with random flags but not kept, as when another request wins the race
+		m := newInstanceManager(time.Hour)
+		m.randomFlags = true
+		t.Cleanup(m.closeAll)
+		discarded, err := m.build("discarded", "", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		discarded.close()
+		kept, err := m.get("kept", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Only the flags of the kept instance are issued, to its player
+		for _, flag := range []string{discarded.flag, discarded.ingredients.flag} {
+			if _, ok := flags.lookup(flagSHA256(flag)); ok {
+				t.Errorf("Expected the flag %s of the discarded instance not to be issued", flag)
+			}
+		}
+		for _, flag := range []string{kept.flag, kept.ingredients.flag} {
+			if issued, ok := flags.lookup(flagSHA256(flag)); !ok || issued.Team != "kept" {
+				t.Errorf("Expected the flag %s issued to kept, got %+v", flag, issued)
+			}
+		}
+	})
+
+	t.Run("instances on the shared database -> not limited", func(t *testing.T) {
+		// Input: A manager limited to one instance, asked for two that use the shared database
+		m := newInstanceManager(time.Hour)
+		m.max = 1
+		m.maxPerClient = 1
+		t.Cleanup(m.closeAll)
+		_, firstErr := m.get("first", "192.0.2.1")
+		_, secondErr := m.get("second", "192.0.2.1")
+
+		// Expected Output: Both are created
+		if firstErr != nil || secondErr != nil {
+			t.Errorf("Expected both instances, got %v and %v", firstErr, secondErr)
+		}
+	})
+
+	t.Run("client limit reached -> no new instance for that client", func(t *testing.T) {
+		// Input: A manager allowing one instance per client, asked for two from one client and one from another
+		m := newInstanceManager(time.Hour)
+		m.randomFlags = true
+		m.maxPerClient = 1
+		t.Cleanup(m.closeAll)
+		if _, err := m.get("first", "192.0.2.1"); err != nil {
+			t.Fatal(err)
+		}
+		_, againErr := m.get("second", "192.0.2.1")
+		_, otherErr := m.get("third", "192.0.2.2")
+
+		// Expected Output: Only the second one from the same client is refused, until the first one is reset
+		if !errors.Is(againErr, errTooManyInstances) || otherErr != nil {
+			t.Errorf("Expected errTooManyInstances and nil, got %v and %v", againErr, otherErr)
+		}
+		m.reset("first")
+		if _, err := m.get("second", "192.0.2.1"); err != nil {
+			t.Errorf("Expected a new instance after the reset, got %v", err)
+		}
+	})
+
+	t.Run("login without a valid player cookie -> no instance", func(t *testing.T) {
+		useUserData(t, userData)
+
+		// Input: A login without a player cookie, and one with a forged key
+		first := postLogin(t, "kanmu", "gocon2025")
+		form := url.Values{"username": {"kanmu"}, "password": {"gocon2025"}}
+		req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: playerCookieName, Value: "forged"})
+		forged := httptest.NewRecorder()
+		loginHandler(forged, req)
+
+		// Expected Output: Both log in and get a signed cookie, but no instance is created
+		for _, rr := range []*httptest.ResponseRecorder{first, forged} {
+			if rr.Code != http.StatusFound {
+				t.Errorf("Expected status %v, got %v", http.StatusFound, rr.Code)
+			}
+			cookie := responseCookie(rr, playerCookieName)
+			if _, ok := verifySignedValue(playerPurpose, cookie); !ok {
+				t.Errorf("Expected a signed player cookie, got %q", cookie)
+			}
+		}
+		if list := instances.list(); len(list) != 0 {
+			t.Errorf("Expected no instance, got %v", list)
+		}
+	})
+
+	t.Run("login with the issued cookie -> instance created", func(t *testing.T) {
+		useUserData(t, userData)
+
+		// Input: GET the login page, then log in with its player cookie
+		page := httptest.NewRecorder()
+		loginPageHandler(page, newAPIRequest(t, http.MethodGet, "/", "", nil))
+		form := url.Values{"username": {"kanmu"}, "password": {"gocon2025"}}
+		req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: playerCookieName, Value: responseCookie(page, playerCookieName)})
+		loginHandler(httptest.NewRecorder(), req)
+
+		// Expected Output: The instance of the issued key
+		key, _ := verifySignedValue(playerPurpose, responseCookie(page, playerCookieName))
+		if _, ok := instances.lookup(key); !ok {
+			t.Errorf("Expected an instance for %s, got %v", key, instances.list())
+		}
+	})
+
+	t.Run("hardened login -> no player cookie or instance", func(t *testing.T) {
+		useUserData(t, userData)
+		setMode(t, modeHardened)
+		instances.max = 0
+
+		// Input: GET the login page, then log in with its cookies while no instance can be created
+		page := httptest.NewRecorder()
+		loginPageHandler(page, newAPIRequest(t, http.MethodGet, "/", "", nil))
+		rr := postLogin(t, "kanmu", "gocon2025")
+
+		// Expected Output: Logged in without a player cookie or an instance
+		if rr.Code != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, rr.Code)
+		}
+		if responseCookie(page, playerCookieName) != "" || responseCookie(rr, playerCookieName) != "" {
+			t.Errorf("Expected no player cookie in hardened mode")
+		}
+		if list := instances.list(); len(list) != 0 {
+			t.Errorf("Expected no instance, got %v", list)
+		}
+	})
+
+	t.Run("concurrent logins do not interfere", func(t *testing.T) {
+		// Input: Concurrent logins from different players
+		var wg sync.WaitGroup
+		codes := make([]int, 10)
+		for i := range codes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rr := postLogin(t, "kanmu", "gocon2025")
+				codes[i] = rr.Code
+			}()
+		}
+		wg.Wait()
+
+		// Expected Output: Every login succeeds
+		for i, code := range codes {
+			if code != http.StatusFound {
+				t.Errorf("Login %d: expected status %v, got %v", i, http.StatusFound, code)
+			}
+		}
+	})
+}
+
+func TestRandomInstanceFlag(t *testing.T) {
+	t.Run("SQL injection reveals the instance flag which solves the login stage", func(t *testing.T) {
+		prev := instances
+		instances = newInstanceManager(time.Hour)
+		instances.randomFlags = true
+		board = newScoreboard()
+		t.Cleanup(func() {
+			instances.closeAll()
+			instances = prev
+		})
+
+		inst, err := instances.get("player-1", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		inst.release()
+
+		// Input: SQL injection from the player's browser
+		form := "username=" + "admin'+OR+'1'%3D'1'+--" + "&password=test"
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/login", strings.NewReader(form))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(playerCookie("player-1"))
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(loginHandler).ServeHTTP(rr, req)
+
+		// Expected Output: Flag row dumped and accepted on submit
+		if !strings.Contains(rr.Body.String(), inst.flag) {
+			t.Fatalf("Expected instance flag in SQL injection result")
+		}
+
+		submit := newSubmitRequest(t, "kanmu", inst.flag)
+		submit.AddCookie(playerCookie("player-1"))
+		result := httptest.NewRecorder()
+		http.HandlerFunc(submitHandler).ServeHTTP(result, submit)
+		if !board.solved("player-1", sqliLoginID) {
+			t.Errorf("Expected login stage to be solved")
+		}
+
+		// Expected Output: The flag is not accepted from another player
+		if _, err := matchFlag("gocon", inst.flag, nil); !errors.Is(err, errSharedFlag) {
+			t.Errorf("Expected errSharedFlag, got %v", err)
+		}
+	})
+}
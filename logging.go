@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// attackLog records suspicious requests as JSON lines. Like requests.jsonl, every line has a request_id,
+// a title and a body; it is discarded unless CTF_ATTACK_LOG is set.
+var attackLog = slog.New(slog.DiscardHandler)
+
+// newLogHandler returns the handler of the request log, "json" or text
+func newLogHandler(w io.Writer, format string) (slog.Handler, error) {
+	switch format {
+	case "", "text":
+		return slog.NewTextHandler(w, nil), nil
+	case "json":
+		return slog.NewJSONHandler(w, nil), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %q", format)
+	}
+}
+
+// newAttackLogHandler writes attack events as JSON lines whose message is the title
+func newAttackLogHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.MessageKey {
+				a.Key = "title"
+			}
+			return a
+		},
+	})
+}
+
+// openAttackLog opens the attack log at path for appending; "-" is standard output
+func openAttackLog(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+type requestIDKey struct{}
+
+// requestID returns the ID logRequests gave the request, or ""
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// statusRecorder remembers the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// logRequests gives every request an ID, checks it for attacks, and logs it and records its metrics once it is served
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id, err := newRandomID()
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		id = id[:16]
+		w.Header().Set("X-Request-Id", id)
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+
+		inspectRequest(r, start)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		latency := time.Since(start)
+		observeRequest(r, rec.status, latency)
+
+		user, _ := currentUser(r)
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", latency),
+			slog.String("user", user),
+			slog.String("remote_ip", clientIP(r)),
+		)
+	})
+}
+
+// Kinds of attack events
+const (
+	attackSQLInjection      = "sql_injection"
+	attackRecipeEnumeration = "recipe_enumeration"
+	attackFormatProbing     = "format_probing"
+)
+
+// logAttack writes an attack event for the request
+func logAttack(r *http.Request, kind, title, body string, attrs ...slog.Attr) {
+	user, _ := currentUser(r)
+	attrs = append([]slog.Attr{
+		slog.String("request_id", requestID(r.Context())),
+		slog.String("body", body),
+		slog.String("kind", kind),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("user", user),
+		slog.String("remote_ip", clientIP(r)),
+	}, attrs...)
+	attackLog.LogAttrs(r.Context(), slog.LevelWarn, title, attrs...)
+}
+
+// sqlMetacharacters are the characters and comments that change the meaning of the login query
+var sqlMetacharacters = []string{"'", `"`, ";", "--", "/*", "*/"}
+
+// checkLoginFields logs an attack when the login fields contain SQL metacharacters.
+// The event names the fields and shows the username; the password is never logged, even when it is an injection.
+func checkLoginFields(r *http.Request, username, password string) {
+	var fields []string
+	for _, field := range []struct{ name, value string }{{"username", username}, {"password", password}} {
+		if slices.ContainsFunc(sqlMetacharacters, func(m string) bool { return strings.Contains(field.value, m) }) {
+			fields = append(fields, field.name)
+		}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	logAttack(r, attackSQLInjection, "SQL metacharacters in login",
+		fmt.Sprintf("%s contains SQL metacharacters: username=%q", strings.Join(fields, ", "), username),
+		slog.Any("fields", fields),
+	)
+}
+
+// enumerationThreshold distinct recipe IDs requested by one client within enumerationWindow are logged as enumeration
+const (
+	enumerationThreshold = 5
+	enumerationWindow    = time.Minute
+)
+
+type recipeVisits struct {
+	since time.Time
+	ids   []int
+}
+
+// enumerationDetector counts the distinct recipe IDs each client requests
+type enumerationDetector struct {
+	mu     sync.Mutex
+	visits map[string]*recipeVisits
+}
+
+var recipeEnumeration = &enumerationDetector{visits: make(map[string]*recipeVisits)}
+
+// visit records a request for recipe id and returns the IDs of the window when it reaches the threshold
+func (d *enumerationDetector) visit(client string, id int, now time.Time) []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	v, ok := d.visits[client]
+	if !ok || now.Sub(v.since) > enumerationWindow {
+		v = &recipeVisits{since: now}
+		d.visits[client] = v
+	}
+	if slices.Contains(v.ids, id) {
+		return nil
+	}
+	v.ids = append(v.ids, id)
+	if len(v.ids) < enumerationThreshold {
+		return nil
+	}
+	delete(d.visits, client)
+	return v.ids
+}
+
+// prune forgets the windows that ended before now
+func (d *enumerationDetector) prune(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for client, v := range d.visits {
+		if now.Sub(v.since) > enumerationWindow {
+			delete(d.visits, client)
+		}
+	}
+}
+
+// run prunes the windows every interval until ctx is done
+func (d *enumerationDetector) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.prune(now)
+		}
+	}
+}
+
+// inspectRequest logs recipe enumeration and probing of the format parameter
+func inspectRequest(r *http.Request, now time.Time) {
+	idStr, ok := strings.CutPrefix(pagePath(r), "/recipe/")
+	if !ok {
+		return
+	}
+
+	if format := r.URL.Query().Get("format"); format != "" && !slices.Contains(recipeFormats, format) {
+		logAttack(r, attackFormatProbing, "Unknown recipe format",
+			fmt.Sprintf("format=%q is not one of %s", format, strings.Join(recipeFormats, ", ")),
+			slog.String("format", format),
+		)
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return
+	}
+	client := clientIP(r)
+	if user, ok := currentUser(r); ok {
+		client = "user:" + user
+	}
+	if ids := recipeEnumeration.visit(client, id, now); ids != nil {
+		logAttack(r, attackRecipeEnumeration, "Recipe enumeration",
+			fmt.Sprintf("%d recipe IDs requested within %s: %v", len(ids), enumerationWindow, ids),
+			slog.Any("ids", ids),
+		)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useAttackLog captures the attack log and starts enumeration detection afresh
+func useAttackLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	prevLog, prevDetector := attackLog, recipeEnumeration
+	attackLog = slog.New(newAttackLogHandler(&buf))
+	recipeEnumeration = &enumerationDetector{visits: make(map[string]*recipeVisits)}
+	t.Cleanup(func() { attackLog, recipeEnumeration = prevLog, prevDetector })
+	return &buf
+}
+
+// attackEvents decodes the JSON lines of the attack log
+func attackEvents(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var events []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var event map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Expected a JSON line, got %s: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestLogRequests(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	// Input: GET /recipe/999 as kanmu through the middleware
+	req := newAPIRequest(t, http.MethodGet, "/recipe/999", "kanmu", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	logRequests(router).ServeHTTP(rr, req)
+
+	// Expected Output: One line with the request, its status and the user, under the ID sent back
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log line, got %s", buf.String())
+	}
+	expected := map[string]any{
+		"msg":        "request",
+		"method":     http.MethodGet,
+		"path":       "/recipe/999",
+		"status":     float64(http.StatusNotFound),
+		"user":       "kanmu",
+		"remote_ip":  "192.0.2.1",
+		"request_id": rr.Header().Get("X-Request-Id"),
+	}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, entry[key])
+		}
+	}
+	if _, ok := entry["latency"]; !ok {
+		t.Error("Expected the latency")
+	}
+}
+
+func TestAttackLog(t *testing.T) {
+	t.Run("SQL metacharacters in login fields", func(t *testing.T) {
+		buf := useAttackLog(t)
+
+		// Input: A normal login and a SQL injection
+		postLogin(t, "kanmu", "gocon2025")
+		postLogin(t, "' OR 1=1 --", "x")
+
+		// Expected Output: One event in the requests.jsonl shape naming the field
+		events := attackEvents(t, buf)
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %v", events)
+		}
+		event := events[0]
+		for _, key := range []string{"request_id", "title", "body"} {
+			if _, ok := event[key].(string); !ok {
+				t.Errorf("Expected a %s string, got %v", key, event)
+			}
+		}
+		if event["kind"] != attackSQLInjection || !strings.Contains(event["body"].(string), "' OR 1=1 --") {
+			t.Errorf("Unexpected event %v", event)
+		}
+		if fields, _ := event["fields"].([]any); len(fields) != 1 || fields[0] != "username" {
+			t.Errorf("Expected the username field, got %v", event["fields"])
+		}
+	})
+
+	t.Run("SQL metacharacters in the password -> password not logged", func(t *testing.T) {
+		buf := useAttackLog(t)
+
+		// Input: A password with SQL metacharacters
+		postLogin(t, "kanmu", "secret' OR '1'='1")
+
+		// Expected Output: An event naming the password field without its value
+		events := attackEvents(t, buf)
+		if len(events) != 1 {
+			t.Fatalf("Expected 1 event, got %v", events)
+		}
+		if fields, _ := events[0]["fields"].([]any); len(fields) != 1 || fields[0] != "password" {
+			t.Errorf("Expected the password field, got %v", events[0]["fields"])
+		}
+		if strings.Contains(buf.String(), "secret") {
+			t.Errorf("Expected the password to stay out of the log, got %s", buf)
+		}
+	})
+
+	t.Run("recipe enumeration", func(t *testing.T) {
+		buf := useAttackLog(t)
+
+		// Input: One recipe twice, then distinct IDs up to the threshold
+		handler := logRequests(router)
+		for _, id := range []string{"1", "1", "2", "3", "4", "5"} {
+			handler.ServeHTTP(httptest.NewRecorder(), newAPIRequest(t, http.MethodGet, "/recipe/"+id, "alice", nil))
+		}
+
+		// Expected Output: One event listing the IDs
+		events := attackEvents(t, buf)
+		if len(events) != 1 || events[0]["kind"] != attackRecipeEnumeration || events[0]["user"] != "alice" {
+			t.Fatalf("Expected one enumeration event, got %v", events)
+		}
+		if ids, _ := events[0]["ids"].([]any); len(ids) != enumerationThreshold {
+			t.Errorf("Expected %d IDs, got %v", enumerationThreshold, events[0]["ids"])
+		}
+	})
+
+	t.Run("enumeration window expires", func(t *testing.T) {
+		d := &enumerationDetector{visits: make(map[string]*recipeVisits)}
+		now := time.Now()
+
+		// Input: Distinct IDs spread over more than the window
+		var logged []int
+		for i := range enumerationThreshold {
+			logged = d.visit("user:alice", i, now.Add(time.Duration(i)*enumerationWindow/2))
+		}
+
+		// Expected Output: Not enumeration
+		if logged != nil {
+			t.Errorf("Expected no enumeration, got %v", logged)
+		}
+	})
+
+	t.Run("format probing", func(t *testing.T) {
+		buf := useAttackLog(t)
+
+		// Input: Known and unknown format values
+		handler := logRequests(router)
+		for _, format := range []string{"image", "../../etc/passwd", "imagex"} {
+			handler.ServeHTTP(httptest.NewRecorder(), newAPIRequest(t, http.MethodGet, "/recipe/1?format="+format, "alice", nil))
+		}
+
+		// Expected Output: An event for each unknown value
+		events := attackEvents(t, buf)
+		if len(events) != 2 {
+			t.Fatalf("Expected 2 events, got %v", events)
+		}
+		for i, format := range []string{"../../etc/passwd", "imagex"} {
+			if events[i]["kind"] != attackFormatProbing || events[i]["format"] != format {
+				t.Errorf("Expected probing with %q, got %v", format, events[i])
+			}
+		}
+	})
+}
@@ -5,35 +5,28 @@ import (
 	"context"
 	"database/sql"
 	_ "embed"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
-
-	"github.com/nao1215/filesql"
+	"syscall"
+	"time"
 )
 
 //go:embed assets/users.csv
 var usersCSV []byte
 
-//go:embed assets/login.html
-var loginHTML []byte
-
-//go:embed assets/not_found.html
-var notFoundHTML []byte
-
 //go:embed assets/ingredients_list.zip
 var Ingredients []byte
 
-//go:embed assets/dashboard.html
-var dashboardHTML []byte
-
-//go:embed assets/recipe_detail.html
-var recipeDetailHTML []byte
-
 //go:embed assets/gyoza.jpg
 var gyozaImage []byte
 
@@ -50,12 +43,18 @@ var sashimiImage []byte
 var steakSauceImage []byte
 
 type LoginData struct {
-	Error string
+	Error string `json:"error,omitempty"`
+	// User is the logged in user, set only in JSON responses
+	User string `json:"user,omitempty"`
+	// Users lists every matched user when the login query returned more than one row
+	Users []User `json:"users,omitempty"`
+	// CanRegister shows the registration link, which only exists in hardened mode
+	CanRegister bool `json:"-"`
 }
 
 type User struct {
-	Username string
-	Password string
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 const kanmuUser = "kanmu"
@@ -65,102 +64,380 @@ type Recipe struct {
 	Name        string
 	Description string
 	Emoji       string
+	Owner       string
+	Visibility  Visibility
+	SharedWith  []string
 	Image       []byte
 	ContentType string
 	Steps       []string
+	// Translations holds the content in other languages by language.
+	// Name, Description and Steps are in the language the owner wrote them in.
+	Translations map[string]RecipeText
+	// UpdatedAt is set by the repository when the recipe is created or updated. It is zero for the built-in recipes.
+	UpdatedAt time.Time
+}
+
+// RecipeText is the content of a recipe in one language
+type RecipeText struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Steps       []string `json:"steps,omitempty"`
+}
+
+// text returns the content of the recipe in lang. Fields without a translation keep the original content.
+func (recipe *Recipe) text(lang string) RecipeText {
+	text := RecipeText{Name: recipe.Name, Description: recipe.Description, Steps: recipe.Steps}
+	translation := recipe.Translations[lang]
+	if translation.Name != "" {
+		text.Name = translation.Name
+	}
+	if translation.Description != "" {
+		text.Description = translation.Description
+	}
+	if len(translation.Steps) > 0 {
+		text.Steps = translation.Steps
+	}
+	return text
 }
 
 type DashboardRecipe struct {
-	ID          int
-	Name        string
-	Description string
-	Emoji       string
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Emoji       string `json:"emoji"`
+	ImageURL    string `json:"image_url,omitempty"`
 }
 
 type DashboardData struct {
-	Title          string
-	WelcomeMessage string
-	Recipes        []DashboardRecipe
+	Title          string            `json:"title"`
+	WelcomeMessage string            `json:"welcome_message"`
+	Recipes        []DashboardRecipe `json:"recipes"`
+	Hints          []HintView        `json:"hints"`
+	Error          string            `json:"error,omitempty"`
+	LogoutToken    string            `json:"-"`
 }
 
 type RecipeDetailData struct {
-	ID           int
-	Name         string
-	Description  string
-	Emoji        string
-	Steps        []string
-	ShowDownload bool
+	ID           int      `json:"id"`
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Emoji        string   `json:"emoji"`
+	Steps        []string `json:"steps"`
+	ImageURL     string   `json:"image_url,omitempty"`
+	ShowDownload bool     `json:"show_download"`
+	CanEdit      bool     `json:"can_edit"`
+	CSRFToken    string   `json:"-"`
 }
 
 // Constants and utilities
 const (
-	flagFilename  = "flag.zip"
-	tmpFilePrefix = "/tmp/users.csv"
+	flagFilename = "flag.zip"
+	flagRecipeID = 13
 )
 
-// renderTemplate renders a template with data and handles errors
-func renderTemplate(w http.ResponseWriter, templateData []byte, data any, templateName string) error {
-	tmpl, err := template.New(templateName).Parse(string(templateData))
-	if err != nil {
-		return err
+// requireAuth checks for authentication and redirects if not authenticated.
+// JSON requests get 401 instead of a redirect.
+func requireAuth(w http.ResponseWriter, r *http.Request) (string, bool) {
+	user, ok := currentUser(r)
+	if !ok {
+		respondUnauthorized(w, r)
+		return "", false
 	}
+	return user, true
+}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	return tmpl.Execute(w, data)
+// respondUnauthorized sends the client back to log in, or answers 401 to JSON requests
+func respondUnauthorized(w http.ResponseWriter, r *http.Request) {
+	if wantsJSON(r) {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-// requireAuth checks for authentication and redirects if not authenticated
-func requireAuth(w http.ResponseWriter, r *http.Request) (string, bool) {
+// currentUser returns the logged in user.
+// In vulnerable mode the raw user cookie is trusted, in hardened mode only a signed session cookie is.
+func currentUser(r *http.Request) (string, bool) {
+	if mode.hardened() {
+		cookie, err := r.Cookie(sessionCookieName)
+		if err != nil {
+			return "", false
+		}
+		s, ok := lookupSession(cookie.Value)
+		if !ok {
+			return "", false
+		}
+		return s.User, true
+	}
+
 	cookie, err := r.Cookie("user")
 	if err != nil {
-		http.Redirect(w, r, "/", http.StatusFound)
 		return "", false
 	}
 	return cookie.Value, true
 }
 
-// createTempDatabase creates temporary database file and returns connection
-func createTempDatabase() (*sql.DB, string, error) {
-	tmpFile := tmpFilePrefix
-	if err := os.WriteFile(tmpFile, usersCSV, 0600); err != nil {
-		return nil, "", err
+// setLoginCookie stores the logged in user in a cookie.
+// In hardened mode a server side session is created and only its signed token is sent.
+func setLoginCookie(w http.ResponseWriter, r *http.Request, username string) error {
+	if mode.hardened() {
+		s, token, err := createSession(username)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, newSessionCookie(r, token, s.ExpiresAt))
+		return nil
 	}
 
-	db, err := filesql.Open(tmpFile)
-	if err != nil {
-		_ = os.Remove(tmpFile) //nolint:errcheck // Temp file cleanup
-		return nil, "", err
+	http.SetCookie(w, &http.Cookie{
+		Name:  "user",
+		Value: username,
+		Path:  "/",
+	})
+	return nil
+}
+
+// findUsers returns the users of the plaintext users table matching the credentials.
+// While the login stage is played the query is built with fmt.Sprintf and is open to SQL injection;
+// hardened mode uses accounts instead.
+func findUsers(ctx context.Context, conn *sql.Conn, username, password string) (*sql.Rows, error) {
+	if !vulnerable(sqliLoginID) {
+		return conn.QueryContext(ctx, "SELECT username, password FROM users WHERE username = ? AND password = ?", username, password)
 	}
-	return db, tmpFile, nil
+	return conn.QueryContext(ctx, loginQuery(username, password))
 }
 
-// cleanup removes temporary file and closes database
-func cleanup(db *sql.DB, tmpFile string) {
-	if db != nil {
-		_ = db.Close()
+// maxLoginRows bounds the users a login query returns, so an injected query generating rows cannot exhaust memory
+const maxLoginRows = 1000
+
+// loginQuery returns the SQL findUsers runs for the credentials
+func loginQuery(username, password string) string {
+	return fmt.Sprintf("SELECT username, password FROM users WHERE username='%s' AND password='%s'", username, password)
+}
+
+// canViewRecipe is the single authorization check for a recipe, its image and its attachments.
+// While the IDOR stage is played any logged in user can view any recipe.
+func canViewRecipe(user string, recipe *Recipe) bool {
+	if !vulnerable(recipeIDORID) {
+		return recipe.visibleTo(user)
 	}
-	_ = os.Remove(tmpFile) //nolint:errcheck // Temp file cleanup
+	return true
 }
 
 func main() {
-	http.HandleFunc("/", loginHandler)
-	http.HandleFunc("/login", loginHandler)
-	http.HandleFunc("/dashboard", dashboardHandler)
-	http.HandleFunc("/recipe/", recipeHandler)
-	http.HandleFunc("/download/", downloadHandler)
-
-	fmt.Println("Server starting on http://localhost:8080")
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	if len(os.Args) > 1 && os.Args[1] == "users" {
+		if err := runUsersCommand(context.Background(), os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	modeFlag := flag.String("mode", os.Getenv("CTF_MODE"), `"vulnerable" or "hardened"`)
+	serverCfg, err := registerServerFlags(flag.CommandLine, os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.Parse()
+
+	// SIGINT and SIGTERM stop the background loops and shut the server down gracefully
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	handler, err := newLogHandler(os.Stderr, os.Getenv("CTF_LOG_FORMAT"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(slog.New(handler))
+	if path := os.Getenv("CTF_ATTACK_LOG"); path != "" {
+		f, err := openAttackLog(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		attackLog = slog.New(newAttackLogHandler(f))
+	}
+	go recipeEnumeration.run(ctx, time.Minute)
+
+	if dir := os.Getenv("CTF_TEMPLATE_DIR"); dir != "" {
+		t, err := newPageTemplates(os.DirFS(dir), true)
+		if err != nil {
+			log.Fatal(err)
+		}
+		templates = t
+		slog.Info("reloading templates from disk", "dir", dir)
+	}
+
+	m, err := parseMode(*modeFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mode = m
+	if secret := os.Getenv("SESSION_SECRET"); secret != "" {
+		sessionSecret = []byte(secret)
+	}
+	if ttl := os.Getenv("SESSION_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessionTTL = d
+	}
+	secureCookies = os.Getenv("SESSION_COOKIE_SECURE") == "true"
+	if path := os.Getenv("SESSION_STORE"); path != "" {
+		store, err := openFileSessionStore(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions = store
+	}
+
+	if ttl := os.Getenv("CTF_INSTANCE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatal(err)
+		}
+		instances.ttl = d
+	}
+	if value := os.Getenv("CTF_MAX_INSTANCES"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CTF_MAX_INSTANCES: %q", value)
+		}
+		instances.max = n
+	}
+	if value := os.Getenv("CTF_MAX_INSTANCES_PER_CLIENT"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CTF_MAX_INSTANCES_PER_CLIENT: %q", value)
+		}
+		instances.maxPerClient = n
+	}
+	instances.randomFlags = os.Getenv("CTF_RANDOM_FLAGS") == "true"
+	go instances.run(ctx, time.Minute)
+
+	if digest := os.Getenv("FLAG_SHA256"); digest != "" {
+		flagDigest = strings.ToLower(digest)
+	} else if instances.randomFlags {
+		// Only the flag of each team's own flag.zip solves the final stage
+		flagDigest = ""
+	}
+	if seed := os.Getenv("CTF_FLAG_SEED"); seed != "" {
+		flagSeed = []byte(seed)
+	}
+	if dir := os.Getenv("CTF_INGREDIENTS_TEMPLATE"); dir != "" {
+		ingredientsTemplate = os.DirFS(dir)
+	}
+	if instances.randomFlags && ingredientsTemplate == nil {
+		// Every instance generates its own flag.zip
+		log.Fatal(errNoIngredientsTemplate)
+	}
+	if os.Getenv("CTF_GENERATE_INGREDIENTS") == "true" {
+		archive, err := generateIngredients("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		ingredients = archive
+		flagDigest = flagSHA256(archive.flag)
+		flags.issue(archive.flag, ingredientsID, "")
+	}
+	apiToken = os.Getenv("CTF_API_TOKEN")
+	if user := os.Getenv("CTF_ADMIN_USER"); user != "" {
+		adminUser = user
+	}
+	adminPassword = os.Getenv("CTF_ADMIN_PASSWORD")
+	if path := os.Getenv("CTF_HINTS"); path != "" {
+		texts, err := loadHintTexts(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		hintTexts = texts
+	}
+	if start := os.Getenv("CTF_EVENT_START"); start != "" {
+		t, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			log.Fatal(err)
+		}
+		eventStart = t
+	}
+
+	if path := os.Getenv("RECIPE_DB"); path != "" {
+		repo, err := openSQLiteRecipeRepository(ctx, path, recipeDatabase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer repo.Close()
+		recipes = repo
+	}
+
+	if path := os.Getenv("USERS_DB"); path != "" {
+		store, err := openSQLiteUserStore(ctx, path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer store.Close()
+		accounts = store
+	}
+	if path := os.Getenv("CTF_USERS_DATA"); path != "" {
+		data, err := loadDataset(ctx, path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		userData = data
+	}
+	if mode.hardened() {
+		if err := seedAccounts(ctx, accounts, userData[usersTableName]); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	enabled, err := registry.Enabled(splitList(os.Getenv("CTF_CHALLENGES")))
+	if err != nil {
+		log.Fatal(err)
+	}
+	enabledChallenges = enabled
+
+	if stages, err := parseRateLimitedStages(os.Getenv("CTF_RATE_LIMIT")); err != nil {
+		log.Fatal(err)
+	} else {
+		rateLimitedStages = stages
+	}
+	if value := os.Getenv("CTF_RATE_LIMIT_PER_MINUTE"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CTF_RATE_LIMIT_PER_MINUTE: %q", value)
+		}
+		loginLimiter = newRateLimiter(n, loginLimiter.lockoutAfter)
+	}
+	if value := os.Getenv("CTF_LOCKOUT_AFTER"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			log.Fatalf("invalid CTF_LOCKOUT_AFTER: %q", value)
+		}
+		loginLimiter.lockoutAfter = n
+	}
+	trustProxy = os.Getenv("CTF_TRUST_PROXY") == "true"
+	go loginLimiter.run(ctx, time.Minute)
+
+	ln, err := new(net.ListenConfig).Listen(ctx, "tcp", serverCfg.addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("server starting", "addr", ln.Addr().String(), "mode", mode)
+	err = serve(ctx, serverCfg.newServer(logRequests(newRouter(enabledChallenges))), ln, serverCfg.shutdownTimeout)
+	// Remove the temporary directories and databases of the players once no request uses them
+	instances.closeAll()
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.Info("server stopped")
 }
 
-// recipeDatabase contains all recipe data
+// recipeDatabase contains the built-in recipes used to seed the recipe repository
 var recipeDatabase = map[int]*Recipe{
 	2: {
 		ID:          2,
+		Owner:       kanmuUser,
+		Visibility:  VisibilityPrivate,
 		Name:        "ぎょうざ",
 		Description: "パリッとした食感が楽しめる手作りぎょうざ。キャベツとニラの旨みが詰まった定番の中華料理です。",
 		Emoji:       "🥟",
@@ -174,9 +451,25 @@ var recipeDatabase = map[int]*Recipe{
 			"フライパンに油を熱し、ぎょうざを並べる",
 			"底面に焼き色がついたら水を加えて蓋をし、蒸し焼きにする",
 		},
+		Translations: map[string]RecipeText{
+			langEN: {
+				Name:        "Gyoza",
+				Description: "Handmade gyoza with a crispy bottom. A classic Chinese dish packed with the flavor of cabbage and garlic chives.",
+				Steps: []string{
+					"Mix 300g of ground pork with soy sauce, sake and sesame oil",
+					"Finely chop napa cabbage and garlic chives, salt them and squeeze out the water",
+					"Combine the meat and vegetables to make the filling",
+					"Wrap the filling in gyoza wrappers",
+					"Heat oil in a frying pan and line up the gyoza",
+					"Once the bottoms are browned, add water, cover and steam-fry",
+				},
+			},
+		},
 	},
 	3: {
 		ID:          3,
+		Owner:       kanmuUser,
+		Visibility:  VisibilityPrivate,
 		Name:        "いくらとポテト",
 		Description: "プチプチのいくらとホクホクポテトの贅沢な組み合わせ。見た目も美しく、特別な日にぴったりの一品です。",
 		Emoji:       "🥔",
@@ -190,9 +483,24 @@ var recipeDatabase = map[int]*Recipe{
 			"いくら50gを上に乗せる",
 			"お好みでバターと塩コショウで味付けする",
 		},
+		Translations: map[string]RecipeText{
+			langEN: {
+				Name:        "Ikura and Potatoes",
+				Description: "A luxurious pairing of popping salmon roe and fluffy potatoes. Beautiful to look at and perfect for a special day.",
+				Steps: []string{
+					"Boil 4 potatoes with their skins on",
+					"Boil for 20-25 minutes until a bamboo skewer slides through",
+					"Cool them in cold water right away and peel them",
+					"Cut them into bite-sized pieces and arrange them on a plate",
+					"Top with 50g of ikura",
+					"Season with butter, salt and pepper to taste",
+				},
+			},
+		},
 	},
 	4: {
 		ID:          4,
+		Visibility:  VisibilityPrivate,
 		Name:        "さしみ料理",
 		Description: "新鮮な魚の旨みを存分に味わえる日本料理の代表格。包丁使いと盛り付けが美しさの決め手です。",
 		Emoji:       "🍣",
@@ -206,9 +514,25 @@ var recipeDatabase = map[int]*Recipe{
 			"大根のつまと一緒に盛り付ける",
 			"美しく器に盛って完成",
 		},
+		Translations: map[string]RecipeText{
+			langEN: {
+				Name:        "Sashimi Platter",
+				Description: "A signature Japanese dish that brings out the flavor of fresh fish. Knife skills and presentation are the keys to its beauty.",
+				Steps: []string{
+					"Prepare fresh sashimi-grade fish",
+					"Sharpen your knife",
+					"Slice the fish to a suitable thickness",
+					"Serve with wasabi and soy sauce",
+					"Arrange with shredded daikon radish",
+					"Plate it beautifully and you are done",
+				},
+			},
+		},
 	},
 	5: {
 		ID:          5,
+		Owner:       kanmuUser,
+		Visibility:  VisibilityPrivate,
 		Name:        "ピザ",
 		Description: "手作り生地で作る本格的なマルゲリータピザ。トマトソースとモッツァレラチーズのシンプルな美味しさ。",
 		Emoji:       "🍕",
@@ -222,9 +546,26 @@ var recipeDatabase = map[int]*Recipe{
 			"チーズとお好みの具材をのせる",
 			"220度のオーブンで12-15分焼く",
 		},
+		Translations: map[string]RecipeText{
+			langEN: {
+				Name:        "Pizza",
+				Description: "An authentic Margherita pizza with handmade dough. The simple taste of tomato sauce and mozzarella.",
+				Steps: []string{
+					"Mix 200g of bread flour, 50g of cake flour and 1 teaspoon of salt",
+					"Dissolve 3g of dry yeast in 140ml of lukewarm water",
+					"Knead the flour with the yeast water and let it rise for 15 minutes",
+					"Roll out the dough thinly and spread pizza sauce on it",
+					"Top with cheese and your favorite toppings",
+					"Bake in a 220°C oven for 12-15 minutes",
+				},
+			},
+		},
 	},
 	13: {
 		ID:          13,
+		Owner:       "admin",
+		Visibility:  VisibilityShared,
+		SharedWith:  []string{"gocon", "vandle", "zip"},
 		Name:        "ステーキソース",
 		Description: "お肉を引き立てる特製ソース。玉ねぎ、りんご、にんにくの絶妙なバランスで、ステーキが格段に美味しくなります！",
 		Emoji:       "🥩",
@@ -238,170 +579,301 @@ var recipeDatabase = map[int]*Recipe{
 			"みりんを加えて煮詰める",
 			"全てが混ざり合い、とろみがついたら完成",
 		},
+		Translations: map[string]RecipeText{
+			langEN: {
+				Name:        "Steak Sauce",
+				Description: "A special sauce that brings out the best in meat. With a perfect balance of onion, apple and garlic, it makes steak taste so much better!",
+				Steps: []string{
+					"Sauté the onion",
+					"Add the apple",
+					"Add the garlic",
+					"Add the soy sauce",
+					"Add the mirin and simmer it down",
+					"It is done when everything has blended together and thickened",
+				},
+			},
+		},
 	},
 }
 
+// getRecipe returns the recipe from the repository, or nil if it cannot be loaded
 func getRecipe(id int) *Recipe {
-	return recipeDatabase[id]
+	recipe, err := recipes.Get(context.Background(), id)
+	if err != nil {
+		return nil
+	}
+	return recipe
 }
 
-func getRecipeDetailData(id int) *RecipeDetailData {
-	recipe := recipeDatabase[id]
+func getRecipeDetailData(id int, lang string) *RecipeDetailData {
+	recipe := getRecipe(id)
 	if recipe == nil {
 		return nil
 	}
+	return newRecipeDetailData(recipe, lang)
+}
 
-	return &RecipeDetailData{
+func newRecipeDetailData(recipe *Recipe, lang string) *RecipeDetailData {
+	text := recipe.text(lang)
+	detail := &RecipeDetailData{
 		ID:           recipe.ID,
-		Name:         recipe.Name,
-		Description:  recipe.Description,
+		Name:         text.Name,
+		Description:  text.Description,
 		Emoji:        recipe.Emoji,
-		Steps:        recipe.Steps,
-		ShowDownload: id == 13, // Only steak sauce recipe shows download
+		Steps:        text.Steps,
+		ShowDownload: recipe.ID == flagRecipeID && ingredientsEnabled(), // Only steak sauce recipe shows download
+	}
+	if len(recipe.Image) > 0 {
+		detail.ImageURL = recipeImageURL(recipe.ID)
 	}
+	return detail
 }
 
-// Moved above - now uses recipeDatabase
-
+// recipeHandler serves /recipe/{id} as HTML and /api/v1/recipe/{id} as JSON
 func recipeHandler(w http.ResponseWriter, r *http.Request) {
-	_, authenticated := requireAuth(w, r)
+	user, authenticated := requireAuth(w, r)
 	if !authenticated {
 		return
 	}
 
-	path := r.URL.Path
-	idStr := strings.TrimPrefix(path, "/recipe/")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		showNotFound(w)
+	w.Header().Add("Vary", "Accept")
+	format, ok := recipeFormat(r)
+	if !ok {
+		respondError(w, r, "Not Acceptable: format must be one of "+strings.Join(recipeFormats, ", "), http.StatusNotAcceptable)
 		return
 	}
 
-	recipe := getRecipe(id)
-	if recipe == nil {
-		showNotFound(w)
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		respondNotFound(w, r)
 		return
 	}
 
-	// Authentication already verified by requireAuth
+	recipe, err := recipes.Get(r.Context(), id)
+	if errors.Is(err, errRecipeNotFound) || (err == nil && !canViewRecipe(user, recipe)) {
+		respondNotFound(w, r)
+		return
+	}
+	if err != nil {
+		respondError(w, r, "Database Error", http.StatusInternalServerError)
+		return
+	}
 
-	if strings.Contains(r.URL.Query().Get("format"), "image") {
-		w.Header().Set("Content-Type", recipe.ContentType)
-		if _, err := w.Write(recipe.Image); err != nil {
-			http.Error(w, "Image Error", http.StatusInternalServerError)
-		}
+	recipeViews.inc(strconv.Itoa(id))
+	if format == formatImage {
+		serveRecipeImage(w, r, recipe)
 		return
 	}
 
 	// レシピ詳細データを取得
-	recipeDetail := getRecipeDetailData(id)
-	if recipeDetail == nil {
-		showNotFound(w)
-		return
+	lang := requestLanguage(r)
+	recipeDetail := newRecipeDetailData(recipe, lang)
+	recipeDetail.CanEdit = canEditRecipe(user, recipe)
+	if recipeDetail.CanEdit {
+		recipeDetail.CSRFToken = recipeCSRFToken(r)
 	}
 
-	if err := renderTemplate(w, recipeDetailHTML, recipeDetail, "recipe"); err != nil {
-		http.Error(w, "Template Error", http.StatusInternalServerError)
+	switch format {
+	case formatJSON:
+		writeJSON(w, http.StatusOK, recipeDetail)
+	case formatMarkdown:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", markdownDisposition(recipe.ID))
+		_, _ = io.WriteString(w, recipeMarkdown(lang, recipeDetail, imageDataURL(recipe)))
+	default:
+		page := "recipe_detail"
+		if format == formatPrint {
+			page = "recipe_print"
+		}
+		if err := renderTemplate(w, r, http.StatusOK, page, recipeDetail); err != nil {
+			http.Error(w, "Template Error", http.StatusInternalServerError)
+		}
 	}
 }
 
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
-	_, authenticated := requireAuth(w, r)
+	user, authenticated := requireAuth(w, r)
 	if !authenticated {
 		return
 	}
 
-	path := r.URL.Path
-	filename := strings.TrimPrefix(path, "/download/")
+	filename := r.PathValue("filename")
+
+	// flag.zip is attached to the steak sauce recipe and shares its authorization
+	if filename == flagFilename && ingredientsEnabled() {
+		recipe, err := recipes.Get(r.Context(), flagRecipeID)
+		if errors.Is(err, errRecipeNotFound) || (err == nil && !canViewRecipe(user, recipe)) {
+			respondNotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Database Error", http.StatusInternalServerError)
+			return
+		}
 
-	// Authentication already verified by requireAuth
-	if filename == flagFilename {
+		archive := archiveFor(r)
 		w.Header().Set("Content-Type", "application/zip")
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", flagFilename))
-		w.Header().Set("Content-Length", strconv.Itoa(len(Ingredients)))
+		w.Header().Set("Content-Length", strconv.Itoa(len(archive.data)))
 
-		if _, err := w.Write(Ingredients); err != nil {
+		flagZipDownloads.inc()
+		activity.recordDownload(Download{At: time.Now(), IP: clientIP(r), Player: playerKey(r), User: user, File: flagFilename})
+		if _, err := w.Write(archive.data); err != nil {
 			http.Error(w, "Download Error", http.StatusInternalServerError)
 		}
 		return
 	}
 
-	showNotFound(w)
+	showNotFound(w, r)
 }
 
-func showNotFound(w http.ResponseWriter) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusNotFound)
-	if _, err := w.Write(notFoundHTML); err != nil {
+func showNotFound(w http.ResponseWriter, r *http.Request) {
+	if err := renderTemplate(w, r, http.StatusNotFound, "not_found", nil); err != nil {
 		http.Error(w, "Template Error", http.StatusInternalServerError)
 	}
 }
 
-func loginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodGet {
-		if err := renderTemplate(w, loginHTML, LoginData{}, "login"); err != nil {
-			http.Error(w, "Template Error", http.StatusInternalServerError)
+// authenticate returns the users matching the credentials and the player whose users table was queried.
+// Hardened mode checks the bcrypt hashes in accounts and touches no player instance,
+// vulnerable mode runs the login query against the player's users table.
+func authenticate(w http.ResponseWriter, r *http.Request, username, password string) ([]User, string, error) {
+	if mode.hardened() {
+		account, err := verifyPassword(r.Context(), username, password)
+		if errors.Is(err, errUserNotFound) {
+			return nil, "", nil
 		}
-		return
-	}
-
-	if r.Method == http.MethodPost {
-		username := r.FormValue("username")
-		password := r.FormValue("password")
-
-		db, tmpFile, err := createTempDatabase()
 		if err != nil {
-			http.Error(w, "Database Error", http.StatusInternalServerError)
-			return
+			return nil, "", err
 		}
-		defer cleanup(db, tmpFile)
+		return []User{{Username: account.Username}}, "", nil
+	}
 
-		query := fmt.Sprintf("SELECT username, password FROM users WHERE username='%s' AND password='%s'", username, password)
-		rows, err := db.QueryContext(context.Background(), query)
+	db, player, release, err := loginDatabase(w, r)
+	if err != nil {
+		return nil, "", err
+	}
+	defer release()
+	users, err := queryUsers(r.Context(), db, username, password)
+	return users, player, err
+}
+
+// queryUsers runs the login query against db and returns at most maxLoginRows users
+func queryUsers(ctx context.Context, db *tableDatabase, username, password string) ([]User, error) {
+	var users []User
+	err := db.query(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		rows, err := findUsers(ctx, conn, username, password)
 		if err != nil {
-			http.Error(w, "Database Error", http.StatusInternalServerError)
-			return
+			return err
 		}
 		defer rows.Close()
 
-		var users []User
-		for rows.Next() {
+		for len(users) < maxLoginRows && rows.Next() {
 			var user User
 			if err := rows.Scan(&user.Username, &user.Password); err != nil {
 				continue
 			}
 			users = append(users, user)
 		}
+		return rows.Err()
+	})
+	return users, err
+}
 
-		if err := rows.Err(); err != nil {
-			http.Error(w, "Database Error", http.StatusInternalServerError)
+// loginPageHandler serves the login form and, in vulnerable mode, issues the player cookie the login needs for an instance
+func loginPageHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := playerCookieKey(r); !ok && !mode.hardened() {
+		if _, err := issuePlayerCookie(w); err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+	}
+	if err := renderTemplate(w, r, http.StatusOK, "login", LoginData{CanRegister: mode.hardened()}); err != nil {
+		http.Error(w, "Template Error", http.StatusInternalServerError)
+	}
+}
 
-		if len(users) == 0 {
-			if err := renderTemplate(w, loginHTML, LoginData{Error: "ユーザー名またはパスワードが間違っています"}, "login"); err != nil {
-				http.Error(w, "Template Error", http.StatusInternalServerError)
-			}
-			return
+// loginHandler logs users in; /api/v1/login answers with JSON
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readAccountRequest(w, r)
+	if err != nil {
+		respondError(w, r, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	checkLoginFields(r, req.Username, req.Password)
+
+	attempt := LoginAttempt{At: time.Now(), IP: clientIP(r), Username: req.Username}
+	if vulnerable(sqliLoginID) {
+		attempt.Query = loginQuery(req.Username, req.Password)
+	}
+
+	limitKeys := loginLimitKeys(r, req.Username)
+	if wait := loginLimiter.reserve(limitKeys...); wait > 0 {
+		attempt.Result = loginRateLimited
+		activity.recordLogin(attempt)
+		logins.inc(attempt.Result)
+		respondTooManyRequests(w, r, wait)
+		return
+	}
+
+	users, player, err := authenticate(w, r, req.Username, req.Password)
+	if errors.Is(err, errTooManyInstances) {
+		respondError(w, r, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	attempt.Player = player
+	attempt.Matched = len(users)
+	switch {
+	case err != nil:
+		attempt.Result = loginError
+	case len(users) == 0:
+		attempt.Result = loginFailed
+	case len(users) > 1:
+		attempt.Result = loginDumpedUsers
+	default:
+		attempt.Result = loginSucceeded
+	}
+	activity.recordLogin(attempt)
+	logins.inc(attempt.Result)
+	if err != nil {
+		respondError(w, r, "Database Error", http.StatusInternalServerError)
+		return
+	}
+
+	if len(users) == 0 {
+		loginLimiter.fail(limitKeys...)
+		status := http.StatusOK
+		if wantsJSON(r) {
+			status = http.StatusUnauthorized
 		}
+		respond(w, r, status, "login", LoginData{Error: localize(r, "login.failed"), CanRegister: mode.hardened()})
+		return
+	}
 
-		if len(users) > 1 {
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			fmt.Fprint(w, "<h1>全ユーザー情報</h1><table border='1'><tr><th>ユーザー名</th><th>パスワード</th></tr>")
-			for _, user := range users {
-				fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td></tr>", user.Username, user.Password)
-			}
-			fmt.Fprint(w, "</table>")
+	if len(users) > 1 {
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusOK, LoginData{Users: users})
 			return
 		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<h1>%s</h1><table border='1'><tr><th>%s</th><th>%s</th></tr>",
+			localize(r, "login.all_users"), localize(r, "login.username_column"), localize(r, "login.password_column"))
+		for _, user := range users {
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td></tr>", user.Username, user.Password)
+		}
+		fmt.Fprint(w, "</table>")
+		return
+	}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:  "user",
-			Value: users[0].Username,
-			Path:  "/",
-		})
-		http.Redirect(w, r, "/dashboard", http.StatusFound)
+	loginLimiter.succeed(limitKeys...)
+	if err := setLoginCookie(w, r, users[0].Username); err != nil {
+		respondError(w, r, "Session Error", http.StatusInternalServerError)
+		return
 	}
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, LoginData{User: users[0].Username})
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
 }
 
 func dashboardHandler(w http.ResponseWriter, r *http.Request) {
@@ -410,29 +882,54 @@ func dashboardHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var data DashboardData
+	player, _, _ := playerIdentity(r, user)
+	data, err := requestDashboardData(r, user, player, time.Now())
+	if err != nil {
+		respondError(w, r, "Database Error", http.StatusInternalServerError)
+		return
+	}
+	respond(w, r, http.StatusOK, "dashboard", data)
+}
+
+// requestDashboardData builds the dashboard shown in response to r, with the logout token of its login cookie
+func requestDashboardData(r *http.Request, user, player string, now time.Time) (DashboardData, error) {
+	data, err := getDashboardData(r.Context(), requestLanguage(r), user, player, now)
+	if err != nil {
+		return DashboardData{}, err
+	}
+	data.LogoutToken = logoutCSRFToken(r)
+	return data, nil
+}
+
+// getDashboardData builds the dashboard of the user in lang: the recipes they may view and the hints of player at now
+func getDashboardData(ctx context.Context, lang, user, player string, now time.Time) (DashboardData, error) {
+	visible, err := listVisibleRecipes(ctx, user)
+	if err != nil {
+		return DashboardData{}, err
+	}
 
+	data := DashboardData{
+		Title:          translate(lang, "dashboard.title"),
+		WelcomeMessage: translate(lang, "dashboard.welcome", user),
+		Recipes:        []DashboardRecipe{},
+		Hints:          playerHints(lang, player, now),
+	}
 	if user == kanmuUser {
-		data = DashboardData{
-			Title:          "kanmuのダッシュボード",
-			WelcomeMessage: fmt.Sprintf("🎉 こんにちは、%sさん！あなたの美味しいレシピコレクションをお楽しみください。", user),
-			Recipes: []DashboardRecipe{
-				{ID: 2, Name: "ぎょうざ", Description: "パリッとした食感が楽しめる手作りぎょうざ", Emoji: "🥟"},
-				{ID: 3, Name: "いくらとポテト", Description: "プチプチのいくらとホクホクポテトの贅沢な一品", Emoji: "🥔"},
-				{ID: 5, Name: "ピザ", Description: "手作り生地で作る本格的なマルゲリータピザ", Emoji: "🍕"},
-			},
+		data.Title = translate(lang, "dashboard.owner_title", kanmuUser)
+		data.WelcomeMessage = translate(lang, "dashboard.owner_welcome", user)
+	}
+	for _, recipe := range visible {
+		text := recipe.text(lang)
+		dashboardRecipe := DashboardRecipe{
+			ID:          recipe.ID,
+			Name:        text.Name,
+			Description: text.Description,
+			Emoji:       recipe.Emoji,
 		}
-	} else {
-		data = DashboardData{
-			Title:          "レシピダッシュボード",
-			WelcomeMessage: fmt.Sprintf("✨ こんにちは、%sさん！利用可能なレシピをご覧ください。", user),
-			Recipes: []DashboardRecipe{
-				{ID: 13, Name: "ステーキソース", Description: "お肉を引き立てる特製ソース。隠し味で絶品に！", Emoji: "🥩"},
-			},
+		if len(recipe.Image) > 0 {
+			dashboardRecipe.ImageURL = recipeThumbnailURL(recipe.ID, "thumb")
 		}
+		data.Recipes = append(data.Recipes, dashboardRecipe)
 	}
-
-	if err := renderTemplate(w, dashboardHTML, data, "dashboard"); err != nil {
-		http.Error(w, "Template Error", http.StatusInternalServerError)
-	}
+	return data, nil
 }
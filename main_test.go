@@ -3,13 +3,34 @@ package main
 import (
 	"bytes"
 	"context"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// router serves every challenge, as main does by default
+var router http.Handler
+
+func TestMain(m *testing.M) {
+	bcryptCost = bcrypt.MinCost
+	ingredientsTemplate = testIngredientsTemplate
+	hintTexts = testHintTexts
+	router = newRouter(enabledChallenges)
+	if err := seedAccounts(context.Background(), accounts, userData[usersTableName]); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	instances.closeAll()
+	os.Exit(code)
+}
+
 func TestLoginHandler(t *testing.T) {
 	t.Run("GET login page", func(t *testing.T) {
 		// Input: GET request to "/"
@@ -19,8 +40,7 @@ func TestLoginHandler(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(loginHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: Login page with status 200
 		if status := rr.Code; status != http.StatusOK {
@@ -237,8 +257,7 @@ func TestRecipeHandler(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(recipeHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: Redirect to login
 		if status := rr.Code; status != http.StatusFound {
@@ -255,8 +274,7 @@ func TestRecipeHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(recipeHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: Gyoza recipe page with cooking steps
 		if status := rr.Code; status != http.StatusOK {
@@ -286,8 +304,7 @@ func TestRecipeHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(recipeHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: 404 Not Found page
 		if status := rr.Code; status != http.StatusNotFound {
@@ -337,8 +354,7 @@ func TestRecipeHandler(t *testing.T) {
 				req.AddCookie(&http.Cookie{Name: "user", Value: tc.user})
 
 				rr := httptest.NewRecorder()
-				handler := http.HandlerFunc(recipeHandler)
-				handler.ServeHTTP(rr, req)
+				router.ServeHTTP(rr, req)
 
 				// Expected Output: Access granted due to vulnerability
 				if status := rr.Code; status != http.StatusOK {
@@ -362,8 +378,7 @@ func TestRecipeHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(recipeHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: JPEG image data
 		if status := rr.Code; status != http.StatusOK {
@@ -389,8 +404,7 @@ func TestRecipeHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "admin"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(recipeHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: Recipe page with download button
 		if status := rr.Code; status != http.StatusOK {
@@ -420,8 +434,7 @@ func TestDownloadHandler(t *testing.T) {
 		}
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(downloadHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: Redirect to login
 		if status := rr.Code; status != http.StatusFound {
@@ -438,8 +451,7 @@ func TestDownloadHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "admin"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(downloadHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: ZIP file download with proper headers
 		if status := rr.Code; status != http.StatusOK {
@@ -470,8 +482,7 @@ func TestDownloadHandler(t *testing.T) {
 		req.AddCookie(&http.Cookie{Name: "user", Value: "admin"})
 
 		rr := httptest.NewRecorder()
-		handler := http.HandlerFunc(downloadHandler)
-		handler.ServeHTTP(rr, req)
+		router.ServeHTTP(rr, req)
 
 		// Expected Output: 404 Not Found
 		if status := rr.Code; status != http.StatusNotFound {
@@ -540,7 +551,7 @@ func TestGetRecipeDetailData(t *testing.T) {
 		for _, tc := range testCases {
 			t.Run(tc.name, func(t *testing.T) {
 				// Input: Recipe ID for regular recipe
-				recipeDetail := getRecipeDetailData(tc.id)
+				recipeDetail := getRecipeDetailData(tc.id, langJA)
 
 				// Expected Output: Detail data without download button
 				if recipeDetail == nil {
@@ -562,7 +573,7 @@ func TestGetRecipeDetailData(t *testing.T) {
 
 	t.Run("steak sauce recipe: ID 13 -> detail data with download", func(t *testing.T) {
 		// Input: Recipe ID 13 (steak sauce)
-		recipeDetail := getRecipeDetailData(13)
+		recipeDetail := getRecipeDetailData(13, langJA)
 
 		// Expected Output: Detail data with download button enabled
 		if recipeDetail == nil {
@@ -582,7 +593,7 @@ func TestGetRecipeDetailData(t *testing.T) {
 
 	t.Run("non-existent recipe: ID 999 -> nil", func(t *testing.T) {
 		// Input: Non-existent recipe ID
-		recipeDetail := getRecipeDetailData(999)
+		recipeDetail := getRecipeDetailData(999, langJA)
 
 		// Expected Output: nil
 		if recipeDetail != nil {
@@ -598,10 +609,6 @@ func TestEmbeddedAssets(t *testing.T) {
 			data []byte
 		}{
 			{"usersCSV", usersCSV},
-			{"loginHTML", loginHTML},
-			{"notFoundHTML", notFoundHTML},
-			{"dashboardHTML", dashboardHTML},
-			{"recipeDetailHTML", recipeDetailHTML},
 			{"Ingredients", Ingredients},
 			{"gyozaImage", gyozaImage},
 			{"ikuraPotatoImage", ikuraPotatoImage},
@@ -631,16 +638,217 @@ func TestEmbeddedAssets(t *testing.T) {
 	})
 
 	t.Run("HTML template content -> expected UI elements", func(t *testing.T) {
-		// Input: Embedded HTML template data
-		// Expected Output: Contains expected Japanese text and CSS classes
-		if !bytes.Contains(loginHTML, []byte("レシピサイト")) {
-			t.Errorf("loginHTML does not contain expected title")
+		testCases := []struct {
+			page     string
+			data     any
+			expected string
+		}{
+			{"login", LoginData{}, "レシピサイト"},
+			{"dashboard", DashboardData{}, "レシピコレクション"},
+			{"recipe_detail", RecipeDetailData{}, "recipe-card"},
+		}
+
+		for _, tc := range testCases {
+			// Input: Embedded HTML page template rendered in Japanese
+			var buf bytes.Buffer
+			if err := templates.execute(&buf, langJA, nil, tc.page, tc.data); err != nil {
+				t.Fatal(err)
+			}
+
+			// Expected Output: Contains expected Japanese text and CSS classes
+			if !bytes.Contains(buf.Bytes(), []byte(tc.expected)) {
+				t.Errorf("%s does not contain %q", tc.page, tc.expected)
+			}
+		}
+	})
+}
+
+// setMode switches the application mode for the duration of the test
+func setMode(t *testing.T, m appMode) {
+	t.Helper()
+
+	prev := mode
+	mode = m
+	t.Cleanup(func() { mode = prev })
+}
+
+// newSessionToken creates a session for the user and returns its signed token
+func newSessionToken(t *testing.T, user string) string {
+	t.Helper()
+
+	_, token, err := createSession(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func postLogin(t *testing.T, username, password string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{}
+	form.Add("username", username)
+	form.Add("password", password)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(loginHandler)
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestParseMode(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected appMode
+		wantErr  bool
+	}{
+		{"", modeVulnerable, false},
+		{"vulnerable", modeVulnerable, false},
+		{"hardened", modeHardened, false},
+		{"secure", "", true},
+	}
+
+	for _, tc := range testCases {
+		// Input: CTF_MODE value
+		m, err := parseMode(tc.input)
+
+		// Expected Output: Parsed mode or error
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseMode(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+		}
+		if m != tc.expected {
+			t.Errorf("parseMode(%q) = %v, want %v", tc.input, m, tc.expected)
+		}
+	}
+}
+
+func TestHardenedMode(t *testing.T) {
+	t.Run("SQL injection: admin' OR '1'='1' --/test -> rejected", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: POST with SQL injection payload
+		rr := postLogin(t, "admin' OR '1'='1' --", "test")
+
+		// Expected Output: Login error, no user data exposed
+		body := rr.Body.String()
+		if !strings.Contains(body, "ユーザー名またはパスワードが間違っています") {
+			t.Errorf("Expected error message, but not found")
 		}
-		if !bytes.Contains(dashboardHTML, []byte("レシピコレクション")) {
-			t.Errorf("dashboardHTML does not contain expected title")
+		if strings.Contains(body, "全ユーザー情報") || strings.Contains(body, "Adm1n$ecur3") {
+			t.Errorf("Expected no user data in hardened mode")
 		}
-		if !bytes.Contains(recipeDetailHTML, []byte("recipe-card")) {
-			t.Errorf("recipeDetailHTML does not contain expected class")
+	})
+
+	t.Run("valid login: kanmu/gocon2025 -> signed session cookie", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		// Input: POST with valid credentials
+		rr := postLogin(t, "kanmu", "gocon2025")
+
+		// Expected Output: Redirect with HttpOnly session cookie and no user cookie
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		var session *http.Cookie
+		for _, cookie := range rr.Result().Cookies() {
+			if cookie.Name == "user" {
+				t.Errorf("Expected no plaintext user cookie in hardened mode")
+			}
+			if cookie.Name == sessionCookieName {
+				session = cookie
+			}
+		}
+		if session == nil {
+			t.Fatal("Expected session cookie to be set")
+		}
+		if !session.HttpOnly {
+			t.Errorf("Expected session cookie to be HttpOnly")
+		}
+
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/dashboard", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(session)
+		dashboard := httptest.NewRecorder()
+		http.HandlerFunc(dashboardHandler).ServeHTTP(dashboard, req)
+		if !strings.Contains(dashboard.Body.String(), "kanmuのダッシュボード") {
+			t.Errorf("Expected session cookie to authenticate kanmu")
+		}
+	})
+
+	t.Run("forged cookies -> redirect to login", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		testCases := []struct {
+			name   string
+			cookie *http.Cookie
+		}{
+			{"plaintext user cookie", &http.Cookie{Name: "user", Value: "kanmu"}},
+			{"unsigned session cookie", &http.Cookie{Name: sessionCookieName, Value: "kanmu"}},
+			{"tampered signature", &http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, "admin") + "00"}},
+			{"signed token without session", &http.Cookie{Name: sessionCookieName, Value: signValue(sessionPurpose, "unknown:9999999999")}},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: GET /dashboard with forged cookie
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/dashboard", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.AddCookie(tc.cookie)
+
+				rr := httptest.NewRecorder()
+				http.HandlerFunc(dashboardHandler).ServeHTTP(rr, req)
+
+				// Expected Output: Redirect to login
+				if status := rr.Code; status != http.StatusFound {
+					t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+				}
+			})
+		}
+	})
+
+	t.Run("recipe ownership checks", func(t *testing.T) {
+		setMode(t, modeHardened)
+
+		testCases := []struct {
+			name     string
+			user     string
+			recipeID string
+			status   int
+		}{
+			{"kanmu accessing own gyoza", "kanmu", "2", http.StatusOK},
+			{"admin accessing kanmu's gyoza", "admin", "2", http.StatusNotFound},
+			{"admin accessing hidden sashimi", "admin", "4", http.StatusNotFound},
+			{"kanmu accessing admin's steak sauce", "kanmu", "13", http.StatusNotFound},
+			{"admin accessing own steak sauce", "admin", "13", http.StatusOK},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: GET /recipe/{id} with signed session
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/recipe/"+tc.recipeID, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, tc.user)})
+
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: Only the owner gets the recipe
+				if status := rr.Code; status != tc.status {
+					t.Errorf("Expected status %v, got %v", tc.status, status)
+				}
+			})
 		}
 	})
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric is a metric family written in the Prometheus text format
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+// metrics are the families served at /metrics, in order
+var metrics []metric
+
+func register[M metric](m M) M {
+	metrics = append(metrics, m)
+	return m
+}
+
+var (
+	httpRequests = register(newCounterVec("ctf_http_requests_total",
+		"HTTP requests by route pattern, method and status.", "route", "method", "status"))
+	httpRequestDuration = register(newHistogramVec("ctf_http_request_duration_seconds",
+		"HTTP request latency by route pattern.", defaultBuckets, "route"))
+	logins = register(newCounterVec("ctf_logins_total",
+		"Login attempts by result: success, failure, dumped (several rows), rate_limited or error.", "result"))
+	recipeViews = register(newCounterVec("ctf_recipe_views_total",
+		"Recipe pages and images served by recipe ID.", "id"))
+	flagZipDownloads = register(newCounterVec("ctf_flag_zip_downloads_total",
+		"Downloads of flag.zip."))
+	tableLoadDuration = register(newHistogramVec("ctf_table_database_load_seconds",
+		"Time to load the tables of a player database, when it is created and after an injection changed it.", defaultBuckets))
+)
+
+// defaultBuckets are the upper bounds of the latency histograms in seconds
+var defaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+// labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// writeLabels writes {name="value",...} for the label values joined in key, followed by extra name and value pairs such as le
+func writeLabels(w io.Writer, names []string, key string, extra ...string) {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, names[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) > 0 {
+		fmt.Fprint(w, "{"+strings.Join(pairs, ",")+"}")
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// counterVec is a counter with a value per combination of label values
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	return c
+}
+
+// inc adds one to the counter of the label values
+func (c *counterVec) inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[labelKey(values)]++
+}
+
+// value returns the counter of the label values
+func (c *counterVec) value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[labelKey(values)]
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	for _, key := range slices.Sorted(maps.Keys(c.values)) {
+		fmt.Fprint(w, c.name)
+		writeLabels(w, c.labels, key)
+		fmt.Fprintf(w, " %s\n", formatFloat(c.values[key]))
+	}
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// histogramVec is a histogram with a series per combination of label values
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: make(map[string]*histogram)}
+}
+
+// observe records a duration for the label values
+func (h *histogramVec) observe(d time.Duration, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := labelKey(values)
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	seconds := d.Seconds()
+	if i, _ := slices.BinarySearch(h.buckets, seconds); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += seconds
+	s.count++
+}
+
+// count returns the number of observations for the label values
+func (h *histogramVec) count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if s, ok := h.series[labelKey(values)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *histogramVec) writeTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, key := range slices.Sorted(maps.Keys(h.series)) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprint(w, h.name+"_bucket")
+			writeLabels(w, h.labels, key, "le", formatFloat(bound))
+			fmt.Fprintf(w, " %d\n", cumulative)
+		}
+		fmt.Fprint(w, h.name+"_bucket")
+		writeLabels(w, h.labels, key, "le", "+Inf")
+		fmt.Fprintf(w, " %d\n", s.count)
+		fmt.Fprint(w, h.name+"_sum")
+		writeLabels(w, h.labels, key)
+		fmt.Fprintf(w, " %s\n", formatFloat(s.sum))
+		fmt.Fprint(w, h.name+"_count")
+		writeLabels(w, h.labels, key)
+		fmt.Fprintf(w, " %d\n", s.count)
+	}
+}
+
+// observeRequest records a served request under its route pattern, which keeps the number of series bounded.
+// Methods other than standardMethods are counted as OTHER.
+func observeRequest(r *http.Request, status int, latency time.Duration) {
+	route := r.Pattern
+	if route == "" {
+		route = "unmatched"
+	}
+	method := r.Method
+	if !slices.Contains(standardMethods, method) {
+		method = "OTHER"
+	}
+	httpRequests.inc(route, method, strconv.Itoa(status))
+	httpRequestDuration.observe(latency, route)
+}
+
+// metricsHandler serves the metrics in the Prometheus text format to organizers.
+// The recipe views give away which recipes players are looking at, so they are not public.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorizeAPI(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.writeTo(bw)
+	}
+	_ = bw.Flush()
+}
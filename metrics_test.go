@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	t.Run("counter with escaped labels", func(t *testing.T) {
+		c := newCounterVec("test_total", "Test counter.", "path")
+		c.inc(`/a"b`)
+		c.inc(`/a"b`)
+		c.inc("/c\\d\n")
+
+		// Input: Write the counter
+		var buf bytes.Buffer
+		c.writeTo(&buf)
+
+		// Expected Output: Sorted series with escaped label values
+		expected := "# HELP test_total Test counter.\n# TYPE test_total counter\n" +
+			`test_total{path="/a\"b"} 2` + "\n" +
+			`test_total{path="/c\\d\n"} 1` + "\n"
+		if buf.String() != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, buf.String())
+		}
+	})
+
+	t.Run("counter without labels starts at zero", func(t *testing.T) {
+		var buf bytes.Buffer
+		newCounterVec("test_total", "Test counter.").writeTo(&buf)
+
+		// Input: A counter never incremented
+		// Expected Output: A single zero sample
+		if !strings.HasSuffix(buf.String(), "\ntest_total 0\n") {
+			t.Errorf("Expected a zero sample, got %s", buf.String())
+		}
+	})
+
+	t.Run("histogram buckets are cumulative", func(t *testing.T) {
+		h := newHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "route")
+		h.observe(50*time.Millisecond, "/")
+		h.observe(100*time.Millisecond, "/")
+		h.observe(500*time.Millisecond, "/")
+		h.observe(2*time.Second, "/")
+
+		// Input: Write the histogram
+		var buf bytes.Buffer
+		h.writeTo(&buf)
+
+		// Expected Output: Inclusive upper bounds, +Inf, sum and count
+		for _, line := range []string{
+			"# TYPE test_seconds histogram",
+			`test_seconds_bucket{route="/",le="0.1"} 2`,
+			`test_seconds_bucket{route="/",le="1"} 3`,
+			`test_seconds_bucket{route="/",le="+Inf"} 4`,
+			`test_seconds_sum{route="/"} 2.65`,
+			`test_seconds_count{route="/"} 4`,
+		} {
+			if !strings.Contains(buf.String(), line+"\n") {
+				t.Errorf("Expected %q in\n%s", line, buf.String())
+			}
+		}
+	})
+}
+
+func TestMetricsHandler(t *testing.T) {
+	useUserData(t, userData)
+	server := logRequests(router)
+	prevToken := apiToken
+	apiToken = "organizer"
+	t.Cleanup(func() { apiToken = prevToken })
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		server.ServeHTTP(rr, req)
+		return rr
+	}
+	login := func(username, password string) {
+		req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader("username="+username+"&password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		serve(req)
+	}
+
+	requests := httpRequests.value("GET /recipe/{id}", http.MethodGet, "200")
+	latencies := httpRequestDuration.count("GET /recipe/{id}")
+	successes, failures, dumps := logins.value(loginSucceeded), logins.value(loginFailed), logins.value(loginDumpedUsers)
+	views := recipeViews.value("3")
+	downloads := flagZipDownloads.value()
+	loads := tableLoadDuration.count()
+	unmatched := httpRequests.value("unmatched", "OTHER", "404")
+
+	// Input: Logins, recipe views, a download and a request nothing serves
+	login("kanmu", "gocon2025")
+	login("kanmu", "wrong")
+	login("'+OR+1=1+--", "x")
+	serve(newAPIRequest(t, http.MethodGet, "/recipe/3", "kanmu", nil))
+	serve(newAPIRequest(t, http.MethodGet, "/recipe/3?format=image", "kanmu", nil))
+	serve(newAPIRequest(t, http.MethodGet, "/download/flag.zip", "kanmu", nil))
+	serve(newAPIRequest(t, "BREW", "/coffee", "", nil))
+	anonymous := serve(newAPIRequest(t, http.MethodGet, "/metrics", "kanmu", nil))
+	req := newAPIRequest(t, http.MethodGet, "/metrics", "", nil)
+	req.Header.Set("Authorization", "Bearer organizer")
+	rr := serve(req)
+
+	// Expected Output: Each one is counted and served in the text format, to organizers only
+	if anonymous.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v without the token, got %v", http.StatusUnauthorized, anonymous.Code)
+	}
+
+	checks := []struct {
+		name     string
+		got      float64
+		expected float64
+	}{
+		{"recipe requests", httpRequests.value("GET /recipe/{id}", http.MethodGet, "200") - requests, 2},
+		{"recipe latencies", float64(httpRequestDuration.count("GET /recipe/{id}") - latencies), 2},
+		{"successful logins", logins.value(loginSucceeded) - successes, 1},
+		{"failed logins", logins.value(loginFailed) - failures, 1},
+		{"logins returning several rows", logins.value(loginDumpedUsers) - dumps, 1},
+		{"recipe 3 views", recipeViews.value("3") - views, 2},
+		{"flag.zip downloads", flagZipDownloads.value() - downloads, 1},
+		{"unmatched requests", httpRequests.value("unmatched", "OTHER", "404") - unmatched, 1},
+	}
+	for _, c := range checks {
+		if c.got != c.expected {
+			t.Errorf("Expected %v %s, got %v", c.expected, c.name, c.got)
+		}
+	}
+	if tableLoadDuration.count() <= loads {
+		t.Error("Expected the database load time to be observed")
+	}
+
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected the Prometheus text format, got %q", ct)
+	}
+	for _, name := range []string{
+		"ctf_http_requests_total", "ctf_http_request_duration_seconds", "ctf_logins_total",
+		"ctf_recipe_views_total", "ctf_flag_zip_downloads_total", "ctf_table_database_load_seconds",
+	} {
+		if !strings.Contains(rr.Body.String(), "# TYPE "+name+" ") {
+			t.Errorf("Expected %s in the metrics", name)
+		}
+	}
+	if !strings.Contains(rr.Body.String(), `ctf_recipe_views_total{id="3"}`) {
+		t.Errorf("Expected recipe 3 in the metrics, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// appMode selects between the intentionally vulnerable code paths and their fixed versions
+type appMode string
+
+const (
+	modeVulnerable appMode = "vulnerable"
+	modeHardened   appMode = "hardened"
+)
+
+var errUnknownMode = errors.New("unknown mode")
+
+var mode = modeVulnerable
+
+// parseMode parses the CTF_MODE / -mode value, defaulting to the vulnerable mode
+func parseMode(value string) (appMode, error) {
+	switch appMode(value) {
+	case "", modeVulnerable:
+		return modeVulnerable, nil
+	case modeHardened:
+		return modeHardened, nil
+	default:
+		return "", fmt.Errorf("%w: %q (want %q or %q)", errUnknownMode, value, modeVulnerable, modeHardened)
+	}
+}
+
+func (m appMode) hardened() bool {
+	return m == modeHardened
+}
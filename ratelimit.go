@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+// rateLimiter is a token bucket per key with a lockout after consecutive failures.
+// The lockout doubles with every further failure up to maxBackoff.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	rate         float64 // tokens per second
+	burst        float64
+	lockoutAfter int
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	now          func() time.Time
+}
+
+type bucket struct {
+	tokens      float64
+	updated     time.Time
+	failures    int
+	lockedUntil time.Time
+}
+
+func newRateLimiter(perMinute, lockoutAfter int) *rateLimiter {
+	return &rateLimiter{
+		buckets:      make(map[string]*bucket),
+		rate:         float64(perMinute) / 60,
+		burst:        float64(perMinute),
+		lockoutAfter: lockoutAfter,
+		backoff:      30 * time.Second,
+		maxBackoff:   15 * time.Minute,
+		now:          time.Now,
+	}
+}
+
+// loginLimiter limits login attempts of the stages in rateLimitedStages
+var loginLimiter = newRateLimiter(10, 5)
+
+// rateLimitedStages are the IDs of the challenges whose attempts are rate limited. Stages meant to be
+// brute forced are left out.
+var rateLimitedStages = map[string]bool{}
+
+// trustProxy makes clientIP use X-Forwarded-For, set by the reverse proxy in front of the server
+var trustProxy bool
+
+// parseRateLimitedStages parses CTF_RATE_LIMIT, a comma separated list of challenge IDs or "all"
+func parseRateLimitedStages(value string) (map[string]bool, error) {
+	stages := map[string]bool{}
+	for _, id := range splitList(value) {
+		if id == "all" {
+			for _, c := range registry.All() {
+				stages[c.ID()] = true
+			}
+			continue
+		}
+		if _, ok := registry.Get(id); !ok {
+			return nil, fmt.Errorf("%w: %s", challenge.ErrUnknownID, id)
+		}
+		stages[id] = true
+	}
+	return stages, nil
+}
+
+// bucket returns the refilled bucket of key. l.mu must be held.
+func (l *rateLimiter) bucket(key string, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+	return b
+}
+
+// reserve takes a token from the bucket of every key. When a key is locked out or out of tokens
+// nothing is taken and reserve returns how long to wait.
+func (l *rateLimiter) reserve(keys ...string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var wait time.Duration
+	for _, key := range keys {
+		b := l.bucket(key, now)
+		if now.Before(b.lockedUntil) {
+			wait = max(wait, b.lockedUntil.Sub(now))
+		}
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration((1-b.tokens)/l.rate*float64(time.Second)))
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+	for _, key := range keys {
+		l.buckets[key].tokens--
+	}
+	return 0
+}
+
+// fail records a failed attempt and locks the keys out once they failed lockoutAfter times in a row
+func (l *rateLimiter) fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, key := range keys {
+		b := l.bucket(key, now)
+		b.failures++
+		if excess := b.failures - l.lockoutAfter; excess >= 0 {
+			backoff := l.maxBackoff
+			if excess < 32 {
+				backoff = min(l.backoff<<excess, l.maxBackoff)
+			}
+			b.lockedUntil = now.Add(backoff)
+		}
+	}
+}
+
+// succeed clears the failures of the keys
+func (l *rateLimiter) succeed(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for _, key := range keys {
+		b := l.bucket(key, now)
+		b.failures = 0
+		b.lockedUntil = time.Time{}
+	}
+}
+
+// prune forgets the buckets that are full and not locked out
+func (l *rateLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key := range l.buckets {
+		b := l.bucket(key, now)
+		if b.tokens >= l.burst && b.failures == 0 {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// run prunes the buckets every interval until ctx is done
+func (l *rateLimiter) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.prune()
+		}
+	}
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For when trustProxy is set
+func clientIP(r *http.Request) string {
+	if trustProxy {
+		// The proxy appends the address it received the request from; the entries before it come from the client
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			last := forwarded[strings.LastIndex(forwarded, ",")+1:]
+			return strings.TrimSpace(last)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginLimitKeys returns the limiter keys of a login attempt limited by a stage: every login when the login
+// stage is limited, and logins as the zip user, whose password opens flag.zip, when the zip stage is limited.
+// A limited attempt is counted for the client as well as the username, so a new player cookie, which scopes
+// the username, does not lift a lockout.
+func loginLimitKeys(r *http.Request, username string) []string {
+	if !rateLimitedStages[sqliLoginID] && !(rateLimitedStages[ingredientsID] && username == zipUser) {
+		return nil
+	}
+	return []string{"ip:" + clientIP(r), userLimitKey(r, username)}
+}
+
+// userLimitKey returns the limiter key of username. In vulnerable mode every player logs in to the users table
+// of their own instance, shared accounts such as kanmu included, so the key is scoped to the player, or to the
+// client before it has a player cookie, and failures of one player do not lock the others out.
+func userLimitKey(r *http.Request, username string) string {
+	if mode.hardened() {
+		return "user:" + username
+	}
+	scope := clientIP(r)
+	if key, ok := playerCookieKey(r); ok {
+		scope = key
+	}
+	return "user:" + scope + ":" + username
+}
+
+type RateLimitData struct {
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+// respondTooManyRequests writes a 429 with Retry-After as the rate limit page or a JSON error
+func respondTooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respond(w, r, http.StatusTooManyRequests, "too_many_requests", RateLimitData{
+		Error:      localize(r, "rate_limit.error"),
+		RetryAfter: seconds,
+	})
+}
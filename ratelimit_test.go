@@ -0,0 +1,273 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useRateLimit limits the stages with a fresh limiter whose clock the test controls
+func useRateLimit(t *testing.T, perMinute, lockoutAfter int, stages ...string) (*rateLimiter, *time.Time) {
+	t.Helper()
+
+	now := time.Date(2025, 9, 27, 10, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(perMinute, lockoutAfter)
+	limiter.now = func() time.Time { return now }
+
+	prevLimiter, prevStages := loginLimiter, rateLimitedStages
+	loginLimiter, rateLimitedStages = limiter, map[string]bool{}
+	for _, id := range stages {
+		rateLimitedStages[id] = true
+	}
+	t.Cleanup(func() { loginLimiter, rateLimitedStages = prevLimiter, prevStages })
+	return limiter, &now
+}
+
+func postLoginFrom(t *testing.T, remoteAddr, username, password string, json bool) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"username": {username}, "password": {password}}
+	req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if json {
+		req.Header.Set("Accept", "application/json")
+	}
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	loginHandler(rr, req)
+	return rr
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Run("token bucket refills over time", func(t *testing.T) {
+		limiter, now := useRateLimit(t, 3, 100)
+
+		// Input: A burst of attempts, then a wait
+		for i := range 3 {
+			if wait := limiter.reserve("ip:a"); wait != 0 {
+				t.Fatalf("Expected attempt %d to be allowed, got wait %v", i, wait)
+			}
+		}
+		wait := limiter.reserve("ip:a")
+
+		// Expected Output: The fourth attempt waits for one token, which comes back after 20 seconds
+		if wait != 20*time.Second {
+			t.Errorf("Expected wait of 20s, got %v", wait)
+		}
+		if wait := limiter.reserve("ip:b"); wait != 0 {
+			t.Errorf("Expected another key to be allowed, got wait %v", wait)
+		}
+		*now = now.Add(20 * time.Second)
+		if wait := limiter.reserve("ip:a"); wait != 0 {
+			t.Errorf("Expected attempt after refill to be allowed, got wait %v", wait)
+		}
+	})
+
+	t.Run("lockout doubles up to the maximum", func(t *testing.T) {
+		limiter, now := useRateLimit(t, 1000, 3)
+
+		// Input: Consecutive failures
+		var waits []time.Duration
+		for range 10 {
+			limiter.fail("user:kanmu")
+			waits = append(waits, limiter.reserve("user:kanmu"))
+		}
+
+		// Expected Output: Locked from the third failure, 30s doubling up to 15m
+		expected := []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 15 * time.Minute, 15 * time.Minute, 15 * time.Minute}
+		for i := range expected {
+			if waits[i] != expected[i] {
+				t.Errorf("Failure %d: expected wait %v, got %v", i+1, expected[i], waits[i])
+			}
+		}
+		*now = now.Add(15 * time.Minute)
+		if wait := limiter.reserve("user:kanmu"); wait != 0 {
+			t.Errorf("Expected lockout to expire, got wait %v", wait)
+		}
+	})
+
+	t.Run("success clears the failures", func(t *testing.T) {
+		limiter, _ := useRateLimit(t, 1000, 2)
+
+		// Input: A failure, a success, another failure
+		limiter.fail("user:kanmu")
+		limiter.succeed("user:kanmu")
+		limiter.fail("user:kanmu")
+
+		// Expected Output: Not locked out
+		if wait := limiter.reserve("user:kanmu"); wait != 0 {
+			t.Errorf("Expected no lockout, got wait %v", wait)
+		}
+	})
+
+	t.Run("X-Forwarded-For only behind a trusted proxy", func(t *testing.T) {
+		req := newAPIRequest(t, http.MethodPost, "/login", "", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+
+		// Input: The same request with and without trustProxy
+		// Expected Output: The proxy address, then the client the proxy appended, not the address the client claims
+		if ip := clientIP(req); ip != "10.0.0.1" {
+			t.Errorf("Expected 10.0.0.1, got %s", ip)
+		}
+		trustProxy = true
+		t.Cleanup(func() { trustProxy = false })
+		if ip := clientIP(req); ip != "203.0.113.7" {
+			t.Errorf("Expected 203.0.113.7, got %s", ip)
+		}
+	})
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	t.Run("lockout -> 429 with Retry-After", func(t *testing.T) {
+		useRateLimit(t, 100, 3, sqliLoginID)
+
+		// Input: Three wrong passwords, then the right one
+		for range 3 {
+			postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", false)
+		}
+		rr := postLoginFrom(t, "192.0.2.1:1000", "kanmu", "gocon2025", false)
+
+		// Expected Output: The rate limit page
+		if status := rr.Code; status != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+		if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "30" {
+			t.Errorf("Expected Retry-After 30, got %q", retryAfter)
+		}
+		if !strings.Contains(rr.Body.String(), "30 秒後") {
+			t.Errorf("Expected the wait in the page, got %s", rr.Body.String())
+		}
+	})
+
+	t.Run("JSON client -> 429 with retry_after", func(t *testing.T) {
+		useRateLimit(t, 1, 100, sqliLoginID)
+
+		// Input: Two attempts within a minute
+		postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", true)
+		rr := postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", true)
+
+		// Expected Output: The wait as JSON
+		if status := rr.Code; status != http.StatusTooManyRequests {
+			t.Fatalf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+		var data RateLimitData
+		decodeJSON(t, rr, &data)
+		if data.RetryAfter != 60 || rr.Header().Get("Retry-After") != "60" {
+			t.Errorf("Expected retry after 60s, got %d and %q", data.RetryAfter, rr.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("username is limited across addresses", func(t *testing.T) {
+		useRateLimit(t, 100, 2, sqliLoginID)
+		useUserData(t, userData)
+		post := func(remoteAddr, player, username, password string) int {
+			form := url.Values{"username": {username}, "password": {password}}
+			req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(playerCookie(player))
+			req.RemoteAddr = remoteAddr
+			rr := httptest.NewRecorder()
+			loginHandler(rr, req)
+			return rr.Code
+		}
+
+		// Input: Failures of one player for one user from different addresses
+		post("192.0.2.1:1000", "player-1", "kanmu", "wrong")
+		post("192.0.2.2:1000", "player-1", "kanmu", "wrong")
+
+		// Expected Output: The user is locked out for the player, other users and players are not
+		if status := post("192.0.2.3:1000", "player-1", "kanmu", "gocon2025"); status != http.StatusTooManyRequests {
+			t.Errorf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+		if status := post("192.0.2.3:1000", "player-1", "zip", "wrong"); status != http.StatusOK {
+			t.Errorf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		if status := post("192.0.2.4:1000", "player-2", "kanmu", "gocon2025"); status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("hardened mode -> username limited for everyone", func(t *testing.T) {
+		useRateLimit(t, 100, 2, sqliLoginID)
+		setMode(t, modeHardened)
+
+		// Input: Failures for one account from different addresses
+		postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", false)
+		postLoginFrom(t, "192.0.2.2:1000", "kanmu", "wrong", false)
+
+		// Expected Output: The account is locked out
+		if status := postLoginFrom(t, "192.0.2.3:1000", "kanmu", "gocon2025", false).Code; status != http.StatusTooManyRequests {
+			t.Errorf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+	})
+
+	t.Run("stage not limited -> no lockout", func(t *testing.T) {
+		useRateLimit(t, 1, 1)
+
+		// Input: Many failures with no limited stage
+		for range 5 {
+			postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", false)
+		}
+
+		// Expected Output: Login still works
+		if status := postLoginFrom(t, "192.0.2.1:1000", "kanmu", "gocon2025", false).Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("zip stage limits only the zip user", func(t *testing.T) {
+		useRateLimit(t, 100, 1, ingredientsID)
+
+		// Input: Failures for zip and for kanmu
+		postLoginFrom(t, "192.0.2.1:1000", zipUser, "wrong", false)
+		postLoginFrom(t, "192.0.2.1:1000", "kanmu", "wrong", false)
+
+		// Expected Output: zip is locked out, SQL injection on the login stage is not limited
+		if status := postLoginFrom(t, "192.0.2.1:1000", zipUser, "wrong", false).Code; status != http.StatusTooManyRequests {
+			t.Errorf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+		if status := postLoginFrom(t, "192.0.2.1:1000", "kanmu", "gocon2025", false).Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("zip stage -> a new player cookie does not lift the lockout", func(t *testing.T) {
+		useRateLimit(t, 100, 1, ingredientsID)
+		post := func(player string) int {
+			form := url.Values{"username": {zipUser}, "password": {"wrong"}}
+			req := newAPIRequest(t, http.MethodPost, "/login", "", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.AddCookie(playerCookie(player))
+			req.RemoteAddr = "192.0.2.1:1000"
+			rr := httptest.NewRecorder()
+			loginHandler(rr, req)
+			return rr.Code
+		}
+
+		// Input: A failure for zip, then another one with a new player cookie from the same address
+		post("player-1")
+
+		// Expected Output: The address is still locked out
+		if status := post("player-2"); status != http.StatusTooManyRequests {
+			t.Errorf("Expected status %v, got %v", http.StatusTooManyRequests, status)
+		}
+	})
+
+	t.Run("unknown stage -> error", func(t *testing.T) {
+		// Input: CTF_RATE_LIMIT with a typo
+		_, err := parseRateLimitedStages("sqli-login,nope")
+
+		// Expected Output: Rejected at startup
+		if err == nil {
+			t.Error("Expected an error")
+		}
+		stages, err := parseRateLimitedStages("all")
+		if err != nil || !stages[sqliLoginID] || !stages[ingredientsID] {
+			t.Errorf("Expected every stage, got %v %v", stages, err)
+		}
+	})
+}
@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// maxImageSize is the largest recipe image that can be uploaded
+const maxImageSize = 5 << 20
+
+// maxRecipeRequestSize leaves room for the text fields next to the image
+const maxRecipeRequestSize = maxImageSize + 1<<20
+
+var (
+	errMissingRecipeName = messageError("recipe.missing_name")
+	errInvalidImage      = messageError("recipe.invalid_image")
+	errImageTooLarge     = messageError("recipe.image_too_large")
+	errUnknownLanguage   = messageError("recipe.unknown_language")
+)
+
+// RecipeInput is the part of a recipe its owner can edit
+type RecipeInput struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Emoji       string   `json:"emoji"`
+	Steps       []string `json:"steps"`
+	// Visibility is private, shared or public; empty means private
+	Visibility Visibility `json:"visibility"`
+	SharedWith []string   `json:"shared_with"`
+	// Image is base64 encoded in JSON; an empty image keeps the current one
+	Image []byte `json:"image,omitempty"`
+	// Translations holds the content in other languages; languages left out are removed
+	Translations map[string]RecipeText `json:"translations,omitempty"`
+}
+
+// trimLines trims the lines and drops the empty ones
+func trimLines(lines []string) []string {
+	var trimmed []string
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			trimmed = append(trimmed, line)
+		}
+	}
+	return trimmed
+}
+
+// splitLines splits the text of a textarea into lines
+func splitLines(text string) []string {
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}
+
+// validate normalizes the input and checks the required fields and image
+func (in *RecipeInput) validate() error {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Description = strings.TrimSpace(in.Description)
+	in.Emoji = strings.TrimSpace(in.Emoji)
+
+	in.Steps = trimLines(in.Steps)
+	in.SharedWith = splitUsers(strings.Join(in.SharedWith, ","))
+
+	translations := make(map[string]RecipeText)
+	for lang, text := range in.Translations {
+		if !slices.Contains(languages, lang) {
+			return errUnknownLanguage
+		}
+		text.Name = strings.TrimSpace(text.Name)
+		text.Description = strings.TrimSpace(text.Description)
+		text.Steps = trimLines(text.Steps)
+		if text.Name != "" || text.Description != "" || len(text.Steps) > 0 {
+			translations[lang] = text
+		}
+	}
+	in.Translations = nil
+	if len(translations) > 0 {
+		in.Translations = translations
+	}
+
+	if in.Name == "" {
+		return errMissingRecipeName
+	}
+	visibility, err := parseVisibility(string(in.Visibility))
+	if err != nil {
+		return err
+	}
+	in.Visibility = visibility
+	if visibility != VisibilityShared {
+		in.SharedWith = nil
+	}
+	if len(in.Image) > maxImageSize {
+		return errImageTooLarge
+	}
+	if len(in.Image) > 0 && imageContentType(in.Image) == "" {
+		return errInvalidImage
+	}
+	return nil
+}
+
+// apply copies the input to the recipe
+func (in *RecipeInput) apply(recipe *Recipe) {
+	recipe.Name = in.Name
+	recipe.Description = in.Description
+	recipe.Emoji = in.Emoji
+	recipe.Steps = in.Steps
+	recipe.Visibility = in.Visibility
+	recipe.SharedWith = in.SharedWith
+	recipe.Translations = in.Translations
+	if len(in.Image) > 0 {
+		recipe.Image = in.Image
+		recipe.ContentType = imageContentType(in.Image)
+	}
+}
+
+// imageContentType detects the type of an uploaded image, or returns "" if it is not a supported image
+func imageContentType(data []byte) string {
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return contentType
+	default:
+		return ""
+	}
+}
+
+// canEditRecipe reports whether user may change or delete the recipe.
+// The built-in recipes are part of the challenges and cannot be changed by anyone.
+func canEditRecipe(user string, recipe *Recipe) bool {
+	if _, builtin := recipeDatabase[recipe.ID]; builtin {
+		return false
+	}
+	return recipe.Owner == user
+}
+
+// editableRecipe returns the recipe if user may edit it; other users get errRecipeNotFound
+func editableRecipe(ctx context.Context, user string, id int) (*Recipe, error) {
+	recipe, err := recipes.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !canEditRecipe(user, recipe) {
+		return nil, errRecipeNotFound
+	}
+	return recipe, nil
+}
+
+// listRecipesOwnedBy returns the recipes owned by user
+func listRecipesOwnedBy(ctx context.Context, user string) ([]*Recipe, error) {
+	list, err := recipes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var owned []*Recipe
+	for _, recipe := range list {
+		if recipe.Owner == user {
+			owned = append(owned, recipe)
+		}
+	}
+	return owned, nil
+}
+
+// recipeCSRFToken is sent with the forms that create, edit and delete recipes. It is bound to the login cookie
+// of the request, so other sites cannot change the recipes of a logged in user.
+func recipeCSRFToken(r *http.Request) string {
+	return loginCSRFToken(r, recipeCSRFPurpose)
+}
+
+// validRecipeCSRFToken reports whether the posted form carries the recipe token of the request
+func validRecipeCSRFToken(r *http.Request) bool {
+	return hmac.Equal([]byte(r.FormValue("csrf_token")), []byte(recipeCSRFToken(r)))
+}
+
+type RecipeFormData struct {
+	Title       string
+	Action      string
+	Cancel      string
+	Error       string
+	CSRFToken   string
+	ID          int
+	Name        string
+	Description string
+	Emoji       string
+	Steps       string
+	Visibility  Visibility
+	SharedWith  string
+	HasImage    bool
+	// Translations has the translation fields of every language
+	Translations []RecipeFormText
+}
+
+// RecipeFormText holds the translation fields of a language in the recipe form
+type RecipeFormText struct {
+	Lang        string
+	Name        string
+	Description string
+	Steps       string
+}
+
+// recipeFormTexts returns the translation fields of every language
+func recipeFormTexts(translations map[string]RecipeText) []RecipeFormText {
+	texts := make([]RecipeFormText, 0, len(languages))
+	for _, lang := range languages {
+		text := translations[lang]
+		texts = append(texts, RecipeFormText{
+			Lang:        lang,
+			Name:        text.Name,
+			Description: text.Description,
+			Steps:       strings.Join(text.Steps, "\n"),
+		})
+	}
+	return texts
+}
+
+// newRecipeFormData returns the form of the recipe with its title in lang
+func newRecipeFormData(lang string, recipe *Recipe) RecipeFormData {
+	if recipe.ID == 0 {
+		return RecipeFormData{
+			Title:        translate(lang, "recipe_form.new_title"),
+			Action:       "/recipes/new",
+			Cancel:       "/dashboard",
+			Visibility:   VisibilityPrivate,
+			Translations: recipeFormTexts(nil),
+		}
+	}
+	return RecipeFormData{
+		Title:       translate(lang, "recipe_form.edit_title"),
+		Action:      "/recipes/" + strconv.Itoa(recipe.ID) + "/edit",
+		Cancel:      "/recipe/" + strconv.Itoa(recipe.ID),
+		ID:          recipe.ID,
+		Name:        recipe.Name,
+		Description: recipe.Description,
+		Emoji:       recipe.Emoji,
+		Steps:       strings.Join(recipe.Steps, "\n"),
+		Visibility:  recipeVisibility(recipe),
+		SharedWith:  strings.Join(recipe.SharedWith, ", "),
+		HasImage:    len(recipe.Image) > 0,
+
+		Translations: recipeFormTexts(recipe.Translations),
+	}
+}
+
+// parseRecipeForm reads a recipe from a multipart or urlencoded form
+func parseRecipeForm(w http.ResponseWriter, r *http.Request) (*RecipeInput, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecipeRequestSize)
+	if err := r.ParseMultipartForm(maxImageSize); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, errImageTooLarge
+		}
+		return nil, err
+	}
+
+	in := &RecipeInput{
+		Name:        r.PostFormValue("name"),
+		Description: r.PostFormValue("description"),
+		Emoji:       r.PostFormValue("emoji"),
+		Steps:       splitLines(r.PostFormValue("steps")),
+		Visibility:  Visibility(r.PostFormValue("visibility")),
+		SharedWith:  []string{r.PostFormValue("shared_with")},
+	}
+	in.Translations = make(map[string]RecipeText, len(languages))
+	for _, lang := range languages {
+		in.Translations[lang] = RecipeText{
+			Name:        r.PostFormValue("name_" + lang),
+			Description: r.PostFormValue("description_" + lang),
+			Steps:       splitLines(r.PostFormValue("steps_" + lang)),
+		}
+	}
+
+	file, _, err := r.FormFile("image")
+	switch {
+	case errors.Is(err, http.ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+	case err != nil:
+		return nil, err
+	default:
+		defer file.Close()
+		if in.Image, err = io.ReadAll(io.LimitReader(file, maxImageSize+1)); err != nil {
+			return nil, err
+		}
+	}
+	return in, in.validate()
+}
+
+// saveRecipeForm stores the submitted recipe for POST requests and renders the form otherwise
+func saveRecipeForm(w http.ResponseWriter, r *http.Request, recipe *Recipe, save func(context.Context, *Recipe) error) {
+	data := newRecipeFormData(requestLanguage(r), recipe)
+	data.CSRFToken = recipeCSRFToken(r)
+	status := http.StatusOK
+
+	if r.Method == http.MethodPost {
+		in, err := parseRecipeForm(w, r)
+		if in != nil && !validRecipeCSRFToken(r) {
+			respondError(w, r, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err == nil {
+			in.apply(recipe)
+			if err := save(r.Context(), recipe); err != nil {
+				http.Error(w, "Database Error", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, "/recipe/"+strconv.Itoa(recipe.ID), http.StatusSeeOther)
+			return
+		}
+		if in == nil && !errors.Is(err, errImageTooLarge) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if in != nil {
+			data.Name, data.Description, data.Emoji = in.Name, in.Description, in.Emoji
+			data.Steps = strings.Join(in.Steps, "\n")
+			data.Visibility = in.Visibility
+			data.SharedWith = strings.Join(in.SharedWith, ", ")
+			data.Translations = recipeFormTexts(in.Translations)
+		}
+		data.Error = errorMessage(requestLanguage(r), err)
+		status = http.StatusUnprocessableEntity
+	}
+
+	if err := renderTemplate(w, r, status, "recipe_form", data); err != nil {
+		http.Error(w, "Template Error", http.StatusInternalServerError)
+	}
+}
+
+// newRecipeHandler serves /recipes/new
+func newRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return
+	}
+	saveRecipeForm(w, r, &Recipe{Owner: user}, recipes.Create)
+}
+
+// editRecipeHandler serves /recipes/{id}/edit
+func editRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := recipeToEdit(w, r)
+	if !ok {
+		return
+	}
+	saveRecipeForm(w, r, recipe, recipes.Update)
+}
+
+// deleteRecipeHandler deletes the recipe posted to /recipes/{id}/delete
+func deleteRecipeHandler(w http.ResponseWriter, r *http.Request) {
+	recipe, ok := recipeToEdit(w, r)
+	if !ok {
+		return
+	}
+	if !validRecipeCSRFToken(r) {
+		respondError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if err := recipes.Delete(r.Context(), recipe.ID); err != nil && !errors.Is(err, errRecipeNotFound) {
+		http.Error(w, "Database Error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// recipeToEdit returns the recipe {id} of the path if the logged in user may edit it
+func recipeToEdit(w http.ResponseWriter, r *http.Request) (*Recipe, bool) {
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		showNotFound(w, r)
+		return nil, false
+	}
+	recipe, err := editableRecipe(r.Context(), user, id)
+	if errors.Is(err, errRecipeNotFound) {
+		showNotFound(w, r)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Database Error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return recipe, true
+}
+
+// APIRecipe is a recipe as returned by the JSON API
+type APIRecipe struct {
+	ID          int        `json:"id"`
+	Owner       string     `json:"owner"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Emoji       string     `json:"emoji"`
+	Steps       []string   `json:"steps"`
+	Visibility  Visibility `json:"visibility"`
+	SharedWith  []string   `json:"shared_with,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	ImageURL    string     `json:"image_url,omitempty"`
+
+	Translations map[string]RecipeText `json:"translations,omitempty"`
+}
+
+func newAPIRecipe(recipe *Recipe) APIRecipe {
+	a := APIRecipe{
+		ID:          recipe.ID,
+		Owner:       recipe.Owner,
+		Name:        recipe.Name,
+		Description: recipe.Description,
+		Emoji:       recipe.Emoji,
+		Steps:       recipe.Steps,
+		Visibility:  recipeVisibility(recipe),
+		SharedWith:  recipe.SharedWith,
+
+		Translations: recipe.Translations,
+	}
+	if a.Steps == nil {
+		a.Steps = []string{}
+	}
+	if len(recipe.Image) > 0 {
+		a.ContentType = recipe.ContentType
+		a.ImageURL = recipeImageURL(recipe.ID)
+	}
+	return a
+}
+
+// decodeRecipeInput reads a JSON recipe from the request body. Other content types are rejected,
+// as browsers post them from other sites without a preflight.
+func decodeRecipeInput(w http.ResponseWriter, r *http.Request) (*RecipeInput, bool) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Unsupported Media Type")
+		return nil, false
+	}
+	var in RecipeInput
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecipeRequestSize*4/3))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Bad Request")
+		return nil, false
+	}
+	if err := in.validate(); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, errorMessage(requestLanguage(r), err))
+		return nil, false
+	}
+	return &in, true
+}
+
+// recipesAPIHandler serves /api/v1/recipes: GET lists your recipes, POST creates one
+func recipesAPIHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		in, ok := decodeRecipeInput(w, r)
+		if !ok {
+			return
+		}
+		recipe := &Recipe{Owner: user}
+		in.apply(recipe)
+		if err := recipes.Create(r.Context(), recipe); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Database Error")
+			return
+		}
+		w.Header().Set("Location", apiPrefix+"/recipes/"+strconv.Itoa(recipe.ID))
+		writeJSON(w, http.StatusCreated, newAPIRecipe(recipe))
+		return
+	}
+
+	owned, err := listRecipesOwnedBy(r.Context(), user)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Database Error")
+		return
+	}
+	list := make([]APIRecipe, 0, len(owned))
+	for _, recipe := range owned {
+		list = append(list, newAPIRecipe(recipe))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// recipeAPIHandler serves /api/v1/recipes/{id}: GET returns a recipe you may view, PUT and DELETE change your own
+func recipeAPIHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := currentUser(r)
+	if !ok {
+		writeJSONError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	var recipe *Recipe
+	switch r.Method {
+	case http.MethodPut, http.MethodDelete:
+		recipe, err = editableRecipe(r.Context(), user, id)
+	default:
+		recipe, err = recipes.Get(r.Context(), id)
+		if err == nil && !canViewRecipe(user, recipe) {
+			err = errRecipeNotFound
+		}
+	}
+	if errors.Is(err, errRecipeNotFound) {
+		writeJSONError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "Database Error")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		in, ok := decodeRecipeInput(w, r)
+		if !ok {
+			return
+		}
+		in.apply(recipe)
+		if err := recipes.Update(r.Context(), recipe); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "Database Error")
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIRecipe(recipe))
+	case http.MethodDelete:
+		if err := recipes.Delete(r.Context(), id); err != nil && !errors.Is(err, errRecipeNotFound) {
+			writeJSONError(w, http.StatusInternalServerError, "Database Error")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusOK, newAPIRecipe(recipe))
+	}
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useRecipes replaces the recipe repository with a fresh in-memory one for the test
+func useRecipes(t *testing.T) {
+	t.Helper()
+
+	prev := recipes
+	recipes = newMemoryRecipeRepository(recipeDatabase)
+	t.Cleanup(func() { recipes = prev })
+}
+
+func newPNG(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// newRecipeFormRequest builds a multipart form POST as sent by recipe_form.html,
+// with the CSRF token of user unless fields has one
+func newRecipeFormRequest(t *testing.T, path, user string, fields map[string]string, img []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if _, ok := fields["csrf_token"]; !ok {
+		if err := mw.WriteField("csrf_token", sign(recipeCSRFPurpose, user)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if img != nil {
+		fw, err := mw.CreateFormFile("image", "upload")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write(img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	return req
+}
+
+func newRecipeAPIRequest(t *testing.T, method, path, user string, body any) *http.Request {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	}
+	return req
+}
+
+func TestRecipesHandler(t *testing.T) {
+	t.Run("create recipe with image -> stored and listed on dashboard", func(t *testing.T) {
+		useRecipes(t)
+
+		// Input: POST /recipes/new with a PNG image
+		req := newRecipeFormRequest(t, "/recipes/new", "gocon", map[string]string{
+			"name":        "肉じゃが",
+			"description": "ほっとする味",
+			"emoji":       "🥘",
+			"steps":       "切る\r\n\r\n煮る\r\n",
+		}, newPNG(t))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: Redirect to the new recipe with detected content type
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusSeeOther, status, rr.Body.String())
+		}
+		list, err := listRecipesOwnedBy(context.Background(), "gocon")
+		if err != nil || len(list) != 1 {
+			t.Fatalf("Expected 1 recipe owned by gocon, got %d (%v)", len(list), err)
+		}
+		recipe := list[0]
+		if location := rr.Header().Get("Location"); location != "/recipe/14" || recipe.ID != 14 {
+			t.Errorf("Expected redirect to /recipe/14, got %v", location)
+		}
+		if recipe.ContentType != "image/png" {
+			t.Errorf("Expected content type image/png, got %q", recipe.ContentType)
+		}
+		if len(recipe.Steps) != 2 || recipe.Steps[1] != "煮る" {
+			t.Errorf("Expected 2 steps without blank lines, got %q", recipe.Steps)
+		}
+
+		dashboard, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/dashboard", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dashboard.AddCookie(&http.Cookie{Name: "user", Value: "gocon"})
+		drr := httptest.NewRecorder()
+		http.HandlerFunc(dashboardHandler).ServeHTTP(drr, dashboard)
+		if !strings.Contains(drr.Body.String(), "肉じゃが") || !strings.Contains(drr.Body.String(), "/recipe/14") {
+			t.Errorf("Expected new recipe on the dashboard")
+		}
+	})
+
+	t.Run("invalid input -> form with error", func(t *testing.T) {
+		useRecipes(t)
+
+		testCases := []struct {
+			name   string
+			fields map[string]string
+			img    []byte
+			error  string
+		}{
+			{"missing name", map[string]string{"name": "  "}, nil, errMissingRecipeName.Error()},
+			{"not an image", map[string]string{"name": "x"}, []byte("<script>alert(1)</script>"), errInvalidImage.Error()},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: POST /recipes/new with invalid input
+				req := newRecipeFormRequest(t, "/recipes/new", "gocon", tc.fields, tc.img)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: 422 with the error and nothing stored
+				if status := rr.Code; status != http.StatusUnprocessableEntity {
+					t.Errorf("Expected status %v, got %v", http.StatusUnprocessableEntity, status)
+				}
+				if !strings.Contains(rr.Body.String(), tc.error) {
+					t.Errorf("Expected error %q in form", tc.error)
+				}
+				if list, _ := listRecipesOwnedBy(context.Background(), "gocon"); len(list) != 0 {
+					t.Errorf("Expected no recipe to be stored")
+				}
+			})
+		}
+	})
+
+	t.Run("translation fields -> stored and shown in that language", func(t *testing.T) {
+		useRecipes(t)
+
+		// Input: POST /recipes/new with English fields
+		req := newRecipeFormRequest(t, "/recipes/new", "gocon", map[string]string{
+			"name":     "肉じゃが",
+			"steps":    "切る\n煮る",
+			"name_en":  " Nikujaga ",
+			"steps_en": "Cut\r\n\r\nSimmer",
+		}, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: Only the filled translation stored
+		recipe, err := recipes.Get(context.Background(), 14)
+		if err != nil {
+			t.Fatalf("Expected the recipe to be stored, got %v: %s", err, rr.Body.String())
+		}
+		en, ok := recipe.Translations[langEN]
+		if len(recipe.Translations) != 1 || !ok || en.Name != "Nikujaga" || len(en.Steps) != 2 {
+			t.Errorf("Unexpected translations %+v", recipe.Translations)
+		}
+
+		// Input: The edit form in English
+		edit := newAPIRequest(t, http.MethodGet, "/recipes/14/edit?lang=en", "gocon", nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, edit)
+
+		// Expected Output: English labels with the translation filled in
+		body := rr.Body.String()
+		if !strings.Contains(body, "✏️ Edit Recipe") || !strings.Contains(body, `name="name_en" value="Nikujaga"`) {
+			t.Errorf("Expected the English form with the translation, got %q", body)
+		}
+	})
+
+	t.Run("edit and delete own recipe", func(t *testing.T) {
+		useRecipes(t)
+		recipe := &Recipe{Owner: "gocon", Name: "カレー", Image: newPNG(t), ContentType: "image/png"}
+		if err := recipes.Create(context.Background(), recipe); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: POST /recipes/14/edit without a new image
+		req := newRecipeFormRequest(t, "/recipes/14/edit", "gocon", map[string]string{"name": "スープカレー", "steps": "煮込む"}, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: Recipe updated, image kept
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Fatalf("Expected status %v, got %v", http.StatusSeeOther, status)
+		}
+		updated, err := recipes.Get(context.Background(), recipe.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Name != "スープカレー" || updated.ContentType != "image/png" || len(updated.Image) == 0 {
+			t.Errorf("Expected updated name and kept image, got %q %q", updated.Name, updated.ContentType)
+		}
+
+		// Input: POST /recipes/14/delete
+		req = newRecipeFormRequest(t, "/recipes/14/delete", "gocon", nil, nil)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: Recipe deleted
+		if status := rr.Code; status != http.StatusSeeOther {
+			t.Errorf("Expected status %v, got %v", http.StatusSeeOther, status)
+		}
+		if _, err := recipes.Get(context.Background(), recipe.ID); !errors.Is(err, errRecipeNotFound) {
+			t.Errorf("Expected recipe to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("other users and built-in recipes -> not found", func(t *testing.T) {
+		useRecipes(t)
+		if err := recipes.Create(context.Background(), &Recipe{Owner: "gocon", Name: "カレー"}); err != nil {
+			t.Fatal(err)
+		}
+
+		testCases := []struct {
+			name string
+			user string
+			path string
+		}{
+			{"vandle editing gocon's recipe", "vandle", "/recipes/14/edit"},
+			{"vandle deleting gocon's recipe", "vandle", "/recipes/14/delete"},
+			{"kanmu editing built-in gyoza", "kanmu", "/recipes/2/edit"},
+			{"admin deleting built-in steak sauce", "admin", "/recipes/13/delete"},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: POST to a recipe the user cannot edit
+				req := newRecipeFormRequest(t, tc.path, tc.user, map[string]string{"name": "x"}, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: 404 and the recipe unchanged
+				if status := rr.Code; status != http.StatusNotFound {
+					t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+				}
+			})
+		}
+		if recipe := getRecipe(flagRecipeID); recipe == nil || recipe.Name != "ステーキソース" {
+			t.Errorf("Expected steak sauce recipe to be unchanged")
+		}
+	})
+
+	t.Run("missing or foreign CSRF token -> forbidden", func(t *testing.T) {
+		useRecipes(t)
+		if err := recipes.Create(context.Background(), &Recipe{Owner: "gocon", Name: "カレー"}); err != nil {
+			t.Fatal(err)
+		}
+
+		testCases := []struct {
+			name  string
+			path  string
+			token string
+		}{
+			{"create without a token", "/recipes/new", ""},
+			{"edit with the token of another user", "/recipes/14/edit", sign(recipeCSRFPurpose, "vandle")},
+			{"delete with the logout token", "/recipes/14/delete", sign(logoutCSRFPurpose, "gocon")},
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: A recipe form posted by gocon without its recipe token
+				req := newRecipeFormRequest(t, tc.path, "gocon", map[string]string{"name": "x", "csrf_token": tc.token}, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: 403 and the recipes unchanged
+				if status := rr.Code; status != http.StatusForbidden {
+					t.Errorf("Expected status %v, got %v", http.StatusForbidden, status)
+				}
+			})
+		}
+		owned, err := listRecipesOwnedBy(context.Background(), "gocon")
+		if err != nil || len(owned) != 1 || owned[0].Name != "カレー" {
+			t.Errorf("Expected gocon's recipe to be unchanged, got %v %v", owned, err)
+		}
+	})
+
+	t.Run("forms carry the CSRF token", func(t *testing.T) {
+		useRecipes(t)
+		if err := recipes.Create(context.Background(), &Recipe{Owner: "gocon", Name: "カレー"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, path := range []string{"/recipes/new", "/recipes/14/edit", "/recipe/14"} {
+			// Input: GET a page with a recipe form
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, path, "gocon", nil))
+
+			// Expected Output: The token of gocon in the form
+			token := sign(recipeCSRFPurpose, "gocon")
+			if !strings.Contains(rr.Body.String(), `name="csrf_token" value="`+token+`"`) {
+				t.Errorf("Expected the CSRF token on %s", path)
+			}
+		}
+	})
+}
+
+func TestRecipesAPIHandler(t *testing.T) {
+	t.Run("without authentication -> unauthorized", func(t *testing.T) {
+		// Input: GET /api/v1/recipes without cookies
+		req := newRecipeAPIRequest(t, http.MethodGet, apiPrefix+"/recipes", "", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 401 JSON error
+		if status := rr.Code; status != http.StatusUnauthorized {
+			t.Errorf("Expected status %v, got %v", http.StatusUnauthorized, status)
+		}
+	})
+
+	t.Run("create, list, update and delete", func(t *testing.T) {
+		useRecipes(t)
+
+		// Input: POST /api/v1/recipes with a base64 image
+		req := newRecipeAPIRequest(t, http.MethodPost, apiPrefix+"/recipes", "gocon", RecipeInput{
+			Name: "焼きそば", Emoji: "🍝", Steps: []string{"炒める", "ソースを絡める"}, Image: newPNG(t),
+		})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 201 with the created recipe
+		if status := rr.Code; status != http.StatusCreated {
+			t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, status, rr.Body.String())
+		}
+		var created APIRecipe
+		if err := json.NewDecoder(rr.Body).Decode(&created); err != nil {
+			t.Fatal(err)
+		}
+		if created.Owner != "gocon" || created.ContentType != "image/png" || created.ImageURL != "/recipe/14?format=image" {
+			t.Errorf("Unexpected created recipe %+v", created)
+		}
+		if location := rr.Header().Get("Location"); location != apiPrefix+"/recipes/14" {
+			t.Errorf("Expected Location /api/v1/recipes/14, got %v", location)
+		}
+
+		// Input: GET /api/v1/recipes
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, newRecipeAPIRequest(t, http.MethodGet, apiPrefix+"/recipes", "gocon", nil))
+
+		// Expected Output: Only gocon's recipe
+		var list []APIRecipe
+		if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].ID != 14 {
+			t.Errorf("Expected gocon's recipe only, got %+v", list)
+		}
+
+		// Input: PUT /api/v1/recipes/14 from another user
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, newRecipeAPIRequest(t, http.MethodPut, apiPrefix+"/recipes/14", "vandle", RecipeInput{Name: "乗っ取り"}))
+
+		// Expected Output: 404
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("Expected status %v, got %v", http.StatusNotFound, status)
+		}
+
+		// Input: PUT /api/v1/recipes/14 from the owner
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, newRecipeAPIRequest(t, http.MethodPut, apiPrefix+"/recipes/14", "gocon", RecipeInput{Name: "塩焼きそば"}))
+
+		// Expected Output: Updated name with the image kept
+		var updated APIRecipe
+		if err := json.NewDecoder(rr.Body).Decode(&updated); err != nil {
+			t.Fatal(err)
+		}
+		if updated.Name != "塩焼きそば" || updated.ContentType != "image/png" {
+			t.Errorf("Unexpected updated recipe %+v", updated)
+		}
+
+		// Input: DELETE /api/v1/recipes/14
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, newRecipeAPIRequest(t, http.MethodDelete, apiPrefix+"/recipes/14", "gocon", nil))
+
+		// Expected Output: 204 and the recipe gone
+		if status := rr.Code; status != http.StatusNoContent {
+			t.Errorf("Expected status %v, got %v", http.StatusNoContent, status)
+		}
+		if _, err := recipes.Get(context.Background(), 14); !errors.Is(err, errRecipeNotFound) {
+			t.Errorf("Expected recipe to be deleted, got %v", err)
+		}
+	})
+
+	t.Run("unsupported translation language -> unprocessable", func(t *testing.T) {
+		useRecipes(t)
+
+		// Input: POST /api/v1/recipes with a French translation
+		req := newRecipeAPIRequest(t, http.MethodPost, apiPrefix+"/recipes", "gocon", RecipeInput{
+			Name: "焼きそば", Translations: map[string]RecipeText{"fr": {Name: "Nouilles"}},
+		})
+		req.Header.Set("Accept-Language", "en")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 422 naming the problem in English
+		var apiErr APIError
+		decodeJSON(t, rr, &apiErr)
+		if rr.Code != http.StatusUnprocessableEntity || apiErr.Error != "Translations must be in ja or en" {
+			t.Errorf("Expected 422 with the English error, got %v %+v", rr.Code, apiErr)
+		}
+	})
+
+	t.Run("invalid JSON -> bad request", func(t *testing.T) {
+		useRecipes(t)
+
+		// Input: POST /api/v1/recipes with an unknown field
+		req := newRecipeAPIRequest(t, http.MethodPost, apiPrefix+"/recipes", "gocon", map[string]string{"title": "x"})
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 400
+		if status := rr.Code; status != http.StatusBadRequest {
+			t.Errorf("Expected status %v, got %v", http.StatusBadRequest, status)
+		}
+	})
+
+	t.Run("not JSON -> unsupported media type", func(t *testing.T) {
+		useRecipes(t)
+
+		testCases := []struct {
+			name   string
+			method string
+			path   string
+		}{
+			{"create", http.MethodPost, apiPrefix + "/recipes"},
+			{"create on the unversioned path", http.MethodPost, "/api/recipes"},
+			{"update", http.MethodPut, apiPrefix + "/recipes/14"},
+		}
+		if err := recipes.Create(context.Background(), &Recipe{Owner: "gocon", Name: "カレー"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tc := range testCases {
+			t.Run(tc.name, func(t *testing.T) {
+				// Input: A JSON recipe sent as text/plain, as a form on another site can
+				req := newRecipeAPIRequest(t, tc.method, tc.path, "gocon", RecipeInput{Name: "x"})
+				req.Header.Set("Content-Type", "text/plain")
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: 415
+				if status := rr.Code; status != http.StatusUnsupportedMediaType {
+					t.Errorf("Expected status %v, got %v", http.StatusUnsupportedMediaType, status)
+				}
+			})
+		}
+		owned, err := listRecipesOwnedBy(context.Background(), "gocon")
+		if err != nil || len(owned) != 1 || owned[0].Name != "カレー" {
+			t.Errorf("Expected gocon's recipe to be unchanged, got %v %v", owned, err)
+		}
+	})
+
+	t.Run("unversioned path -> same API", func(t *testing.T) {
+		// Input: GET /api/recipes/13, the path before the API was versioned
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newRecipeAPIRequest(t, http.MethodGet, "/api/recipes/13", "gocon", nil))
+
+		// Expected Output: Still served
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected status %v, got %v", http.StatusOK, rr.Code)
+		}
+	})
+}
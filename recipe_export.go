@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/base64"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// recipeJSONLD is a recipe as schema.org Recipe structured data
+//
+//nolint:tagliatelle // schema.org property names
+type recipeJSONLD struct {
+	Context      string      `json:"@context"`
+	Type         string      `json:"@type"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description,omitempty"`
+	Image        string      `json:"image,omitempty"`
+	Instructions []howToStep `json:"recipeInstructions,omitempty"`
+}
+
+// howToStep is a step of schema.org recipeInstructions
+//
+//nolint:tagliatelle // schema.org property names
+type howToStep struct {
+	Type string `json:"@type"`
+	Text string `json:"text"`
+}
+
+// StructuredData returns the recipe as schema.org JSON-LD, for the script element of the recipe pages
+func (d RecipeDetailData) StructuredData() recipeJSONLD {
+	data := recipeJSONLD{
+		Context:     "https://schema.org",
+		Type:        "Recipe",
+		Name:        d.Name,
+		Description: d.Description,
+		Image:       d.ImageURL,
+	}
+	for _, step := range d.Steps {
+		data.Instructions = append(data.Instructions, howToStep{Type: "HowToStep", Text: step})
+	}
+	return data
+}
+
+// recipeMarkdown returns the recipe as a Markdown document. imageURL is embedded as the picture of the recipe when set.
+// The fields of the recipe are written by its owner and go through markdownText, so they cannot add links, images or headings.
+func recipeMarkdown(lang string, detail *RecipeDetailData, imageURL string) string {
+	var b strings.Builder
+	b.WriteString("# " + strings.TrimSpace(markdownText(detail.Emoji)+" "+markdownText(detail.Name)) + "\n")
+	if imageURL != "" {
+		b.WriteString("\n![" + markdownText(detail.Name) + "](" + imageURL + ")\n")
+	}
+	if detail.Description != "" {
+		b.WriteString("\n" + markdownText(detail.Description) + "\n")
+	}
+	if len(detail.Steps) > 0 {
+		b.WriteString("\n## " + translate(lang, "recipe.steps") + "\n\n")
+		for i, step := range detail.Steps {
+			b.WriteString(strconv.Itoa(i+1) + ". " + markdownText(step) + "\n")
+		}
+	}
+	return b.String()
+}
+
+// markdownEscaper backslash-escapes the punctuation Markdown gives a meaning to
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "{", `\{`, "}", `\}`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"#", `\#`, "+", `\+`, "-", `\-`, ".", `\.`, "!", `\!`, "|", `\|`, "<", `\<`, ">", `\>`, "~", `\~`,
+)
+
+// markdownText returns s as literal Markdown text on a single line: its line breaks and runs of spaces
+// become single spaces, so it stays on the line it is written to, and its metacharacters are escaped
+func markdownText(s string) string {
+	return markdownEscaper.Replace(strings.Join(strings.Fields(s), " "))
+}
+
+// imageDataURL returns the thumbnail of the recipe as a data URL, so an exported recipe keeps its picture
+// without a session on the site, or "" when the recipe has no image
+func imageDataURL(recipe *Recipe) string {
+	if len(recipe.Image) == 0 {
+		return ""
+	}
+	v := recipeImages.variant(recipe, "thumb")
+	return "data:" + v.contentType + ";base64," + base64.StdEncoding.EncodeToString(v.bytes(recipe))
+}
+
+// markdownDisposition is the Content-Disposition of a recipe exported as Markdown
+func markdownDisposition(id int) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": "recipe-" + strconv.Itoa(id) + ".md"})
+}
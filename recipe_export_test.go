@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecipeMarkdown(t *testing.T) {
+	t.Run("full recipe", func(t *testing.T) {
+		// Input: A recipe with an image, a description and steps
+		detail := &RecipeDetailData{Name: "カレー", Emoji: "🍛", Description: "辛い", Steps: []string{"切る", "煮る"}}
+		got := recipeMarkdown(langEN, detail, "data:image/jpeg;base64,AA==")
+
+		// Expected Output: Title, picture, description and numbered steps under a translated heading
+		expected := "# 🍛 カレー\n\n![カレー](data:image/jpeg;base64,AA==)\n\n辛い\n\n## Directions\n\n1. 切る\n2. 煮る\n"
+		if got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("name only", func(t *testing.T) {
+		// Input: A recipe with nothing but a name
+		// Expected Output: The title alone
+		if got := recipeMarkdown(langJA, &RecipeDetailData{Name: "水"}, ""); got != "# 水\n" {
+			t.Errorf("Expected the title only, got %q", got)
+		}
+	})
+
+	t.Run("markdown in the fields -> escaped text", func(t *testing.T) {
+		// Input: A recipe whose fields try to add a link, a heading, an image and emphasis
+		detail := &RecipeDetailData{
+			Name:        "カレー](https://example.com)",
+			Description: "辛い\n\n# 見出し",
+			Steps:       []string{"![画像](x.png)", "*切る*\n2. 煮る"},
+		}
+		got := recipeMarkdown(langEN, detail, "data:image/jpeg;base64,AA==")
+
+		// Expected Output: The fields as literal text, each on its own line
+		expected := `# カレー\]\(https://example\.com\)` + "\n\n" +
+			`![カレー\]\(https://example\.com\)](data:image/jpeg;base64,AA==)` + "\n\n" +
+			`辛い \# 見出し` + "\n\n## Directions\n\n" +
+			`1. \!\[画像\]\(x\.png\)` + "\n" +
+			`2. \*切る\* 2\. 煮る` + "\n"
+		if got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	})
+}
+
+func TestRecipeExport(t *testing.T) {
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, path, kanmuUser, nil))
+		return rr
+	}
+
+	t.Run("markdown -> download with the embedded thumbnail", func(t *testing.T) {
+		// Input: Export recipe 2 as Markdown
+		rr := get(t, "/recipe/2?format=markdown")
+
+		// Expected Output: An attachment named after the recipe, with the thumbnail as a data URL
+		_, params, err := mime.ParseMediaType(rr.Header().Get("Content-Disposition"))
+		if err != nil || params["filename"] != "recipe-2.md" {
+			t.Errorf("Expected recipe-2.md, got %q", rr.Header().Get("Content-Disposition"))
+		}
+		m := regexp.MustCompile(`!\[ぎょうざ\]\(data:image/jpeg;base64,([^)]+)\)`).FindStringSubmatch(rr.Body.String())
+		if m == nil {
+			t.Fatalf("Expected the embedded image, got %q", rr.Body.String()[:min(rr.Body.Len(), 200)])
+		}
+		data, err := base64.StdEncoding.DecodeString(m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || max(config.Width, config.Height) != imageSizes["thumb"] {
+			t.Errorf("Expected the thumbnail, got %+v %v", config, err)
+		}
+	})
+
+	for _, format := range []string{formatHTML, formatPrint} {
+		t.Run(format+" -> schema.org Recipe JSON-LD", func(t *testing.T) {
+			// Input: GET the recipe page
+			rr := get(t, "/recipe/2?format="+format)
+
+			// Expected Output: A JSON-LD script describing the recipe
+			m := regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`).FindStringSubmatch(rr.Body.String())
+			if m == nil {
+				t.Fatal("Expected a JSON-LD script")
+			}
+			var data recipeJSONLD
+			if err := json.Unmarshal([]byte(m[1]), &data); err != nil {
+				t.Fatalf("Expected JSON, got %q: %v", m[1], err)
+			}
+			seed := recipeDatabase[2]
+			if data.Context != "https://schema.org" || data.Type != "Recipe" || data.Name != seed.Name || data.Image != recipeImageURL(2) {
+				t.Errorf("Unexpected structured data %+v", data)
+			}
+			if len(data.Instructions) != len(seed.Steps) || data.Instructions[0].Type != "HowToStep" || data.Instructions[0].Text != seed.Steps[0] {
+				t.Errorf("Expected the steps as HowToStep, got %+v", data.Instructions)
+			}
+		})
+	}
+
+	t.Run("detail page -> export links", func(t *testing.T) {
+		// Input: GET the recipe page
+		body := get(t, "/recipe/2").Body.String()
+
+		// Expected Output: Links to the Markdown export and the print view
+		for _, expected := range []string{`href="/recipe/2?format=markdown"`, `href="/recipe/2?format=print"`} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected %s in the page", expected)
+			}
+		}
+	})
+}
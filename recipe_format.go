@@ -0,0 +1,101 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Representations of a recipe served by /recipe/{id}
+const (
+	formatHTML     = "html"
+	formatImage    = "image"
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+	formatPrint    = "print"
+)
+
+// recipeFormats are the values of the format parameter of /recipe/{id}.
+// When an Accept header ranks several equally, the earlier one is served.
+var recipeFormats = []string{formatHTML, formatJSON, formatMarkdown, formatImage, formatPrint}
+
+// recipeFormatTypes are the media types selecting each format in an Accept header.
+// The print view is an HTML page and can only be asked for with the format parameter.
+var recipeFormatTypes = map[string]string{
+	formatHTML:     "text/html",
+	formatJSON:     "application/json",
+	formatMarkdown: "text/markdown",
+	formatImage:    "image/*",
+}
+
+// recipeFormat returns the representation a request for a recipe asks for: the format parameter,
+// then JSON for the API, then the format the Accept header ranks highest.
+// It reports false when the format is unknown or the Accept header accepts none of them.
+func recipeFormat(r *http.Request) (string, bool) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format, slices.Contains(recipeFormats, format)
+	}
+	if strings.HasPrefix(r.URL.Path, apiPrefix) {
+		return formatJSON, true
+	}
+	if accept := r.Header.Get("Accept"); accept != "" {
+		return acceptedRecipeFormat(accept)
+	}
+	return formatHTML, true
+}
+
+// acceptedRecipeFormat returns the format an Accept header ranks highest.
+// Each format takes the quality of the most specific media range matching it.
+func acceptedRecipeFormat(accept string) (string, bool) {
+	best, bestQ := "", 0.0
+	for _, format := range recipeFormats {
+		mediaType, ok := recipeFormatTypes[format]
+		if !ok {
+			continue
+		}
+		q, specificity := 0.0, -1
+		for _, part := range strings.Split(accept, ",") {
+			accepted, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			s, ok := mediaRangeMatch(accepted, mediaType)
+			if !ok || s <= specificity {
+				continue
+			}
+			rangeQ := 1.0
+			if v, ok := params["q"]; ok {
+				if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+					continue
+				}
+			}
+			q, specificity = rangeQ, s
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best, best != ""
+}
+
+// mediaRangeMatch reports whether the media range accepted matches mediaType,
+// with its specificity: 2 for the same type, 1 for type/*, 0 for */*.
+// A mediaType of type/* matches every subtype of the type.
+func mediaRangeMatch(accepted, mediaType string) (int, bool) {
+	acceptedType, acceptedSub, _ := strings.Cut(accepted, "/")
+	typ, sub, _ := strings.Cut(mediaType, "/")
+	switch {
+	case accepted == "*/*":
+		return 0, true
+	case acceptedType != typ:
+		return 0, false
+	case acceptedSub == "*":
+		return 1, true
+	case acceptedSub == sub || sub == "*":
+		return 2, true
+	default:
+		return 0, false
+	}
+}
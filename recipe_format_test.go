@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRecipeFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		path     string
+		accept   string
+		expected string
+		ok       bool
+	}{
+		{"no format -> html", "/recipe/2", "", formatHTML, true},
+		{"format parameter", "/recipe/2?format=markdown", "text/html", formatMarkdown, true},
+		{"print parameter", "/recipe/2?format=print", "", formatPrint, true},
+		{"unknown parameter", "/recipe/2?format=notanimage", "", "notanimage", false},
+		{"API -> json", apiPrefix + "/recipe/2", "text/html", formatJSON, true},
+		{"browser page", "/recipe/2", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8", formatHTML, true},
+		{"browser image", "/recipe/2", "image/avif,image/webp,image/apng,image/*,*/*;q=0.8", formatImage, true},
+		{"json preferred", "/recipe/2", "application/json, text/html;q=0.5", formatJSON, true},
+		{"markdown", "/recipe/2", "text/markdown", formatMarkdown, true},
+		{"most specific range wins", "/recipe/2", "text/html;q=0, text/*", formatMarkdown, true},
+		{"nothing acceptable", "/recipe/2", "application/pdf", "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: A recipe request with a format parameter or Accept header
+			req := httptest.NewRequestWithContext(context.Background(), http.MethodGet, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			// Expected Output: The representation asked for, and whether it is served
+			format, ok := recipeFormat(req)
+			if format != tc.expected || ok != tc.ok {
+				t.Errorf("Expected %q %v, got %q %v", tc.expected, tc.ok, format, ok)
+			}
+		})
+	}
+}
+
+func TestRecipeRepresentations(t *testing.T) {
+	get := func(t *testing.T, path, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req := newAPIRequest(t, http.MethodGet, path, kanmuUser, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("unknown format -> 406", func(t *testing.T) {
+		// Input: A format containing "image" that is not a format
+		rr := get(t, "/recipe/2?format=notanimage", "")
+
+		// Expected Output: Not Acceptable instead of the image
+		if rr.Code != http.StatusNotAcceptable || strings.HasPrefix(rr.Header().Get("Content-Type"), "image/") {
+			t.Errorf("Expected 406, got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+		}
+	})
+
+	t.Run("unacceptable Accept -> 406", func(t *testing.T) {
+		// Input: An Accept header no format matches
+		rr := get(t, "/recipe/2", "application/pdf")
+
+		// Expected Output: Not Acceptable
+		if rr.Code != http.StatusNotAcceptable {
+			t.Errorf("Expected 406, got %v", rr.Code)
+		}
+	})
+
+	t.Run("markdown -> document", func(t *testing.T) {
+		// Input: GET the recipe as Markdown
+		rr := get(t, "/recipe/2?format=markdown", "")
+
+		// Expected Output: A Markdown document with the numbered steps
+		body := rr.Body.String()
+		if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/markdown") {
+			t.Fatalf("Expected Markdown, got %v %q", rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if !strings.HasPrefix(body, "# 🥟 ぎょうざ\n") || !strings.Contains(body, "\n## 作り方\n\n1. ") {
+			t.Errorf("Unexpected Markdown %q", body)
+		}
+	})
+
+	t.Run("print -> print view", func(t *testing.T) {
+		// Input: GET the print view
+		rr := get(t, "/recipe/2?format=print", "")
+
+		// Expected Output: The recipe without the site decoration
+		body := rr.Body.String()
+		if rr.Code != http.StatusOK || !strings.Contains(body, `<body class="print">`) || strings.Contains(body, "floating-shapes\">") {
+			t.Errorf("Expected the print view, got %v", rr.Code)
+		}
+	})
+
+	t.Run("Accept image -> image and Vary", func(t *testing.T) {
+		// Input: GET the recipe path as an img element would
+		rr := get(t, "/recipe/2", "image/webp,image/*,*/*;q=0.8")
+
+		// Expected Output: The image, varying by Accept
+		if rr.Header().Get("Content-Type") != "image/jpeg" || !slices.Contains(rr.Header().Values("Vary"), "Accept") {
+			t.Errorf("Expected the image varying by Accept, got %q %q", rr.Header().Get("Content-Type"), rr.Header().Values("Vary"))
+		}
+	})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+var errRecipeNotFound = errors.New("recipe not found")
+
+// RecipeRepository stores recipes
+type RecipeRepository interface {
+	Get(ctx context.Context, id int) (*Recipe, error)
+	// List returns every recipe ordered by ID
+	List(ctx context.Context) ([]*Recipe, error)
+	// Create stores a new recipe and assigns its ID
+	Create(ctx context.Context, recipe *Recipe) error
+	Update(ctx context.Context, recipe *Recipe) error
+	Delete(ctx context.Context, id int) error
+}
+
+// recipes is the repository used by the handlers
+var recipes RecipeRepository = newMemoryRecipeRepository(recipeDatabase)
+
+// copyRecipe returns a copy so callers cannot modify stored recipes
+func copyRecipe(recipe *Recipe) *Recipe {
+	c := *recipe
+	c.Steps = slices.Clone(recipe.Steps)
+	c.SharedWith = slices.Clone(recipe.SharedWith)
+	if recipe.Translations != nil {
+		c.Translations = make(map[string]RecipeText, len(recipe.Translations))
+		for lang, text := range recipe.Translations {
+			text.Steps = slices.Clone(text.Steps)
+			c.Translations[lang] = text
+		}
+	}
+	return &c
+}
+
+// memoryRecipeRepository keeps recipes in memory
+type memoryRecipeRepository struct {
+	mu      sync.RWMutex
+	recipes map[int]*Recipe
+	nextID  int
+}
+
+// newMemoryRecipeRepository returns a repository seeded with copies of seed
+func newMemoryRecipeRepository(seed map[int]*Recipe) *memoryRecipeRepository {
+	m := &memoryRecipeRepository{recipes: make(map[int]*Recipe, len(seed)), nextID: 1}
+	for id, recipe := range seed {
+		m.recipes[id] = copyRecipe(recipe)
+		m.nextID = max(m.nextID, id+1)
+	}
+	return m
+}
+
+func (m *memoryRecipeRepository) Get(_ context.Context, id int) (*Recipe, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	recipe, ok := m.recipes[id]
+	if !ok {
+		return nil, errRecipeNotFound
+	}
+	return copyRecipe(recipe), nil
+}
+
+func (m *memoryRecipeRepository) List(_ context.Context) ([]*Recipe, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Recipe, 0, len(m.recipes))
+	for _, id := range slices.Sorted(maps.Keys(m.recipes)) {
+		list = append(list, copyRecipe(m.recipes[id]))
+	}
+	return list, nil
+}
+
+func (m *memoryRecipeRepository) Create(_ context.Context, recipe *Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recipe.ID = m.nextID
+	m.nextID++
+	recipe.UpdatedAt = time.Now()
+	m.recipes[recipe.ID] = copyRecipe(recipe)
+	return nil
+}
+
+func (m *memoryRecipeRepository) Update(_ context.Context, recipe *Recipe) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.recipes[recipe.ID]; !ok {
+		return errRecipeNotFound
+	}
+	recipe.UpdatedAt = time.Now()
+	m.recipes[recipe.ID] = copyRecipe(recipe)
+	return nil
+}
+
+func (m *memoryRecipeRepository) Delete(_ context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.recipes[id]; !ok {
+		return errRecipeNotFound
+	}
+	delete(m.recipes, id)
+	return nil
+}
+
+// sqliteRecipeRepository stores recipes in a SQLite database
+type sqliteRecipeRepository struct {
+	db *sql.DB
+}
+
+const recipeSchema = `CREATE TABLE IF NOT EXISTS recipes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	owner TEXT NOT NULL DEFAULT '',
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	emoji TEXT NOT NULL DEFAULT '',
+	image BLOB,
+	content_type TEXT NOT NULL DEFAULT '',
+	steps TEXT NOT NULL DEFAULT '[]',
+	visibility TEXT NOT NULL DEFAULT 'private',
+	shared_with TEXT NOT NULL DEFAULT '[]',
+	translations TEXT NOT NULL DEFAULT '{}',
+	updated_at INTEGER NOT NULL DEFAULT 0
+)`
+
+const recipeColumns = "id, owner, name, description, emoji, image, content_type, steps, visibility, shared_with, translations, updated_at"
+
+// openSQLiteRecipeRepository opens the database at path, seeding it with seed when it has no recipes
+func openSQLiteRecipeRepository(ctx context.Context, path string, seed map[int]*Recipe) (*sqliteRecipeRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	repo := &sqliteRecipeRepository{db: db}
+	if err := repo.init(ctx, seed); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return repo, nil
+}
+
+func (s *sqliteRecipeRepository) init(ctx context.Context, seed map[int]*Recipe) error {
+	if _, err := s.db.ExecContext(ctx, recipeSchema); err != nil {
+		return err
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recipes").Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	for _, id := range slices.Sorted(maps.Keys(seed)) {
+		if err := s.insert(ctx, seed[id], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database
+func (s *sqliteRecipeRepository) Close() error {
+	return s.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRecipe(row rowScanner) (*Recipe, error) {
+	var recipe Recipe
+	var steps, sharedWith, translations string
+	var updatedAt int64
+	if err := row.Scan(&recipe.ID, &recipe.Owner, &recipe.Name, &recipe.Description, &recipe.Emoji,
+		&recipe.Image, &recipe.ContentType, &steps, &recipe.Visibility, &sharedWith, &translations, &updatedAt); err != nil {
+		return nil, err
+	}
+	if updatedAt != 0 {
+		recipe.UpdatedAt = time.Unix(0, updatedAt)
+	}
+	if err := json.Unmarshal([]byte(steps), &recipe.Steps); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(sharedWith), &recipe.SharedWith); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(translations), &recipe.Translations); err != nil {
+		return nil, err
+	}
+	return &recipe, nil
+}
+
+func (s *sqliteRecipeRepository) Get(ctx context.Context, id int) (*Recipe, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+recipeColumns+" FROM recipes WHERE id = ?", id)
+	recipe, err := scanRecipe(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errRecipeNotFound
+	}
+	return recipe, err
+}
+
+func (s *sqliteRecipeRepository) List(ctx context.Context) ([]*Recipe, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+recipeColumns+" FROM recipes ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Recipe
+	for rows.Next() {
+		recipe, err := scanRecipe(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, recipe)
+	}
+	return list, rows.Err()
+}
+
+// insert stores the recipe, keeping its ID when withID is set
+func (s *sqliteRecipeRepository) insert(ctx context.Context, recipe *Recipe, withID bool) error {
+	steps, sharedWith, translations, err := encodeRecipeColumns(recipe)
+	if err != nil {
+		return err
+	}
+
+	// Seeded recipes keep their ID and their zero update time
+	var id any
+	var updatedAt int64
+	if withID {
+		id = recipe.ID
+	} else {
+		recipe.UpdatedAt = time.Now()
+		updatedAt = recipe.UpdatedAt.UnixNano()
+	}
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO recipes ("+recipeColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		id, recipe.Owner, recipe.Name, recipe.Description, recipe.Emoji, recipe.Image, recipe.ContentType, steps,
+		recipeVisibility(recipe), sharedWith, translations, updatedAt)
+	if err != nil {
+		return err
+	}
+	if !withID {
+		lastID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		recipe.ID = int(lastID)
+	}
+	return nil
+}
+
+func (s *sqliteRecipeRepository) Create(ctx context.Context, recipe *Recipe) error {
+	return s.insert(ctx, recipe, false)
+}
+
+func (s *sqliteRecipeRepository) Update(ctx context.Context, recipe *Recipe) error {
+	steps, sharedWith, translations, err := encodeRecipeColumns(recipe)
+	if err != nil {
+		return err
+	}
+	updatedAt := time.Now()
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE recipes SET owner = ?, name = ?, description = ?, emoji = ?, image = ?, content_type = ?, steps = ?, visibility = ?, shared_with = ?, translations = ?, updated_at = ? WHERE id = ?",
+		recipe.Owner, recipe.Name, recipe.Description, recipe.Emoji, recipe.Image, recipe.ContentType, steps,
+		recipeVisibility(recipe), sharedWith, translations, updatedAt.UnixNano(), recipe.ID)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+	recipe.UpdatedAt = updatedAt
+	return nil
+}
+
+func (s *sqliteRecipeRepository) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM recipes WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+// encodeRecipeColumns returns the steps, shared users and translations as the JSON stored in their columns
+func encodeRecipeColumns(recipe *Recipe) (string, string, string, error) {
+	steps, err := json.Marshal(recipe.Steps)
+	if err != nil {
+		return "", "", "", err
+	}
+	sharedWith, err := json.Marshal(recipe.SharedWith)
+	if err != nil {
+		return "", "", "", err
+	}
+	translations := []byte("{}")
+	if len(recipe.Translations) > 0 {
+		if translations, err = json.Marshal(recipe.Translations); err != nil {
+			return "", "", "", err
+		}
+	}
+	return string(steps), string(sharedWith), string(translations), nil
+}
+
+// recipeVisibility returns the stored visibility, treating an unset one as private
+func recipeVisibility(recipe *Recipe) Visibility {
+	if recipe.Visibility == "" {
+		return VisibilityPrivate
+	}
+	return recipe.Visibility
+}
+
+// requireAffected turns an update of zero rows into errRecipeNotFound
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errRecipeNotFound
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRecipeRepository(t *testing.T) {
+	repositories := map[string]func(t *testing.T) RecipeRepository{
+		"memory": func(t *testing.T) RecipeRepository {
+			t.Helper()
+			return newMemoryRecipeRepository(recipeDatabase)
+		},
+		"sqlite": func(t *testing.T) RecipeRepository {
+			t.Helper()
+			repo, err := openSQLiteRecipeRepository(context.Background(), filepath.Join(t.TempDir(), "recipes.db"), recipeDatabase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = repo.Close() })
+			return repo
+		},
+	}
+
+	for name, newRepo := range repositories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			t.Run("seeded recipes", func(t *testing.T) {
+				repo := newRepo(t)
+
+				// Input: Get recipe 13
+				recipe, err := repo.Get(ctx, flagRecipeID)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Expected Output: The seeded steak sauce recipe with its image and no update time
+				if !recipe.UpdatedAt.IsZero() {
+					t.Errorf("Expected no update time, got %v", recipe.UpdatedAt)
+				}
+				seed := recipeDatabase[flagRecipeID]
+				if recipe.Name != seed.Name || recipe.Owner != seed.Owner || recipe.ContentType != seed.ContentType {
+					t.Errorf("Expected %q owned by %q, got %q owned by %q", seed.Name, seed.Owner, recipe.Name, recipe.Owner)
+				}
+				if len(recipe.Image) != len(seed.Image) || len(recipe.Steps) != len(seed.Steps) {
+					t.Error("Expected image and steps to be stored")
+				}
+				if recipe.Visibility != VisibilityShared || !slices.Equal(recipe.SharedWith, seed.SharedWith) {
+					t.Errorf("Expected visibility shared with %q, got %q with %q", seed.SharedWith, recipe.Visibility, recipe.SharedWith)
+				}
+				if en := recipe.Translations[langEN]; en.Name != seed.Translations[langEN].Name || !slices.Equal(en.Steps, seed.Translations[langEN].Steps) {
+					t.Errorf("Expected the English translation to be stored, got %+v", recipe.Translations)
+				}
+
+				// Input: List recipes
+				list, err := repo.List(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Expected Output: Every seeded recipe ordered by ID
+				if len(list) != len(recipeDatabase) {
+					t.Fatalf("Expected %d recipes, got %d", len(recipeDatabase), len(list))
+				}
+				for i := 1; i < len(list); i++ {
+					if list[i-1].ID >= list[i].ID {
+						t.Errorf("Expected recipes ordered by ID, got %d before %d", list[i-1].ID, list[i].ID)
+					}
+				}
+			})
+
+			t.Run("create, update and delete", func(t *testing.T) {
+				repo := newRepo(t)
+
+				// Input: Create a new recipe
+				recipe := &Recipe{Owner: kanmuUser, Name: "親子丼", Emoji: "🍳", Steps: []string{"煮る", "とじる"}}
+				if err := repo.Create(ctx, recipe); err != nil {
+					t.Fatal(err)
+				}
+
+				// Expected Output: An ID after the seeded recipes and an update time
+				if recipe.ID <= flagRecipeID {
+					t.Errorf("Expected ID greater than %d, got %d", flagRecipeID, recipe.ID)
+				}
+				created := recipe.UpdatedAt
+				if created.IsZero() {
+					t.Error("Expected the update time to be set")
+				}
+
+				// Input: Update the recipe
+				recipe.Name = "他人丼"
+				if err := repo.Update(ctx, recipe); err != nil {
+					t.Fatal(err)
+				}
+
+				// Expected Output: The updated recipe is returned
+				got, err := repo.Get(ctx, recipe.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Name != "他人丼" || len(got.Steps) != 2 {
+					t.Errorf("Expected updated recipe, got %+v", got)
+				}
+				if !got.UpdatedAt.After(created) || !got.UpdatedAt.Equal(recipe.UpdatedAt) {
+					t.Errorf("Expected a later update time, got %v after %v", got.UpdatedAt, created)
+				}
+
+				// Input: Delete the recipe
+				if err := repo.Delete(ctx, recipe.ID); err != nil {
+					t.Fatal(err)
+				}
+
+				// Expected Output: The recipe is gone
+				if _, err := repo.Get(ctx, recipe.ID); !errors.Is(err, errRecipeNotFound) {
+					t.Errorf("Expected errRecipeNotFound, got %v", err)
+				}
+			})
+
+			t.Run("missing recipe -> errRecipeNotFound", func(t *testing.T) {
+				repo := newRepo(t)
+
+				// Input: Operations on a recipe that does not exist
+				// Expected Output: errRecipeNotFound
+				if _, err := repo.Get(ctx, 999); !errors.Is(err, errRecipeNotFound) {
+					t.Errorf("Get: expected errRecipeNotFound, got %v", err)
+				}
+				if err := repo.Update(ctx, &Recipe{ID: 999, Name: "x"}); !errors.Is(err, errRecipeNotFound) {
+					t.Errorf("Update: expected errRecipeNotFound, got %v", err)
+				}
+				if err := repo.Delete(ctx, 999); !errors.Is(err, errRecipeNotFound) {
+					t.Errorf("Delete: expected errRecipeNotFound, got %v", err)
+				}
+			})
+
+			t.Run("returned recipes are copies", func(t *testing.T) {
+				repo := newRepo(t)
+
+				// Input: Modify a recipe returned by Get
+				recipe, err := repo.Get(ctx, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recipe.Steps[0] = "changed"
+				recipe.Translations[langEN].Steps[0] = "changed"
+
+				// Expected Output: The stored recipe is unchanged
+				again, err := repo.Get(ctx, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if again.Steps[0] == "changed" || again.Translations[langEN].Steps[0] == "changed" {
+					t.Error("Expected stored recipe to be unchanged")
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Visibility decides who besides the owner can see a recipe
+type Visibility string
+
+const (
+	// VisibilityPrivate recipes are only visible to their owner
+	VisibilityPrivate Visibility = "private"
+	// VisibilityShared recipes are visible to their owner and the users in SharedWith
+	VisibilityShared Visibility = "shared"
+	// VisibilityPublic recipes are visible to every logged in user
+	VisibilityPublic Visibility = "public"
+)
+
+var errUnknownVisibility = messageError("recipe.unknown_visibility")
+
+// parseVisibility parses a visibility; an empty string means private
+func parseVisibility(s string) (Visibility, error) {
+	switch v := Visibility(strings.TrimSpace(s)); v {
+	case "":
+		return VisibilityPrivate, nil
+	case VisibilityPrivate, VisibilityShared, VisibilityPublic:
+		return v, nil
+	default:
+		return "", errUnknownVisibility
+	}
+}
+
+// visibleTo reports whether the recipe's visibility lets user see it
+func (r *Recipe) visibleTo(user string) bool {
+	if r.Owner != "" && r.Owner == user {
+		return true
+	}
+	switch r.Visibility {
+	case VisibilityPublic:
+		return true
+	case VisibilityShared:
+		return slices.Contains(r.SharedWith, user)
+	default:
+		return false
+	}
+}
+
+// listedFor reports whether the dashboard of user lists the recipe, which is its visibility.
+// While the IDOR stage is played the steak sauce recipe is listed for every user but kanmu as before,
+// whose dashboard must not give the hidden recipe away.
+func (r *Recipe) listedFor(user string) bool {
+	if r.ID == flagRecipeID && vulnerable(recipeIDORID) {
+		return user != kanmuUser
+	}
+	return r.visibleTo(user)
+}
+
+// listVisibleRecipes returns the recipes listed on the dashboard of user
+func listVisibleRecipes(ctx context.Context, user string) ([]*Recipe, error) {
+	list, err := recipes.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var visible []*Recipe
+	for _, recipe := range list {
+		if recipe.listedFor(user) {
+			visible = append(visible, recipe)
+		}
+	}
+	return visible, nil
+}
+
+// splitUsers parses a comma or whitespace separated list of users
+func splitUsers(s string) []string {
+	users := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t' || r == '、'
+	})
+	slices.Sort(users)
+	return slices.Compact(users)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseVisibility(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Visibility
+		wantErr  bool
+	}{
+		{"", VisibilityPrivate, false},
+		{"private", VisibilityPrivate, false},
+		{"shared", VisibilityShared, false},
+		{" public ", VisibilityPublic, false},
+		{"everyone", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			// Input: Visibility string
+			v, err := parseVisibility(tc.input)
+
+			// Expected Output: Parsed visibility or error
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error %v, got %v", tc.wantErr, err)
+			}
+			if v != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, v)
+			}
+		})
+	}
+}
+
+// visibilityCases lists every visibility against the owner, a shared user and anyone else
+var visibilityCases = []struct {
+	visibility Visibility
+	user       string
+	visible    bool
+}{
+	{VisibilityPrivate, "gocon", true},
+	{VisibilityPrivate, "vandle", false},
+	{VisibilityPrivate, "kanmu", false},
+	{VisibilityShared, "gocon", true},
+	{VisibilityShared, "vandle", true},
+	{VisibilityShared, "kanmu", false},
+	{VisibilityPublic, "gocon", true},
+	{VisibilityPublic, "vandle", true},
+	{VisibilityPublic, "kanmu", true},
+}
+
+// visibilityCaseName describes a case as seen from the recipe owned by gocon and shared with vandle
+func visibilityCaseName(visibility Visibility, user string) string {
+	relation := "other user"
+	switch user {
+	case "gocon":
+		relation = "owner"
+	case "vandle":
+		relation = "shared user"
+	}
+	return string(visibility) + " recipe, " + relation
+}
+
+func TestCanViewRecipe(t *testing.T) {
+	for _, m := range []appMode{modeVulnerable, modeHardened} {
+		for _, tc := range visibilityCases {
+			t.Run(string(m)+"/"+visibilityCaseName(tc.visibility, tc.user), func(t *testing.T) {
+				setMode(t, m)
+				recipe := &Recipe{ID: 20, Owner: "gocon", Visibility: tc.visibility, SharedWith: []string{"vandle"}}
+
+				// Input: Recipe with the visibility and a viewer
+				// Expected Output: Visibility enforced in hardened mode, IDOR left open in vulnerable mode
+				expected := tc.visible || m == modeVulnerable
+				if got := canViewRecipe(tc.user, recipe); got != expected {
+					t.Errorf("Expected %v, got %v", expected, got)
+				}
+				if got := recipe.visibleTo(tc.user); got != tc.visible {
+					t.Errorf("Expected visibleTo %v, got %v", tc.visible, got)
+				}
+			})
+		}
+	}
+
+	t.Run("recipe without owner -> hidden from everyone", func(t *testing.T) {
+		// Input: Seeded sashimi recipe without owner
+		// Expected Output: Not visible to any user, even an empty one
+		recipe := recipeDatabase[4]
+		for _, user := range []string{"", "kanmu", "admin"} {
+			if recipe.visibleTo(user) {
+				t.Errorf("Expected sashimi to be hidden from %q", user)
+			}
+		}
+	})
+}
+
+func TestRecipeAuthorization(t *testing.T) {
+	setMode(t, modeHardened)
+	useRecipes(t)
+
+	ids := make(map[Visibility]int)
+	for _, v := range []Visibility{VisibilityPrivate, VisibilityShared, VisibilityPublic} {
+		recipe := &Recipe{
+			Owner: "gocon", Name: string(v), Visibility: v, SharedWith: []string{"vandle"},
+			Image: newPNG(t), ContentType: "image/png",
+		}
+		if err := recipes.Create(context.Background(), recipe); err != nil {
+			t.Fatal(err)
+		}
+		ids[v] = recipe.ID
+	}
+
+	for _, tc := range visibilityCases {
+		for _, format := range []string{"", "image"} {
+			name := visibilityCaseName(tc.visibility, tc.user)
+			if format != "" {
+				name += ", format=" + format
+			}
+			t.Run(name, func(t *testing.T) {
+				// Input: GET /recipe/{id} with a signed session
+				path := "/recipe/" + strconv.Itoa(ids[tc.visibility])
+				if format != "" {
+					path += "?format=" + format
+				}
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, path, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, tc.user)})
+
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: 200 with the page or image when visible, 404 otherwise
+				expected := http.StatusNotFound
+				if tc.visible {
+					expected = http.StatusOK
+				}
+				if status := rr.Code; status != expected {
+					t.Fatalf("Expected status %v, got %v", expected, status)
+				}
+				if tc.visible && format == "image" && rr.Header().Get("Content-Type") != "image/png" {
+					t.Errorf("Expected image/png, got %q", rr.Header().Get("Content-Type"))
+				}
+			})
+		}
+	}
+}
+
+func TestDownloadAuthorization(t *testing.T) {
+	for _, m := range []appMode{modeVulnerable, modeHardened} {
+		for _, tc := range visibilityCases {
+			t.Run(string(m)+"/"+visibilityCaseName(tc.visibility, tc.user), func(t *testing.T) {
+				setMode(t, m)
+				useRecipes(t)
+
+				// Input: flag.zip attached to a steak sauce recipe owned by gocon with the visibility
+				recipe, err := recipes.Get(context.Background(), flagRecipeID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				recipe.Owner, recipe.Visibility, recipe.SharedWith = "gocon", tc.visibility, []string{"vandle"}
+				if err := recipes.Update(context.Background(), recipe); err != nil {
+					t.Fatal(err)
+				}
+
+				req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/download/flag.zip", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if m == modeHardened {
+					req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, tc.user)})
+				} else {
+					req.AddCookie(&http.Cookie{Name: "user", Value: tc.user})
+				}
+
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				// Expected Output: The zip when the recipe is visible or in vulnerable mode, 404 otherwise
+				expected := http.StatusNotFound
+				if tc.visible || m == modeVulnerable {
+					expected = http.StatusOK
+				}
+				if status := rr.Code; status != expected {
+					t.Fatalf("Expected status %v, got %v", expected, status)
+				}
+				if expected == http.StatusOK && rr.Header().Get("Content-Type") != "application/zip" {
+					t.Errorf("Expected application/zip, got %q", rr.Header().Get("Content-Type"))
+				}
+			})
+		}
+	}
+}
+
+func TestListedFor(t *testing.T) {
+	for _, tc := range visibilityCases {
+		t.Run(visibilityCaseName(tc.visibility, tc.user), func(t *testing.T) {
+			setMode(t, modeVulnerable)
+			recipe := &Recipe{ID: 20, Owner: "gocon", Visibility: tc.visibility, SharedWith: []string{"vandle"}}
+
+			// Input: A recipe other than the steak sauce in vulnerable mode
+			// Expected Output: Listed by its visibility, including SharedWith
+			if got := recipe.listedFor(tc.user); got != tc.visible {
+				t.Errorf("Expected %v, got %v", tc.visible, got)
+			}
+		})
+	}
+}
+
+func TestDashboardVisibility(t *testing.T) {
+	testCases := []struct {
+		mode     appMode
+		user     string
+		visible  []string
+		excluded []string
+	}{
+		{modeVulnerable, "kanmu", []string{"/recipe/2", "/recipe/3", "/recipe/5"}, []string{"/recipe/4", "/recipe/13"}},
+		{modeVulnerable, "admin", []string{"/recipe/13"}, []string{"/recipe/2", "/recipe/4"}},
+		{modeVulnerable, "gocon", []string{"/recipe/13"}, []string{"/recipe/2", "/recipe/4"}},
+		{modeVulnerable, "stranger", []string{"/recipe/13"}, []string{"/recipe/2", "/recipe/4"}},
+		{modeHardened, "kanmu", []string{"/recipe/2", "/recipe/3", "/recipe/5"}, []string{"/recipe/4", "/recipe/13"}},
+		{modeHardened, "gocon", []string{"/recipe/13"}, []string{"/recipe/2", "/recipe/4"}},
+		{modeHardened, "stranger", nil, []string{"/recipe/2", "/recipe/4", "/recipe/13"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.mode)+"/"+tc.user, func(t *testing.T) {
+			setMode(t, tc.mode)
+
+			// Input: GET /dashboard as the user
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/dashboard", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.mode == modeHardened {
+				req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: newSessionToken(t, tc.user)})
+			} else {
+				req.AddCookie(&http.Cookie{Name: "user", Value: tc.user})
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(dashboardHandler).ServeHTTP(rr, req)
+
+			// Expected Output: Own, shared and public recipes only, and recipe 13 for everyone but kanmu in vulnerable mode
+			body := rr.Body.String()
+			for _, link := range tc.visible {
+				if !strings.Contains(body, `"`+link+`"`) {
+					t.Errorf("Expected %s on %s's dashboard", link, tc.user)
+				}
+			}
+			for _, link := range tc.excluded {
+				if strings.Contains(body, `"`+link+`"`) {
+					t.Errorf("Expected %s not on %s's dashboard", link, tc.user)
+				}
+			}
+		})
+	}
+}
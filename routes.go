@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+// standardMethods are the methods routes are registered for; GET routes also serve HEAD
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// newRouter returns the handler of the site: its pages, on which the built-in challenges are played,
+// and the routes of the other challenges
+func newRouter(challenges []challenge.Challenge) http.Handler {
+	mux := http.NewServeMux()
+	challenge.Mount(mux, challenges)
+
+	mux.HandleFunc("GET /{$}", loginPageHandler)
+	mux.HandleFunc("GET /login", loginPageHandler)
+	mux.HandleFunc("POST /login", loginHandler)
+	mux.HandleFunc("GET /dashboard", dashboardHandler)
+	mux.HandleFunc("GET /recipe/{id}", recipeHandler)
+	mux.HandleFunc("GET /download/{filename}", downloadHandler)
+	mux.HandleFunc("POST "+apiPrefix+"/login", loginHandler)
+	mux.HandleFunc("GET "+apiPrefix+"/dashboard", dashboardHandler)
+	mux.HandleFunc("GET "+apiPrefix+"/recipe/{id}", recipeHandler)
+
+	mux.HandleFunc("POST /logout", logoutHandler)
+	mux.HandleFunc("POST /submit", submitHandler)
+	mux.HandleFunc("GET /scoreboard", scoreboardHandler)
+	mux.HandleFunc("POST /hints/unlock", hintUnlockHandler)
+	mux.HandleFunc("POST "+apiPrefix+"/hints/unlock", hintUnlockHandler)
+
+	mux.HandleFunc("GET /recipes/new", newRecipeHandler)
+	mux.HandleFunc("POST /recipes/new", newRecipeHandler)
+	mux.HandleFunc("GET /recipes/{id}/edit", editRecipeHandler)
+	mux.HandleFunc("POST /recipes/{id}/edit", editRecipeHandler)
+	mux.HandleFunc("POST /recipes/{id}/delete", deleteRecipeHandler)
+	// The recipe API was first served without the version, and both paths keep serving it
+	for _, prefix := range []string{"/api", apiPrefix} {
+		mux.HandleFunc("GET "+prefix+"/recipes", recipesAPIHandler)
+		mux.HandleFunc("POST "+prefix+"/recipes", recipesAPIHandler)
+		mux.HandleFunc("GET "+prefix+"/recipes/{id}", recipeAPIHandler)
+		mux.HandleFunc("PUT "+prefix+"/recipes/{id}", recipeAPIHandler)
+		mux.HandleFunc("DELETE "+prefix+"/recipes/{id}", recipeAPIHandler)
+	}
+
+	for _, prefix := range []string{"", apiPrefix} {
+		mux.HandleFunc("GET "+prefix+"/register", registerHandler)
+		mux.HandleFunc("POST "+prefix+"/register", registerHandler)
+		mux.HandleFunc("GET "+prefix+"/account/password", passwordHandler)
+		mux.HandleFunc("POST "+prefix+"/account/password", passwordHandler)
+	}
+
+	mux.HandleFunc("POST /api/flags/verify", flagVerifyHandler)
+	mux.HandleFunc("GET /metrics", metricsHandler)
+	mux.HandleFunc("GET /admin", adminHandler)
+	mux.HandleFunc("POST /admin/instances/reset", adminResetHandler)
+	mux.HandleFunc("POST /admin/sessions/revoke", adminRevokeHandler)
+
+	return withLanguage(withErrorPages(mux))
+}
+
+// withErrorPages serves the requests mux has no route for with the not found page,
+// or a 405 listing the allowed methods when only the method does not match,
+// instead of the plain text errors of http.ServeMux
+func withErrorPages(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if allowed := allowedMethods(mux, r); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			respondError(w, r, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		respondNotFound(w, r)
+	})
+}
+
+// allowedMethods returns the methods mux has a route for at the path of r
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allowed []string
+	for _, method := range standardMethods {
+		req := *r
+		req.Method = method
+		if _, pattern := mux.Handler(&req); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+func TestRouter(t *testing.T) {
+	t.Run("unknown paths -> not found page", func(t *testing.T) {
+		for _, path := range []string{"/nope", "/login/extra", "/recipe/", "/recipe/3/steps", "/recipe/abc"} {
+			// Input: GET a path no route serves
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, path, "kanmu", nil))
+
+			// Expected Output: The not found page instead of the login page or a plain text error
+			if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "レシピが見つかりません") {
+				t.Errorf("%s: expected the not found page, got %v %q", path, rr.Code, rr.Body.String())
+			}
+		}
+	})
+
+	t.Run("unknown API paths -> JSON not found", func(t *testing.T) {
+		// Input: GET an API path no route serves
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, apiPrefix+"/nope", "kanmu", nil))
+
+		// Expected Output: 404 as a JSON error
+		var apiErr APIError
+		decodeJSON(t, rr, &apiErr)
+		if rr.Code != http.StatusNotFound || apiErr.Error != "Not Found" {
+			t.Errorf("Expected a JSON 404, got %v %+v", rr.Code, apiErr)
+		}
+	})
+
+	t.Run("unsupported methods -> 405 with Allow", func(t *testing.T) {
+		testCases := []struct {
+			method, path string
+			allow        string
+		}{
+			{http.MethodDelete, "/login", "GET, HEAD, POST"},
+			{http.MethodPost, "/dashboard", "GET, HEAD"},
+			{http.MethodGet, "/recipes/13/delete", "POST"},
+			{http.MethodPatch, apiPrefix + "/recipes/13", "GET, HEAD, PUT, DELETE"},
+			{http.MethodPost, "/challenges/" + sqliLoginID + "/x", ""},
+		}
+		for _, tc := range testCases {
+			// Input: A method the path has no route for
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAPIRequest(t, tc.method, tc.path, "kanmu", nil))
+
+			// Expected Output: 405 listing the methods it has, or 404 when there are none
+			if tc.allow == "" {
+				if rr.Code != http.StatusNotFound {
+					t.Errorf("%s %s: expected status %v, got %v", tc.method, tc.path, http.StatusNotFound, rr.Code)
+				}
+				continue
+			}
+			if rr.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: expected status %v, got %v", tc.method, tc.path, http.StatusMethodNotAllowed, rr.Code)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tc.allow {
+				t.Errorf("%s %s: expected Allow %q, got %q", tc.method, tc.path, tc.allow, allow)
+			}
+		}
+	})
+
+	t.Run("HEAD is served by GET routes", func(t *testing.T) {
+		// Input: HEAD requests through a server, which discards the bodies
+		server := httptest.NewServer(router)
+		defer server.Close()
+
+		for _, path := range []string{"/", "/recipe/3", "/download/flag.zip"} {
+			req := newAPIRequest(t, http.MethodHead, server.URL+path, "kanmu", nil)
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			// Expected Output: The status and headers of GET
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("HEAD %s: expected status %v, got %v", path, http.StatusOK, resp.StatusCode)
+			}
+			if resp.Header.Get("Content-Type") == "" {
+				t.Errorf("HEAD %s: expected a Content-Type", path)
+			}
+		}
+	})
+
+	t.Run("disabled challenges keep the site but hide their flags", func(t *testing.T) {
+		c, _ := registry.Get(sqliLoginID)
+		prev := enabledChallenges
+		enabledChallenges = []challenge.Challenge{c}
+		t.Cleanup(func() { enabledChallenges = prev })
+		handler := newRouter(enabledChallenges)
+
+		// Input: GET a recipe page, the flag recipe and flag.zip with the recipe challenges disabled
+		page := httptest.NewRecorder()
+		handler.ServeHTTP(page, newAPIRequest(t, http.MethodGet, "/recipe/3", "kanmu", nil))
+		var hidden []*httptest.ResponseRecorder
+		for _, path := range []string{"/recipe/13", apiPrefix + "/recipe/13", apiPrefix + "/recipes/13", "/download/" + flagFilename} {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, path, "kanmu", nil))
+			hidden = append(hidden, rr)
+		}
+
+		// Expected Output: The recipe page is served, the flags are not
+		if page.Code != http.StatusOK {
+			t.Errorf("Expected status %v, got %v", http.StatusOK, page.Code)
+		}
+		for _, rr := range hidden {
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("Expected status %v, got %v", http.StatusNotFound, rr.Code)
+			}
+		}
+	})
+}
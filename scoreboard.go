@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+// embeddedFlagDigest is the SHA-256 digest of the answer hidden in the embedded flag.zip.
+// Only the digest is compiled into the binary, so the answer cannot be read from the source.
+const embeddedFlagDigest = "0b213ba94bd8416ee9332bebccab5c43ff8e707815362821f3bf05ddfb06c930"
+
+// flagDigest is the SHA-256 digest of the final flag: the answer of the embedded flag.zip unless
+// FLAG_SHA256 or the generated flag.zip replaces it, and empty when every team has its own flag
+var flagDigest = embeddedFlagDigest
+
+type ScoreboardEntry struct {
+	Rank      int
+	Player    string
+	Score     int
+	Solved    int
+	LastSolve string
+}
+
+type ChallengeSummary struct {
+	Name       string
+	Difficulty string
+	Points     int
+	Solved     bool
+}
+
+type ScoreboardData struct {
+	Player     string
+	Message    string
+	Error      string
+	Challenges []ChallengeSummary
+	Entries    []ScoreboardEntry
+}
+
+type solve struct {
+	at     time.Time
+	points int
+}
+
+// scoreboard records the first correct submission of each player per challenge.
+// Players are recorded by the key of playerIdentity and shown by the name of their latest solve.
+type scoreboard struct {
+	mu     sync.Mutex
+	solves map[string]map[string]solve
+	names  map[string]string
+}
+
+func newScoreboard() *scoreboard {
+	return &scoreboard{solves: make(map[string]map[string]solve), names: make(map[string]string)}
+}
+
+var board = newScoreboard()
+
+// record stores the solve of the player shown as name and reports whether the player solved the challenge for the first time
+func (s *scoreboard) record(player, name string, c challenge.Challenge, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.names[player] = name
+	if _, ok := s.solves[player][c.ID()]; ok {
+		return false
+	}
+	if s.solves[player] == nil {
+		s.solves[player] = make(map[string]solve)
+	}
+	s.solves[player][c.ID()] = solve{at: at, points: c.Difficulty().Points()}
+	return true
+}
+
+// solved reports whether the player has solved the challenge
+func (s *scoreboard) solved(player, challengeID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.solves[player][challengeID]
+	return ok
+}
+
+// score returns the points the player earned by solving challenges
+func (s *scoreboard) score(player string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, sv := range s.solves[player] {
+		total += sv.points
+	}
+	return total
+}
+
+// name returns the name the player is shown as. s.mu must be held.
+func (s *scoreboard) name(player string) string {
+	if name, ok := s.names[player]; ok {
+		return name
+	}
+	return player
+}
+
+// solvers returns the names of the players who solved the challenge, first solver first
+func (s *scoreboard) solvers(challengeID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var players []string
+	for player, solves := range s.solves {
+		if _, ok := solves[challengeID]; ok {
+			players = append(players, player)
+		}
+	}
+	sort.Slice(players, func(i, j int) bool {
+		a, b := s.solves[players[i]][challengeID].at, s.solves[players[j]][challengeID].at
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return players[i] < players[j]
+	})
+	for i, player := range players {
+		players[i] = s.name(player)
+	}
+	return players
+}
+
+// ranking returns players ordered by score, less the points spent on hints, then by the time of their last solve
+func (s *scoreboard) ranking() []ScoreboardEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type standing struct {
+		player string
+		score  int
+		solved int
+		last   time.Time
+	}
+	standings := make([]standing, 0, len(s.solves))
+	for player, solves := range s.solves {
+		st := standing{player: player, solved: len(solves), score: -hintUnlocks.spent(player)}
+		for _, sv := range solves {
+			st.score += sv.points
+			if sv.at.After(st.last) {
+				st.last = sv.at
+			}
+		}
+		standings = append(standings, st)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		a, b := standings[i], standings[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if !a.last.Equal(b.last) {
+			return a.last.Before(b.last)
+		}
+		return a.player < b.player
+	})
+
+	entries := make([]ScoreboardEntry, 0, len(standings))
+	for i, st := range standings {
+		entries = append(entries, ScoreboardEntry{
+			Rank:      i + 1,
+			Player:    s.name(st.player),
+			Score:     st.score,
+			Solved:    st.solved,
+			LastSolve: st.last.Format("2006-01-02 15:04:05"),
+		})
+	}
+	return entries
+}
+
+func flagSHA256(flag string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(flag)))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasFlag reports whether a flag can be submitted for the challenge
+func hasFlag(c challenge.Challenge) bool {
+	if c.FlagDigest() != "" {
+		return true
+	}
+	return instances.randomFlags && (c.ID() == sqliLoginID || c.ID() == ingredientsID)
+}
+
+// playerIdentity returns the key the scoreboard and the hints record the player making the request under,
+// and the name the player is shown as. In hardened mode a player is an account. In vulnerable mode everyone
+// logs in as the same users, so players are told apart by their instance and shown with the start of its key.
+// It reports false when the player has no instance, which logging in creates.
+func playerIdentity(r *http.Request, user string) (key, name string, ok bool) {
+	if mode.hardened() {
+		return user, user, true
+	}
+	inst, ok := playerInstance(r)
+	if !ok {
+		return "", "", false
+	}
+	return inst.key, user + "#" + inst.key[:min(len(inst.key), 6)], true
+}
+
+// getScoreboardData builds the scoreboard page in lang for the player recorded as key and shown as name
+func getScoreboardData(lang, key, name string) ScoreboardData {
+	var challenges []ChallengeSummary
+	for _, c := range enabledChallenges {
+		if !hasFlag(c) {
+			continue
+		}
+		challenges = append(challenges, ChallengeSummary{
+			Name:       challengeName(lang, c),
+			Difficulty: c.Difficulty().String(),
+			Points:     c.Difficulty().Points(),
+			Solved:     board.solved(key, c.ID()),
+		})
+	}
+
+	return ScoreboardData{
+		Player:     name,
+		Challenges: challenges,
+		Entries:    board.ranking(),
+	}
+}
+
+func submitHandler(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return
+	}
+
+	player, name, ok := playerIdentity(r, user)
+	if !ok {
+		respondUnauthorized(w, r)
+		return
+	}
+
+	inst, _ := playerInstance(r)
+	c, err := matchFlag(name, r.FormValue("flag"), inst)
+	firstSolve := err == nil && board.record(player, name, c, time.Now())
+
+	lang := requestLanguage(r)
+	data := getScoreboardData(lang, player, name)
+	switch {
+	case errors.Is(err, errSharedFlag):
+		data.Error = translate(lang, "scoreboard.shared_flag")
+	case err != nil:
+		data.Error = translate(lang, "scoreboard.wrong_flag")
+	case firstSolve:
+		data.Message = translate(lang, "scoreboard.solved", challengeName(lang, c))
+	default:
+		data.Message = translate(lang, "scoreboard.already_solved")
+	}
+
+	if err := renderTemplate(w, r, http.StatusOK, "scoreboard", data); err != nil {
+		http.Error(w, "Template Error", http.StatusInternalServerError)
+	}
+}
+
+func scoreboardHandler(w http.ResponseWriter, r *http.Request) {
+	user, authenticated := requireAuth(w, r)
+	if !authenticated {
+		return
+	}
+
+	player, name, _ := playerIdentity(r, user)
+	if err := renderTemplate(w, r, http.StatusOK, "scoreboard", getScoreboardData(requestLanguage(r), player, name)); err != nil {
+		http.Error(w, "Template Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kanmu/gocon2025-ctf/challenge"
+)
+
+func newSubmitRequest(t *testing.T, user, flag string) *http.Request {
+	t.Helper()
+
+	form := url.Values{}
+	form.Add("flag", flag)
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/submit", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(&http.Cookie{Name: "user", Value: user})
+	return req
+}
+
+// addPlayer gives req the player cookie of a live instance for key
+func addPlayer(t *testing.T, req *http.Request, key string) {
+	t.Helper()
+
+	inst, err := instances.get(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inst.release()
+	req.AddCookie(playerCookie(key))
+}
+
+// testFlag is the final flag accepted while useFlag is in effect
+const testFlag = "gocon2025{test}"
+
+// useFlag makes testFlag the final flag
+func useFlag(t *testing.T) {
+	t.Helper()
+
+	prev := flagDigest
+	flagDigest = flagSHA256(testFlag)
+	t.Cleanup(func() { flagDigest = prev })
+}
+
+func TestSubmitHandler(t *testing.T) {
+	t.Run("without authentication -> redirect to login", func(t *testing.T) {
+		// Input: POST /submit without cookies
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/submit", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(submitHandler)
+		handler.ServeHTTP(rr, req)
+
+		// Expected Output: Redirect to login
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+	})
+
+	t.Run("GET /submit -> method not allowed", func(t *testing.T) {
+		// Input: GET /submit with kanmu cookie
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/submit", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		// Expected Output: 405 with Allow header
+		if status := rr.Code; status != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %v, got %v", http.StatusMethodNotAllowed, status)
+		}
+		if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+			t.Errorf("Expected Allow POST, got %v", allow)
+		}
+	})
+
+	t.Run("wrong flag -> error message and no solve", func(t *testing.T) {
+		board = newScoreboard()
+
+		// Input: POST /submit with a wrong flag
+		req := newSubmitRequest(t, "kanmu", "wrong")
+		addPlayer(t, req, "team-a")
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(submitHandler)
+		handler.ServeHTTP(rr, req)
+
+		// Expected Output: Error message, empty ranking
+		body := rr.Body.String()
+		if !strings.Contains(body, "フラグが間違っています") {
+			t.Errorf("Expected wrong flag message, but not found")
+		}
+		if len(board.ranking()) != 0 {
+			t.Errorf("Expected no solves, got %v", board.ranking())
+		}
+	})
+
+	t.Run("correct flag -> solve recorded once", func(t *testing.T) {
+		useFlag(t)
+		board = newScoreboard()
+
+		// Input: POST /submit with the correct flag twice
+		handler := http.HandlerFunc(submitHandler)
+		first := httptest.NewRecorder()
+		firstReq := newSubmitRequest(t, "kanmu", " "+testFlag+" ")
+		addPlayer(t, firstReq, "team-a")
+		handler.ServeHTTP(first, firstReq)
+		second := httptest.NewRecorder()
+		secondReq := newSubmitRequest(t, "kanmu", testFlag)
+		addPlayer(t, secondReq, "team-a")
+		handler.ServeHTTP(second, secondReq)
+
+		// Expected Output: First submission is recorded, second is reported as already solved
+		if !strings.Contains(first.Body.String(), "正解です") {
+			t.Errorf("Expected correct flag message, but not found")
+		}
+		if !strings.Contains(second.Body.String(), "既に正解済みです") {
+			t.Errorf("Expected already solved message, but not found")
+		}
+		if entries := board.ranking(); len(entries) != 1 || entries[0].Player != "kanmu#team-a" || entries[0].Score != challenge.Hard.Points() {
+			t.Errorf("Expected single solve by kanmu of team-a, got %v", entries)
+		}
+	})
+
+	t.Run("players logged in as the same user -> separate solves", func(t *testing.T) {
+		useFlag(t)
+		board = newScoreboard()
+
+		// Input: Two players logged in as kanmu, only the first submits the flag
+		solved := newSubmitRequest(t, "kanmu", testFlag)
+		addPlayer(t, solved, "team-a")
+		http.HandlerFunc(submitHandler).ServeHTTP(httptest.NewRecorder(), solved)
+
+		// Expected Output: Only the first player's instance solved the challenge
+		if !board.solved("team-a", ingredientsID) || board.solved("team-b", ingredientsID) {
+			t.Errorf("Expected only team-a to have solved, got %v", board.ranking())
+		}
+		page, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/scoreboard", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
+		addPlayer(t, page, "team-b")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(scoreboardHandler).ServeHTTP(rr, page)
+		if body := rr.Body.String(); !strings.Contains(body, "kanmu#team-a") || strings.Contains(body, `class="me"`) {
+			t.Errorf("Expected team-a listed without highlighting team-b's row")
+		}
+	})
+
+	t.Run("no instance -> redirect to login", func(t *testing.T) {
+		useFlag(t)
+		board = newScoreboard()
+
+		// Input: POST /submit with a user cookie but no player cookie
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(submitHandler).ServeHTTP(rr, newSubmitRequest(t, "kanmu", testFlag))
+
+		// Expected Output: Back to the login page, nothing recorded
+		if rr.Code != http.StatusFound || len(board.ranking()) != 0 {
+			t.Errorf("Expected a redirect without a solve, got %v %v", rr.Code, board.ranking())
+		}
+	})
+}
+
+func TestScoreboardRanking(t *testing.T) {
+	t.Run("players ordered by score and solve time", func(t *testing.T) {
+		// Input: Solves recorded out of order, vandle solved two challenges
+		login, _ := registry.Get(sqliLoginID)
+		zip, _ := registry.Get(ingredientsID)
+		s := newScoreboard()
+		base := time.Date(2025, 9, 27, 12, 0, 0, 0, time.UTC)
+		s.record("gocon", "gocon", zip, base.Add(2*time.Minute))
+		s.record("admin", "admin", zip, base)
+		s.record("kanmu", "kanmu", zip, base.Add(time.Minute))
+		s.record("vandle", "vandle", login, base.Add(time.Hour))
+		s.record("vandle", "vandle", zip, base.Add(2*time.Hour))
+
+		// Expected Output: Highest score first, then earliest last solve
+		entries := s.ranking()
+		expected := []string{"vandle", "admin", "kanmu", "gocon"}
+		if len(entries) != len(expected) {
+			t.Fatalf("Expected %d entries, got %d", len(expected), len(entries))
+		}
+		for i, player := range expected {
+			if entries[i].Player != player || entries[i].Rank != i+1 {
+				t.Errorf("Expected rank %d to be %s, got %+v", i+1, player, entries[i])
+			}
+		}
+	})
+
+	t.Run("scoreboard page lists solvers", func(t *testing.T) {
+		useFlag(t)
+		zip, _ := registry.Get(ingredientsID)
+		board = newScoreboard()
+		board.record("admin", "admin", zip, time.Now())
+
+		// Input: GET /scoreboard with kanmu cookie
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/scoreboard", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: "user", Value: "kanmu"})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(scoreboardHandler)
+		handler.ServeHTTP(rr, req)
+
+		// Expected Output: Scoreboard with admin listed
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("Expected status %v, got %v", http.StatusOK, status)
+		}
+		body := rr.Body.String()
+		for _, expected := range []string{"スコアボード", "admin", "食材リストを開封せよ", `action="/submit"`} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected '%s' in scoreboard, but not found", expected)
+			}
+		}
+	})
+}
+
+func TestEmbeddedFlagDigest(t *testing.T) {
+	t.Run("no configuration -> the final stage takes the embedded answer", func(t *testing.T) {
+		zip, _ := registry.Get(ingredientsID)
+
+		// Input: The ingredients stage without FLAG_SHA256 or generated flags
+		// Expected Output: The digest of the embedded flag.zip's answer is checked
+		if flagDigest != embeddedFlagDigest || zip.FlagDigest() != embeddedFlagDigest || !hasFlag(zip) {
+			t.Errorf("Expected the embedded flag digest, got %q", zip.FlagDigest())
+		}
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serverConfig holds the listen address and limits of the HTTP server
+type serverConfig struct {
+	addr              string
+	readTimeout       time.Duration
+	readHeaderTimeout time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	shutdownTimeout   time.Duration
+}
+
+// registerServerFlags defines the server flags on fs. Their defaults come from the environment, so every
+// setting can be given either way; a flag overrides its variable.
+func registerServerFlags(fs *flag.FlagSet, getenv func(string) string) (*serverConfig, error) {
+	addr := getenv("CTF_ADDR")
+	if addr == "" {
+		port := getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		addr = ":" + port
+	}
+
+	cfg := &serverConfig{}
+	fs.StringVar(&cfg.addr, "addr", addr, "listen address (CTF_ADDR, or :PORT)")
+
+	durations := []struct {
+		p     *time.Duration
+		name  string
+		env   string
+		value time.Duration
+		usage string
+	}{
+		{&cfg.readTimeout, "read-timeout", "CTF_READ_TIMEOUT", 15 * time.Second, "maximum duration for reading a request including its body"},
+		{&cfg.readHeaderTimeout, "read-header-timeout", "CTF_READ_HEADER_TIMEOUT", 5 * time.Second, "maximum duration for reading request headers"},
+		{&cfg.writeTimeout, "write-timeout", "CTF_WRITE_TIMEOUT", 30 * time.Second, "maximum duration for writing a response"},
+		{&cfg.idleTimeout, "idle-timeout", "CTF_IDLE_TIMEOUT", 2 * time.Minute, "how long keep-alive connections wait for the next request"},
+		{&cfg.shutdownTimeout, "shutdown-timeout", "CTF_SHUTDOWN_TIMEOUT", 15 * time.Second, "how long to wait for in-flight requests on shutdown"},
+	}
+	for _, d := range durations {
+		value := d.value
+		if s := getenv(d.env); s != "" {
+			parsed, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", d.env, err)
+			}
+			value = parsed
+		}
+		fs.DurationVar(d.p, d.name, value, d.usage+" ("+d.env+")")
+	}
+
+	maxHeaderBytes := http.DefaultMaxHeaderBytes
+	if s := getenv("CTF_MAX_HEADER_BYTES"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid CTF_MAX_HEADER_BYTES: %q", s)
+		}
+		maxHeaderBytes = n
+	}
+	fs.IntVar(&cfg.maxHeaderBytes, "max-header-bytes", maxHeaderBytes, "maximum size of request headers (CTF_MAX_HEADER_BYTES)")
+	return cfg, nil
+}
+
+// newServer returns a server for handler with the configured timeouts
+func (c *serverConfig) newServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.addr,
+		Handler:           handler,
+		ReadTimeout:       c.readTimeout,
+		ReadHeaderTimeout: c.readHeaderTimeout,
+		WriteTimeout:      c.writeTimeout,
+		IdleTimeout:       c.idleTimeout,
+		MaxHeaderBytes:    c.maxHeaderBytes,
+	}
+}
+
+// serve serves on ln until ctx is done, then stops accepting connections and waits up to
+// shutdownTimeout for the requests in flight
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, shutdownTimeout time.Duration) error {
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
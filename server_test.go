@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRegisterServerFlags(t *testing.T) {
+	testCases := []struct {
+		name     string
+		env      map[string]string
+		args     []string
+		expected serverConfig
+		wantErr  bool
+	}{
+		{
+			name: "defaults",
+			expected: serverConfig{
+				addr: ":8080", readTimeout: 15 * time.Second, readHeaderTimeout: 5 * time.Second, writeTimeout: 30 * time.Second,
+				idleTimeout: 2 * time.Minute, maxHeaderBytes: http.DefaultMaxHeaderBytes, shutdownTimeout: 15 * time.Second,
+			},
+		},
+		{
+			name: "environment",
+			env: map[string]string{
+				"PORT": "9000", "CTF_READ_TIMEOUT": "1s", "CTF_READ_HEADER_TIMEOUT": "2s", "CTF_WRITE_TIMEOUT": "3s",
+				"CTF_IDLE_TIMEOUT": "4s", "CTF_MAX_HEADER_BYTES": "4096", "CTF_SHUTDOWN_TIMEOUT": "5s",
+			},
+			expected: serverConfig{
+				addr: ":9000", readTimeout: time.Second, readHeaderTimeout: 2 * time.Second, writeTimeout: 3 * time.Second,
+				idleTimeout: 4 * time.Second, maxHeaderBytes: 4096, shutdownTimeout: 5 * time.Second,
+			},
+		},
+		{
+			name: "flags override the environment",
+			env:  map[string]string{"CTF_ADDR": "127.0.0.1:9000", "PORT": "9001", "CTF_WRITE_TIMEOUT": "3s"},
+			args: []string{"-addr", ":9002", "-write-timeout", "1m", "-max-header-bytes", "8192"},
+			expected: serverConfig{
+				addr: ":9002", readTimeout: 15 * time.Second, readHeaderTimeout: 5 * time.Second, writeTimeout: time.Minute,
+				idleTimeout: 2 * time.Minute, maxHeaderBytes: 8192, shutdownTimeout: 15 * time.Second,
+			},
+		},
+		{name: "invalid duration", env: map[string]string{"CTF_IDLE_TIMEOUT": "forever"}, wantErr: true},
+		{name: "invalid header size", env: map[string]string{"CTF_MAX_HEADER_BYTES": "-1"}, wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: Environment and command line
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			cfg, err := registerServerFlags(fs, func(name string) string { return tc.env[name] })
+			if err == nil {
+				err = fs.Parse(tc.args)
+			}
+
+			// Expected Output: The server configuration or an error
+			if tc.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *cfg != tc.expected {
+				t.Errorf("Expected %+v, got %+v", tc.expected, *cfg)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	t.Run("shutdown waits for requests in flight", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			_, _ = io.WriteString(w, "done")
+		})
+		ln, err := new(net.ListenConfig).Listen(context.Background(), "tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := serverConfig{readHeaderTimeout: time.Second, writeTimeout: 5 * time.Second, maxHeaderBytes: 1 << 20}
+		ctx, cancel := context.WithCancel(context.Background())
+		served := make(chan error, 1)
+		go func() { served <- serve(ctx, cfg.newServer(handler), ln, 5*time.Second) }()
+
+		type result struct {
+			body string
+			err  error
+		}
+		responses := make(chan result, 1)
+		go func() {
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "http://"+ln.Addr().String(), nil)
+			if err != nil {
+				responses <- result{err: err}
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				responses <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			responses <- result{string(body), err}
+		}()
+
+		// Input: A signal while a request is being served
+		<-started
+		cancel()
+
+		// Expected Output: The server keeps running until the request is answered, then stops cleanly
+		select {
+		case err := <-served:
+			t.Fatalf("Expected serve to wait for the request, returned %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		close(release)
+		if r := <-responses; r.err != nil || r.body != "done" {
+			t.Errorf("Expected the request to complete, got %q %v", r.body, r.err)
+		}
+		if err := <-served; err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+	})
+
+	t.Run("new connections are refused after shutdown", func(t *testing.T) {
+		ln, err := new(net.ListenConfig).Listen(context.Background(), "tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := serverConfig{readHeaderTimeout: time.Second}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		// Input: Shut down an idle server
+		cancel()
+		err = serve(ctx, cfg.newServer(http.NotFoundHandler()), ln, time.Second)
+
+		// Expected Output: No error, and the listener is closed
+		if err != nil {
+			t.Errorf("Expected a clean shutdown, got %v", err)
+		}
+		if conn, err := new(net.Dialer).DialContext(context.Background(), "tcp", ln.Addr().String()); err == nil {
+			conn.Close()
+			t.Error("Expected the listener to be closed")
+		}
+	})
+}
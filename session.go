@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sessionCookieName = "session"
+
+// sessionSecret is the HMAC key for signed cookies. It is regenerated on every start unless SESSION_SECRET is set.
+var sessionSecret = newSecret()
+
+// sessionTTL is how long a session stays valid after login
+var sessionTTL = 12 * time.Hour
+
+// secureCookies forces the Secure attribute, for deployments behind a TLS terminating proxy
+var secureCookies bool
+
+var sessions SessionStore = newMemorySessionStore()
+
+func newSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// Purposes of the values signed with sessionSecret. The purpose is part of the signed input,
+// so a value signed for one purpose, such as a player cookie, is rejected for another.
+const (
+	sessionPurpose    = "session"
+	playerPurpose     = "player"
+	adminCSRFPurpose  = "admin-csrf"
+	logoutCSRFPurpose = "logout-csrf"
+	recipeCSRFPurpose = "recipe-csrf"
+)
+
+func sign(purpose, payload string) string {
+	mac := hmac.New(sha256.New, sessionSecret)
+	mac.Write([]byte(purpose + ":" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signValue returns value encoded with its HMAC signature for purpose
+func signValue(purpose, value string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value))
+	return payload + "." + sign(purpose, payload)
+}
+
+// verifySignedValue returns the value of a signed string if the signature is valid for purpose
+func verifySignedValue(purpose, signed string) (string, bool) {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(purpose, payload))) {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Session) expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+// SessionStore keeps the server side state of sessions so they can be revoked
+type SessionStore interface {
+	Save(s *Session) error
+	Get(id string) (*Session, bool)
+	Delete(id string) error
+	// List returns the live sessions, oldest first
+	List() ([]*Session, error)
+}
+
+// memorySessionStore keeps sessions in memory; they are lost on restart
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{sessions: make(map[string]*Session)}
+}
+
+func (m *memorySessionStore) Save(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = s
+	return nil
+}
+
+func (m *memorySessionStore) Get(id string) (*Session, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	if s.expired(time.Now()) {
+		delete(m.sessions, id)
+		return nil, false
+	}
+	return s, true
+}
+
+func (m *memorySessionStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *memorySessionStore) List() ([]*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	list := make([]*Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		if !s.expired(now) {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// fileSessionStore is a memorySessionStore that writes every change to a JSON file
+type fileSessionStore struct {
+	*memorySessionStore
+	path string
+	// writeMu serializes flushes, so the file always ends up with the latest sessions
+	writeMu sync.Mutex
+}
+
+// openFileSessionStore loads the sessions stored at path, creating the file on first save
+func openFileSessionStore(path string) (*fileSessionStore, error) {
+	store := &fileSessionStore{memorySessionStore: newMemorySessionStore(), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var saved []*Session
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("session store %s: %w", path, err)
+	}
+	now := time.Now()
+	for _, s := range saved {
+		if !s.expired(now) {
+			store.sessions[s.ID] = s
+		}
+	}
+	return store, nil
+}
+
+func (f *fileSessionStore) Save(s *Session) error {
+	if err := f.memorySessionStore.Save(s); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+func (f *fileSessionStore) Delete(id string) error {
+	if err := f.memorySessionStore.Delete(id); err != nil {
+		return err
+	}
+	return f.flush()
+}
+
+// flush writes the live sessions to the file.
+// The snapshot, the write of the temporary file and the rename happen under writeMu,
+// so concurrent flushes neither share a half-written temporary file nor rename an older snapshot over a newer one.
+func (f *fileSessionStore) flush() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	f.mu.Lock()
+	now := time.Now()
+	live := make([]*Session, 0, len(f.sessions))
+	for id, s := range f.sessions {
+		if s.expired(now) {
+			delete(f.sessions, id)
+			continue
+		}
+		live = append(live, s)
+	}
+	f.mu.Unlock()
+
+	data, err := json.Marshal(live)
+	if err != nil {
+		return err
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, f.path)
+}
+
+// createSession starts a session for the user and returns it with its signed token
+func createSession(user string) (*Session, string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	s := &Session{
+		ID:        hex.EncodeToString(id),
+		User:      user,
+		CreatedAt: now,
+		ExpiresAt: now.Add(sessionTTL),
+	}
+	if err := sessions.Save(s); err != nil {
+		return nil, "", err
+	}
+	return s, signValue(sessionPurpose, s.ID+":"+strconv.FormatInt(s.ExpiresAt.Unix(), 10)), nil
+}
+
+// lookupSession returns the session of a signed token if it is valid, unexpired and not revoked
+func lookupSession(token string) (*Session, bool) {
+	value, ok := verifySignedValue(sessionPurpose, token)
+	if !ok {
+		return nil, false
+	}
+	id, expiresAt, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, false
+	}
+	unix, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || !time.Now().Before(time.Unix(unix, 0)) {
+		return nil, false
+	}
+	return sessions.Get(id)
+}
+
+// currentSessionID returns the ID of the session of the request, or "" without a valid session
+func currentSessionID(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	if s, ok := lookupSession(cookie.Value); ok {
+		return s.ID
+	}
+	return ""
+}
+
+// revokeOtherSessions deletes the sessions of user but the one with the ID keep
+func revokeOtherSessions(user, keep string) error {
+	list, err := sessions.List()
+	if err != nil {
+		return err
+	}
+	for _, s := range list {
+		if s.User == user && s.ID != keep {
+			if err := sessions.Delete(s.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newSessionCookie returns the session cookie for the token. An empty token clears the cookie.
+func newSessionCookie(r *http.Request, token string, expires time.Time) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secureCookies || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// loginCSRFToken signs the login cookie of the request for the form of purpose, or returns "" when not logged in
+func loginCSRFToken(r *http.Request, purpose string) string {
+	for _, name := range []string{sessionCookieName, "user"} {
+		if cookie, err := r.Cookie(name); err == nil {
+			return sign(purpose, cookie.Value)
+		}
+	}
+	return ""
+}
+
+// logoutCSRFToken is sent with the logout form. It is bound to the login cookie of the request,
+// so other sites cannot log users out.
+func logoutCSRFToken(r *http.Request) string {
+	return loginCSRFToken(r, logoutCSRFPurpose)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if !hmac.Equal([]byte(r.FormValue("csrf_token")), []byte(logoutCSRFToken(r))) {
+		respondError(w, r, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		if s, ok := lookupSession(cookie.Value); ok {
+			if err := sessions.Delete(s.ID); err != nil {
+				http.Error(w, "Session Error", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.SetCookie(w, newSessionCookie(r, "", time.Time{}))
+	}
+	if _, err := r.Cookie("user"); err == nil {
+		http.SetCookie(w, &http.Cookie{Name: "user", Path: "/", MaxAge: -1})
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignedValue(t *testing.T) {
+	t.Run("round trip and tampering", func(t *testing.T) {
+		// Input: Signed value, and the same value with a modified payload
+		signed := signValue(sessionPurpose, "kanmu")
+		forged := signValue(sessionPurpose, "admin")
+		forged = signed[:len(signed)-64] + forged[len(forged)-64:]
+
+		// Expected Output: Original verifies, forged does not
+		if value, ok := verifySignedValue(sessionPurpose, signed); !ok || value != "kanmu" {
+			t.Errorf("Expected kanmu, got %q (ok=%v)", value, ok)
+		}
+		if _, ok := verifySignedValue(sessionPurpose, forged); ok {
+			t.Errorf("Expected forged value to be rejected")
+		}
+	})
+
+	t.Run("value signed for another purpose -> rejected", func(t *testing.T) {
+		// Input: Player cookie value presented as a session token
+		signed := signValue(playerPurpose, "id:9999999999")
+
+		// Expected Output: Rejected as a session token, accepted as a player cookie
+		if _, ok := verifySignedValue(sessionPurpose, signed); ok {
+			t.Errorf("Expected player value to be rejected as a session token")
+		}
+		if _, ok := verifySignedValue(playerPurpose, signed); !ok {
+			t.Errorf("Expected player value to verify as a player cookie")
+		}
+	})
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	t.Run("expired token -> rejected", func(t *testing.T) {
+		// Input: Token whose signed expiry is in the past
+		s, _, err := createSession("kanmu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := signValue(sessionPurpose, s.ID+":"+strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+
+		// Expected Output: Session not found
+		if _, ok := lookupSession(token); ok {
+			t.Errorf("Expected expired token to be rejected")
+		}
+	})
+
+	t.Run("expired session in store -> rejected", func(t *testing.T) {
+		// Input: Session that expired in the store
+		store := newMemorySessionStore()
+		if err := store.Save(&Session{ID: "old", User: "kanmu", ExpiresAt: time.Now().Add(-time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Get reports missing
+		if _, ok := store.Get("old"); ok {
+			t.Errorf("Expected expired session to be missing")
+		}
+	})
+
+	t.Run("revoked session -> rejected", func(t *testing.T) {
+		// Input: Valid token whose session was deleted
+		s, token, err := createSession("kanmu")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := lookupSession(token); !ok {
+			t.Fatal("Expected fresh session to be valid")
+		}
+		if err := sessions.Delete(s.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Session not found
+		if _, ok := lookupSession(token); ok {
+			t.Errorf("Expected revoked session to be rejected")
+		}
+	})
+
+	t.Run("file store persists sessions", func(t *testing.T) {
+		// Input: Sessions saved to a file store, one deleted, store reopened
+		path := filepath.Join(t.TempDir(), "sessions.json")
+		store, err := openFileSessionStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expires := time.Now().Add(time.Hour)
+		for _, id := range []string{"a", "b"} {
+			if err := store.Save(&Session{ID: id, User: "kanmu", ExpiresAt: expires}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := store.Delete("b"); err != nil {
+			t.Fatal(err)
+		}
+
+		reopened, err := openFileSessionStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: Only session a survives
+		if s, ok := reopened.Get("a"); !ok || s.User != "kanmu" {
+			t.Errorf("Expected session a to be persisted")
+		}
+		if _, ok := reopened.Get("b"); ok {
+			t.Errorf("Expected session b to stay deleted")
+		}
+	})
+
+	t.Run("concurrent saves -> every session persisted", func(t *testing.T) {
+		// Input: Sessions saved to a file store from many goroutines at once
+		path := filepath.Join(t.TempDir(), "sessions.json")
+		store, err := openFileSessionStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expires := time.Now().Add(time.Hour)
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- store.Save(&Session{ID: strconv.Itoa(i), User: "kanmu", ExpiresAt: expires})
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Expected Output: The file holds all of them
+		reopened, err := openFileSessionStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if list, _ := reopened.List(); len(list) != 20 {
+			t.Errorf("Expected 20 sessions, got %d", len(list))
+		}
+	})
+}
+
+func TestLogoutHandler(t *testing.T) {
+	t.Run("hardened logout revokes session and clears cookie", func(t *testing.T) {
+		setMode(t, modeHardened)
+		token := newSessionToken(t, "kanmu")
+
+		// Input: POST /logout with session cookie and CSRF token
+		req := newLogoutRequest(t, &http.Cookie{Name: sessionCookieName, Value: token}, "")
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(logoutHandler).ServeHTTP(rr, req)
+
+		// Expected Output: Redirect to login, cleared cookie, session revoked
+		if status := rr.Code; status != http.StatusFound {
+			t.Errorf("Expected status %v, got %v", http.StatusFound, status)
+		}
+		cleared := false
+		for _, cookie := range rr.Result().Cookies() {
+			if cookie.Name == sessionCookieName && cookie.MaxAge < 0 {
+				cleared = true
+			}
+		}
+		if !cleared {
+			t.Errorf("Expected session cookie to be cleared")
+		}
+		if _, ok := lookupSession(token); ok {
+			t.Errorf("Expected session to be revoked")
+		}
+	})
+
+	t.Run("logout without CSRF token -> rejected", func(t *testing.T) {
+		setMode(t, modeHardened)
+		token := newSessionToken(t, "kanmu")
+
+		// Input: POST /logout with session cookie and a wrong CSRF token, as sent from another site
+		req := newLogoutRequest(t, &http.Cookie{Name: sessionCookieName, Value: token}, "forged")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(logoutHandler).ServeHTTP(rr, req)
+
+		// Expected Output: Forbidden, session kept
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Expected status %v, got %v", http.StatusForbidden, rr.Code)
+		}
+		if _, ok := lookupSession(token); !ok {
+			t.Errorf("Expected session to be kept")
+		}
+	})
+
+	t.Run("GET /logout -> not routed", func(t *testing.T) {
+		// Input: GET /logout, as an image or link on another site would
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAPIRequest(t, http.MethodGet, "/logout", "kanmu", nil))
+
+		// Expected Output: Method not allowed
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %v, got %v", http.StatusMethodNotAllowed, rr.Code)
+		}
+	})
+
+	t.Run("session cookie attributes", func(t *testing.T) {
+		// Input: Cookie for a TLS request
+		req := httptest.NewRequest(http.MethodGet, "https://example.com/login", nil)
+		cookie := newSessionCookie(req, "token", time.Now().Add(time.Hour))
+
+		// Expected Output: HttpOnly, Secure and SameSite=Lax
+		if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("Unexpected cookie attributes: %+v", cookie)
+		}
+	})
+}
+
+// newLogoutRequest returns a logout form post with the login cookie and csrfToken, or the token of the cookie if empty
+func newLogoutRequest(t *testing.T, cookie *http.Cookie, csrfToken string) *http.Request {
+	t.Helper()
+
+	if csrfToken == "" {
+		csrfToken = sign(logoutCSRFPurpose, cookie.Value)
+	}
+	form := url.Values{"csrf_token": {csrfToken}}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/logout", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	return req
+}
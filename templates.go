@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed assets/templates
+var templateFiles embed.FS
+
+// templateFuncs are the helper functions available to every template
+var templateFuncs = template.FuncMap{
+	"datetime":        func(t time.Time) string { return t.Format(time.DateTime) },
+	"join":            strings.Join,
+	"languageURL":     languageURL,
+	"recipeImage":     recipeImageURL,
+	"recipeThumbnail": recipeThumbnailURL,
+}
+
+// recipeImageURL returns the path of the image of a recipe
+func recipeImageURL(id int) string {
+	return "/recipe/" + strconv.Itoa(id) + "?format=image"
+}
+
+// languageFuncs are the helper functions translating the templates to lang
+func languageFuncs(lang string) template.FuncMap {
+	return template.FuncMap{
+		"t":            func(key string, args ...any) string { return translate(lang, key, args...) },
+		"lang":         func() string { return lang },
+		"languages":    func() []string { return languages },
+		"languageName": func(code string) string { return languageNames[code] },
+	}
+}
+
+// languageURL returns the link of the language switcher from a page with query to the page in lang:
+// the same query with only lang replaced
+func languageURL(query url.Values, lang string) string {
+	q := make(url.Values, len(query)+1)
+	maps.Copy(q, query)
+	q.Set("lang", lang)
+	return "?" + q.Encode()
+}
+
+// pageTemplates holds the HTML pages. The files in base/ hold the layout and partials,
+// every other file is a page executed within the layout and named after the file without ".html".
+// Every language has its own set of pages, in which the t func translates messages to the language.
+type pageTemplates struct {
+	fsys   fs.FS
+	reload bool // parse the files again for every page, to see edits without restarting
+	pages  map[string]map[string]*template.Template
+}
+
+// newPageTemplates parses the templates in fsys
+func newPageTemplates(fsys fs.FS, reload bool) (*pageTemplates, error) {
+	pages, err := parseLanguages(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &pageTemplates{fsys: fsys, reload: reload, pages: pages}, nil
+}
+
+// parseLanguages parses the pages for every language
+func parseLanguages(fsys fs.FS) (map[string]map[string]*template.Template, error) {
+	pages := make(map[string]map[string]*template.Template, len(languages))
+	for _, lang := range languages {
+		p, err := parsePages(fsys, lang)
+		if err != nil {
+			return nil, err
+		}
+		pages[lang] = p
+	}
+	return pages, nil
+}
+
+// parsePages parses every page together with its own copy of the layout and partials
+func parsePages(fsys fs.FS, lang string) (map[string]*template.Template, error) {
+	base, err := template.New("").Funcs(templateFuncs).Funcs(languageFuncs(lang)).ParseFS(fsys, "base/*.html")
+	if err != nil {
+		return nil, err
+	}
+	files, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string]*template.Template)
+	for _, file := range files {
+		page, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := page.ParseFS(fsys, file); err != nil {
+			return nil, err
+		}
+		pages[strings.TrimSuffix(path.Base(file), ".html")] = page
+	}
+	return pages, nil
+}
+
+// execute writes the page name in lang with data, for a request with query
+func (t *pageTemplates) execute(w io.Writer, lang string, query url.Values, name string, data any) error {
+	pages := t.pages
+	if t.reload {
+		var err error
+		if pages, err = parseLanguages(t.fsys); err != nil {
+			return err
+		}
+	}
+	if _, ok := pages[lang]; !ok {
+		lang = defaultLanguage
+	}
+	page, ok := pages[lang][name]
+	if !ok {
+		return fmt.Errorf("unknown template: %q", name)
+	}
+	return page.ExecuteTemplate(w, "layout", layoutData{Page: data, Query: query})
+}
+
+// layoutData is the data of the layout: the data of the page and the query of the request,
+// which the language switcher keeps
+type layoutData struct {
+	Page  any
+	Query url.Values
+}
+
+// embeddedTemplates returns the templates built into the binary
+func embeddedTemplates() *pageTemplates {
+	fsys, err := fs.Sub(templateFiles, "assets/templates")
+	if err != nil {
+		panic(err)
+	}
+	t, err := newPageTemplates(fsys, false)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// templates are the pages rendered by renderTemplate; main reloads them from CTF_TEMPLATE_DIR when it is set
+var templates = embeddedTemplates()
+
+// renderTemplate renders the page template name with data and the given status in the language of the request.
+// Nothing is written if the template fails, so the caller can still send an error.
+func renderTemplate(w http.ResponseWriter, r *http.Request, status int, name string, data any) error {
+	var buf bytes.Buffer
+	if err := templates.execute(&buf, requestLanguage(r), r.URL.Query(), name, data); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// useTemplates replaces the page templates for the duration of the test
+func useTemplates(t *testing.T, pages *pageTemplates) {
+	t.Helper()
+
+	prev := templates
+	templates = pages
+	t.Cleanup(func() { templates = prev })
+}
+
+func TestPageTemplates(t *testing.T) {
+	t.Run("every page renders within the layout", func(t *testing.T) {
+		testCases := []struct {
+			page     string
+			data     any
+			expected string
+		}{
+			{"login", LoginData{}, "<title>レシピサイト - ログイン</title>"},
+			{"not_found", nil, "<title>レシピが見つかりません</title>"},
+			{"too_many_requests", RateLimitData{RetryAfter: 30}, "30 秒後に"},
+			{"dashboard", DashboardData{Title: "T"}, "<title>T - レシピサイト</title>"},
+			{"recipe_detail", RecipeDetailData{ID: 3, Name: "いくら"}, `src="/recipe/3?format=image&amp;size=medium"`},
+			{"recipe_print", RecipeDetailData{ID: 3, Name: "いくら", Steps: []string{"茹でる"}}, "<li>茹でる</li>"},
+			{"recipe_form", RecipeFormData{Title: "新しいレシピ"}, "<title>新しいレシピ - レシピサイト</title>"},
+			{"scoreboard", ScoreboardData{Message: "ok"}, `<div class="message">ok</div>`},
+			{"account", AccountData{Title: "登録", Error: "ng"}, `<div class="error">ng</div>`},
+			{"admin", AdminData{Solves: []StageSolves{{Name: "S", Players: []string{"a", "b"}}}}, "<td>a, b</td>"},
+		}
+
+		for _, tc := range testCases {
+			// Input: Each embedded page with its data
+			var buf bytes.Buffer
+			if err := templates.execute(&buf, langJA, nil, tc.page, tc.data); err != nil {
+				t.Fatalf("%s: %v", tc.page, err)
+			}
+
+			// Expected Output: A full document from the shared layout with the page content
+			body := buf.String()
+			if !strings.HasPrefix(body, "<!DOCTYPE html>") || !strings.Contains(body, ".btn {") {
+				t.Errorf("%s: expected the layout and its styles, got %q", tc.page, body[:min(len(body), 100)])
+			}
+			if !strings.Contains(body, tc.expected) {
+				t.Errorf("%s: expected %q in the page", tc.page, tc.expected)
+			}
+		}
+	})
+
+	t.Run("helper funcs", func(t *testing.T) {
+		at := time.Date(2025, 9, 27, 10, 0, 0, 0, time.UTC)
+		pages, err := newPageTemplates(fstest.MapFS{
+			"base/layout.html": {Data: []byte(`{{define "layout"}}{{template "content" .Page}}{{end}}`)},
+			"page.html":        {Data: []byte(`{{define "content"}}{{datetime .At}}|{{join .List "/"}}|{{recipeImage .ID}}|{{recipeThumbnail .ID "thumb"}}{{end}}`)},
+		}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: Data formatted by each helper
+		var buf bytes.Buffer
+		err = pages.execute(&buf, langJA, nil, "page", map[string]any{"At": at, "List": []string{"a", "b"}, "ID": 5})
+
+		// Expected Output: Formatted values
+		if expected := "2025-09-27 10:00:00|a/b|/recipe/5?format=image|/recipe/5?format=image&amp;size=thumb"; err != nil || buf.String() != expected {
+			t.Errorf("Expected %q, got %q %v", expected, buf.String(), err)
+		}
+	})
+
+	t.Run("unknown page -> error and nothing written", func(t *testing.T) {
+		// Input: Render a page that does not exist
+		rr := httptest.NewRecorder()
+		err := renderTemplate(rr, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil), http.StatusOK, "nope", nil)
+
+		// Expected Output: The caller can still send an error
+		if err == nil || rr.Body.Len() != 0 {
+			t.Errorf("Expected an error and an empty body, got %v %q", err, rr.Body.String())
+		}
+	})
+
+	t.Run("reload -> edits on disk are served without restarting", func(t *testing.T) {
+		dir := t.TempDir()
+		write := func(name, content string) {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		write("base/layout.html", `{{define "layout"}}[{{template "content" .Page}}]{{end}}`)
+		write("not_found.html", `{{define "content"}}before{{end}}`)
+		pages, err := newPageTemplates(os.DirFS(dir), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		useTemplates(t, pages)
+
+		// Input: Edit the page after the templates were loaded
+		write("not_found.html", `{{define "content"}}after{{end}}`)
+		rr := httptest.NewRecorder()
+		showNotFound(rr, httptest.NewRequestWithContext(context.Background(), http.MethodGet, "/", nil))
+
+		// Expected Output: The edited page
+		if rr.Code != http.StatusNotFound || rr.Body.String() != "[after]" {
+			t.Errorf("Expected the edited page, got %v %q", rr.Code, rr.Body.String())
+		}
+	})
+}
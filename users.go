@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errUserNotFound    = errors.New("user not found")
+	errUserExists      = messageError("account.user_exists")
+	errInvalidUsername = messageError("account.invalid_username")
+	errWeakPassword    = messageError("account.weak_password")
+)
+
+// Account is a hardened mode user. Only the bcrypt hash of the password is stored.
+type Account struct {
+	Username     string
+	PasswordHash []byte
+	CreatedAt    time.Time
+}
+
+// UserStore stores the hardened mode users
+type UserStore interface {
+	Get(ctx context.Context, username string) (*Account, error)
+	// List returns every account ordered by username
+	List(ctx context.Context) ([]*Account, error)
+	// Create stores a new account, failing with errUserExists if the name is taken
+	Create(ctx context.Context, account *Account) error
+	Update(ctx context.Context, account *Account) error
+	Delete(ctx context.Context, username string) error
+}
+
+// accounts holds the hardened mode users. main seeds it from the users CSV while it is empty.
+var accounts UserStore = newMemoryUserStore()
+
+// bcryptCost is the bcrypt work factor for new password hashes
+var bcryptCost = bcrypt.DefaultCost
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,32}$`)
+
+func validateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return errInvalidUsername
+	}
+	return nil
+}
+
+// hashPassword checks the password policy and returns the bcrypt hash
+func hashPassword(password string) ([]byte, error) {
+	if len(password) < 8 || len(password) > 72 {
+		return nil, errWeakPassword
+	}
+	return bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+}
+
+// dummyHash is compared against when the user does not exist, so unknown names take as long as wrong passwords
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("gocon2025-dummy-password"), bcryptCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// verifyPassword returns the account if the password matches, or errUserNotFound otherwise
+func verifyPassword(ctx context.Context, username, password string) (*Account, error) {
+	account, err := accounts.Get(ctx, username)
+	if errors.Is(err, errUserNotFound) {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, errUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte(password)) != nil {
+		return nil, errUserNotFound
+	}
+	return account, nil
+}
+
+// registerUser creates an account in store after checking the username and password policy
+func registerUser(ctx context.Context, store UserStore, username, password string) (*Account, error) {
+	if err := validateUsername(username); err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	account := &Account{Username: username, PasswordHash: hash, CreatedAt: time.Now()}
+	if err := store.Create(ctx, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// setPassword replaces the password of an existing account in store
+func setPassword(ctx context.Context, store UserStore, username, password string) error {
+	account, err := store.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	account.PasswordHash = hash
+	return store.Update(ctx, account)
+}
+
+// importUsersCSV hashes the plaintext passwords of a users CSV (username and password columns with a header)
+// into store, skipping users that already exist. It returns the number of imported users.
+func importUsersCSV(ctx context.Context, store UserStore, data []byte) (int, error) {
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return 0, err
+	}
+	return importUsers(ctx, store, records)
+}
+
+// importUsers imports the rows of a users table whose first row is the header
+func importUsers(ctx context.Context, store UserStore, records [][]string) (int, error) {
+	if len(records) == 0 {
+		return 0, nil
+	}
+	username, password := slices.Index(records[0], "username"), slices.Index(records[0], "password")
+	if username < 0 || password < 0 {
+		return 0, errors.New("users table needs username and password columns")
+	}
+
+	imported := 0
+	for _, record := range records[1:] {
+		if len(record) <= max(username, password) {
+			continue
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(record[password]), bcryptCost)
+		if err != nil {
+			return imported, fmt.Errorf("user %s: %w", record[username], err)
+		}
+		err = store.Create(ctx, &Account{Username: record[username], PasswordHash: hash, CreatedAt: time.Now()})
+		if errors.Is(err, errUserExists) {
+			continue
+		}
+		if err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// seedAccounts imports the users table into store when it has no users yet
+func seedAccounts(ctx context.Context, store UserStore, records [][]string) error {
+	list, err := store.List(ctx)
+	if err != nil || len(list) > 0 {
+		return err
+	}
+	_, err = importUsers(ctx, store, records)
+	return err
+}
+
+func copyAccount(account *Account) *Account {
+	c := *account
+	c.PasswordHash = slices.Clone(account.PasswordHash)
+	return &c
+}
+
+// memoryUserStore keeps accounts in memory
+type memoryUserStore struct {
+	mu       sync.RWMutex
+	accounts map[string]*Account
+}
+
+func newMemoryUserStore() *memoryUserStore {
+	return &memoryUserStore{accounts: make(map[string]*Account)}
+}
+
+func (m *memoryUserStore) Get(_ context.Context, username string) (*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[username]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return copyAccount(account), nil
+}
+
+func (m *memoryUserStore) List(_ context.Context) ([]*Account, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := make([]*Account, 0, len(m.accounts))
+	for _, username := range slices.Sorted(maps.Keys(m.accounts)) {
+		list = append(list, copyAccount(m.accounts[username]))
+	}
+	return list, nil
+}
+
+func (m *memoryUserStore) Create(_ context.Context, account *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account.Username]; ok {
+		return errUserExists
+	}
+	m.accounts[account.Username] = copyAccount(account)
+	return nil
+}
+
+func (m *memoryUserStore) Update(_ context.Context, account *Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[account.Username]; !ok {
+		return errUserNotFound
+	}
+	m.accounts[account.Username] = copyAccount(account)
+	return nil
+}
+
+func (m *memoryUserStore) Delete(_ context.Context, username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[username]; !ok {
+		return errUserNotFound
+	}
+	delete(m.accounts, username)
+	return nil
+}
+
+// sqliteUserStore stores accounts in a SQLite database
+type sqliteUserStore struct {
+	db *sql.DB
+}
+
+const accountSchema = `CREATE TABLE IF NOT EXISTS accounts (
+	username TEXT PRIMARY KEY,
+	password_hash BLOB NOT NULL,
+	created_at INTEGER NOT NULL
+)`
+
+// openSQLiteUserStore opens the accounts database at path
+func openSQLiteUserStore(ctx context.Context, path string) (*sqliteUserStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, accountSchema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &sqliteUserStore{db: db}, nil
+}
+
+// Close closes the database
+func (s *sqliteUserStore) Close() error {
+	return s.db.Close()
+}
+
+func scanAccount(row rowScanner) (*Account, error) {
+	var account Account
+	var createdAt int64
+	if err := row.Scan(&account.Username, &account.PasswordHash, &createdAt); err != nil {
+		return nil, err
+	}
+	account.CreatedAt = time.Unix(createdAt, 0)
+	return &account, nil
+}
+
+func (s *sqliteUserStore) Get(ctx context.Context, username string) (*Account, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT username, password_hash, created_at FROM accounts WHERE username = ?", username)
+	account, err := scanAccount(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUserNotFound
+	}
+	return account, err
+}
+
+func (s *sqliteUserStore) List(ctx context.Context) ([]*Account, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT username, password_hash, created_at FROM accounts ORDER BY username")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []*Account
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, account)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqliteUserStore) Create(ctx context.Context, account *Account) error {
+	result, err := s.db.ExecContext(ctx,
+		"INSERT INTO accounts (username, password_hash, created_at) VALUES (?, ?, ?) ON CONFLICT (username) DO NOTHING",
+		account.Username, account.PasswordHash, account.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errUserExists
+	}
+	return nil
+}
+
+func (s *sqliteUserStore) Update(ctx context.Context, account *Account) error {
+	result, err := s.db.ExecContext(ctx, "UPDATE accounts SET password_hash = ? WHERE username = ?", account.PasswordHash, account.Username)
+	if err != nil {
+		return err
+	}
+	return requireAffectedAccount(result)
+}
+
+func (s *sqliteUserStore) Delete(ctx context.Context, username string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM accounts WHERE username = ?", username)
+	if err != nil {
+		return err
+	}
+	return requireAffectedAccount(result)
+}
+
+// requireAffectedAccount turns a change of zero rows into errUserNotFound
+func requireAffectedAccount(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
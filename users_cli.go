@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errUsage = errors.New("usage: gocon2025-ctf users [-db path] list | add <username> [password] | remove <username> | reset <username> [password] | import <users.csv>")
+
+// runUsersCommand manages the hardened mode accounts stored in the USERS_DB database.
+// A random password is generated and printed when add or reset is given none.
+func runUsersCommand(ctx context.Context, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("users", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	dbPath := fs.String("db", os.Getenv("USERS_DB"), "accounts database (defaults to USERS_DB)")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if *dbPath == "" {
+		return errors.New("users: set USERS_DB or -db to the accounts database")
+	}
+	args = fs.Args()
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	store, err := openSQLiteUserStore(ctx, *dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	command, args := args[0], args[1:]
+	switch {
+	case command == "list" && len(args) == 0:
+		list, err := store.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, account := range list {
+			fmt.Fprintf(stdout, "%s\t%s\n", account.Username, account.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+
+	case command == "add" && (len(args) == 1 || len(args) == 2):
+		password := passwordArg(args)
+		if _, err := registerUser(ctx, store, args[0], password); err != nil {
+			return fmt.Errorf("add %s: %w", args[0], err)
+		}
+		printPassword(stdout, args, password)
+		return nil
+
+	case command == "remove" && len(args) == 1:
+		if err := store.Delete(ctx, args[0]); err != nil {
+			return fmt.Errorf("remove %s: %w", args[0], err)
+		}
+		fmt.Fprintf(stdout, "removed %s\n", args[0])
+		return nil
+
+	case command == "reset" && (len(args) == 1 || len(args) == 2):
+		password := passwordArg(args)
+		if err := setPassword(ctx, store, args[0], password); err != nil {
+			return fmt.Errorf("reset %s: %w", args[0], err)
+		}
+		printPassword(stdout, args, password)
+		return nil
+
+	case command == "import" && len(args) == 1:
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		n, err := importUsersCSV(ctx, store, data)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "imported %d users\n", n)
+		return nil
+
+	default:
+		return errUsage
+	}
+}
+
+// passwordArg returns the password given after the username, or a new random one
+func passwordArg(args []string) string {
+	if len(args) == 2 {
+		return args[1]
+	}
+	return rand.Text()
+}
+
+func printPassword(stdout io.Writer, args []string, password string) {
+	if len(args) == 2 {
+		fmt.Fprintf(stdout, "updated %s\n", args[0])
+		return
+	}
+	fmt.Fprintf(stdout, "%s\t%s\n", args[0], password)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useAccounts replaces the account store with a fresh one seeded from the users CSV
+func useAccounts(t *testing.T) {
+	t.Helper()
+
+	prev := accounts
+	store := newMemoryUserStore()
+	if err := seedAccounts(context.Background(), store, userData[usersTableName]); err != nil {
+		t.Fatal(err)
+	}
+	accounts = store
+	t.Cleanup(func() { accounts = prev })
+}
+
+func TestUserStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) UserStore{
+		"memory": func(t *testing.T) UserStore {
+			t.Helper()
+			return newMemoryUserStore()
+		},
+		"sqlite": func(t *testing.T) UserStore {
+			t.Helper()
+			store, err := openSQLiteUserStore(context.Background(), filepath.Join(t.TempDir(), "users.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = store.Close() })
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+
+			// Input: Register an account
+			if _, err := registerUser(ctx, store, "alice", "password123"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Expected Output: The account is stored with a bcrypt hash, not the password
+			account, err := store.Get(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(account.PasswordHash) == 0 || bytes.Contains(account.PasswordHash, []byte("password123")) {
+				t.Errorf("Expected a password hash, got %q", account.PasswordHash)
+			}
+
+			// Input: Register the same name again
+			_, err = registerUser(ctx, store, "alice", "password456")
+
+			// Expected Output: errUserExists
+			if !errors.Is(err, errUserExists) {
+				t.Errorf("Expected errUserExists, got %v", err)
+			}
+
+			// Input: Change the password
+			if err := setPassword(ctx, store, "alice", "password456"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Expected Output: The hash changes
+			updated, err := store.Get(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(updated.PasswordHash, account.PasswordHash) {
+				t.Error("Expected the password hash to change")
+			}
+
+			// Input: List, then delete the account
+			list, err := store.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != 1 || list[0].Username != "alice" {
+				t.Errorf("Expected only alice, got %v", list)
+			}
+			if err := store.Delete(ctx, "alice"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Expected Output: The account is gone
+			if _, err := store.Get(ctx, "alice"); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Expected errUserNotFound, got %v", err)
+			}
+			if err := store.Delete(ctx, "alice"); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Expected errUserNotFound on second delete, got %v", err)
+			}
+			if err := setPassword(ctx, store, "alice", "password789"); !errors.Is(err, errUserNotFound) {
+				t.Errorf("Expected errUserNotFound on reset, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRegisterUserPolicy(t *testing.T) {
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		expected error
+	}{
+		{"valid", "new_user-1", "password123", nil},
+		{"short username", "ab", "password123", errInvalidUsername},
+		{"SQL in username", "admin' --", "password123", errInvalidUsername},
+		{"short password", "new_user", "short", errWeakPassword},
+		{"long password", "new_user", strings.Repeat("a", 73), errWeakPassword},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Input: Username and password
+			_, err := registerUser(context.Background(), newMemoryUserStore(), tc.username, tc.password)
+
+			// Expected Output: nil or the policy error
+			if !errors.Is(err, tc.expected) {
+				t.Errorf("Expected %v, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	useAccounts(t)
+
+	testCases := []struct {
+		username string
+		password string
+		valid    bool
+	}{
+		{"kanmu", "gocon2025", true},
+		{"admin", "Adm1n$ecur3", true},
+		{"kanmu", "wrong", false},
+		{"nobody", "gocon2025", false},
+		{"admin' OR '1'='1' --", "x", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.username+"/"+tc.password, func(t *testing.T) {
+			// Input: Credentials checked against the CSV seeded accounts
+			account, err := verifyPassword(context.Background(), tc.username, tc.password)
+
+			// Expected Output: The account, or errUserNotFound for any mismatch
+			if tc.valid {
+				if err != nil || account.Username != tc.username {
+					t.Errorf("Expected %s, got %v %v", tc.username, account, err)
+				}
+				return
+			}
+			if !errors.Is(err, errUserNotFound) {
+				t.Errorf("Expected errUserNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestImportUsersCSV(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryUserStore()
+
+	// Input: Import the seed CSV twice
+	first, err := importUsersCSV(ctx, store, usersCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := importUsersCSV(ctx, store, usersCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Expected Output: Every user is imported once and existing users are skipped
+	list, err := store.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == 0 || first != len(list) || second != 0 {
+		t.Errorf("Expected %d then 0 imports, got %d then %d", len(list), first, second)
+	}
+}
+
+func TestUsersCommand(t *testing.T) {
+	ctx := context.Background()
+	db := filepath.Join(t.TempDir(), "users.db")
+	run := func(t *testing.T, args ...string) (string, error) {
+		t.Helper()
+
+		var out bytes.Buffer
+		err := runUsersCommand(ctx, append([]string{"-db", db}, args...), &out)
+		return out.String(), err
+	}
+
+	t.Run("add with password", func(t *testing.T) {
+		// Input: users add alice password123
+		out, err := run(t, "add", "alice", "password123")
+
+		// Expected Output: The password is not echoed back
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(out, "password123") {
+			t.Errorf("Expected password not to be printed, got %q", out)
+		}
+	})
+
+	t.Run("add without password", func(t *testing.T) {
+		// Input: users add bob
+		out, err := run(t, "add", "bob")
+
+		// Expected Output: A generated password is printed
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out, "bob\t") || len(strings.TrimSpace(strings.TrimPrefix(out, "bob\t"))) < 8 {
+			t.Errorf("Expected a generated password, got %q", out)
+		}
+	})
+
+	t.Run("import, reset and remove", func(t *testing.T) {
+		csvPath := filepath.Join(t.TempDir(), "users.csv")
+		if err := os.WriteFile(csvPath, []byte("username,password\ncarol,password123\nalice,other-password\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		// Input: users import, reset, remove
+		if out, err := run(t, "import", csvPath); err != nil || out != "imported 1 users\n" {
+			t.Fatalf("Expected one import, got %q %v", out, err)
+		}
+		if _, err := run(t, "reset", "alice", "password456"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := run(t, "remove", "bob"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Expected Output: alice and carol remain and alice has the new password
+		out, err := run(t, "list")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out, "alice\t") || !strings.Contains(out, "\ncarol\t") || strings.Contains(out, "bob") {
+			t.Errorf("Unexpected list %q", out)
+		}
+		store, err := openSQLiteUserStore(ctx, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		account, err := store.Get(ctx, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bcrypt.CompareHashAndPassword(account.PasswordHash, []byte("password456")) != nil {
+			t.Error("Expected the reset password to match")
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		for _, args := range [][]string{{}, {"unknown"}, {"remove"}, {"remove", "nobody"}, {"add", "x", "password123"}} {
+			// Input: Invalid command lines
+			_, err := run(t, args...)
+
+			// Expected Output: An error
+			if err == nil {
+				t.Errorf("%q: expected an error", args)
+			}
+		}
+	})
+}
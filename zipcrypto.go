@@ -0,0 +1,123 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"hash/crc32"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"time"
+)
+
+// zipCrypto implements the traditional PKWARE encryption understood by every unzip tool.
+// It is weak by design, which is exactly what a brute-force stage needs.
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{keys: [3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := range len(password) {
+		z.update(password[i])
+	}
+	return z
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = crc32.IEEETable[byte(z.keys[0])^b] ^ (z.keys[0] >> 8)
+	z.keys[1] = (z.keys[1]+(z.keys[0]&0xff))*134775813 + 1
+	z.keys[2] = crc32.IEEETable[byte(z.keys[2])^byte(z.keys[1]>>24)] ^ (z.keys[2] >> 8)
+}
+
+func (z *zipCrypto) encrypt(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		temp := z.keys[2] | 2
+		out[i] = b ^ byte((temp*(temp^1))>>8)
+		z.update(b)
+	}
+	return out
+}
+
+// writeEncryptedFile adds a deflated, ZipCrypto encrypted file to the archive
+func writeEncryptedFile(zw *zip.Writer, name string, data []byte, password string, modified time.Time) error {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	checksum := crc32.ChecksumIEEE(data)
+	header := make([]byte, 12)
+	if _, err := rand.Read(header); err != nil {
+		return err
+	}
+	// The last header byte lets unzip tools reject a wrong password quickly
+	header[11] = byte(checksum >> 24)
+
+	z := newZipCrypto(password)
+	payload := append(z.encrypt(header), z.encrypt(compressed.Bytes())...)
+
+	fh := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		Flags:              0x1,
+		Modified:           modified,
+		CRC32:              checksum,
+		CompressedSize64:   uint64(len(payload)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	w, err := zw.CreateRaw(fh)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// buildEncryptedZip archives every file of fsys under root/ and encrypts it with password.
+// extra files are added next to the template files.
+func buildEncryptedZip(fsys fs.FS, root, password string, extra map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	modified := time.Now()
+
+	if _, err := zw.CreateHeader(&zip.FileHeader{Name: root + "/", Modified: modified}); err != nil {
+		return nil, err
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return writeEncryptedFile(zw, path.Join(root, name), data, password, modified)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(extra)) {
+		if err := writeEncryptedFile(zw, path.Join(root, name), extra[name], password, modified); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}